@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// contentCache keeps the decompressed contents of archive files up to a
+// maximum size in bytes. When it's full the least recently used contents
+// are discarded.
+type contentCache struct {
+	maxSize int64
+
+	m     sync.Mutex
+	size  int64
+	lru   *list.List
+	items map[string]*list.Element
+}
+
+type cacheItem struct {
+	key  string
+	data []byte
+}
+
+func newContentCache(maxSize int64) *contentCache {
+	return &contentCache{
+		maxSize: maxSize,
+		lru:     list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// cacheKey returns the cache key of the nth file of an archive.
+func cacheKey(archive string, n int) string {
+	return fmt.Sprintf("%s:%d", archive, n)
+}
+
+// open returns the cached content with the given key. If it's not cached
+// it's read with the read function and saved in the cache, unless it's
+// bigger than the cache.
+func (c *contentCache) open(
+	key string,
+	read func() ([]byte, error),
+) (content, error) {
+	data, ok := c.get(key)
+	if !ok {
+		var err error
+		data, err = read()
+		if err != nil {
+			return nil, err
+		}
+
+		c.put(key, data)
+	}
+
+	return memoryContent{Reader: bytes.NewReader(data)}, nil
+}
+
+func (c *contentCache) get(key string) ([]byte, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheItem).data, true
+}
+
+func (c *contentCache) put(key string, data []byte) {
+	size := int64(len(data))
+	if size > c.maxSize {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if _, ok := c.items[key]; ok {
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(&cacheItem{key: key, data: data})
+	c.size += size
+
+	for c.size > c.maxSize {
+		e := c.lru.Back()
+		item := e.Value.(*cacheItem)
+		c.lru.Remove(e)
+		delete(c.items, item.key)
+		c.size -= int64(len(item.data))
+	}
+}
+
+// clear discards all the cached contents.
+func (c *contentCache) clear() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.size = 0
+	c.lru.Init()
+	c.items = make(map[string]*list.Element)
+}
@@ -0,0 +1,35 @@
+/*
+
+Package archive implements a read only go-borges library that serves
+repositories stored in tar, gzip compressed tar and zip archives.
+
+Each archive in the root of the library filesystem, with extension .tar,
+.tar.gz, .tgz or .zip, is a location with the ID of its file name without
+the extension. The repositories inside an archive are detected like
+plain.IsRepository does, both bare and with a .git directory, and their ID is
+their path in the archive.
+
+The archives are not extracted to disk and are only kept open while their
+files are read. The files of tar archives and the zip entries stored without
+compression are read directly from the archive. Compressed zip entries are
+decompressed to memory when opened. Gzip compressed tar archives can't be
+read at random positions so opening one of their files decompresses the
+archive up to it, it's recommended to use them only for small datasets. The
+decompressed contents are kept in a cache limited by
+LibraryOptions.ContentCacheSize.
+
+An archive is indexed to find its repositories the first time its location
+is used. Only LibraryOptions.MaxLocations locations are kept in memory with
+their index, but the library remembers the repositories of every indexed
+archive so Library.Has does not read them again.
+
+Repositories are always opened in read only mode and do not support
+transactions.
+
+Importing this package registers the "archive" scheme for borges.Open with
+the options id and timeout:
+
+	archive:///data/archives
+
+*/
+package archive
@@ -0,0 +1,542 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/helper/chroot"
+)
+
+// entry is a file or directory stored in an archive.
+type entry struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	// open returns the contents of a regular file.
+	open func() (content, error)
+}
+
+// content is the data of a file stored in an archive. Closing it releases
+// the archive file opened to read it.
+type content interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// opener opens the archive file. Each file of the archive opens its own
+// descriptor so the archive is not kept open while it's not being read.
+type opener func() (billy.File, error)
+
+// sectionContent is the content of a file stored without compression, it's
+// read directly from the archive.
+type sectionContent struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// memoryContent is the content of a decompressed file.
+type memoryContent struct {
+	*bytes.Reader
+}
+
+func (memoryContent) Close() error {
+	return nil
+}
+
+func openSection(open opener, offset, size int64) (content, error) {
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sectionContent{
+		SectionReader: io.NewSectionReader(f, offset, size),
+		Closer:        f,
+	}, nil
+}
+
+var _ os.FileInfo = (*entry)(nil)
+
+func (e *entry) Name() string       { return e.name }
+func (e *entry) Size() int64        { return e.size }
+func (e *entry) Mode() os.FileMode  { return e.mode }
+func (e *entry) ModTime() time.Time { return e.modTime }
+func (e *entry) IsDir() bool        { return e.mode.IsDir() }
+func (e *entry) Sys() interface{}   { return nil }
+
+// archiveFS is a read only billy.Filesystem with the files of an archive.
+// Paths are cleaned and stored without leading slash, the root directory
+// is "".
+type archiveFS struct {
+	entries  map[string]*entry
+	children map[string][]string
+}
+
+var _ billy.Filesystem = (*archiveFS)(nil)
+
+func newArchiveFS() *archiveFS {
+	fs := &archiveFS{
+		entries:  make(map[string]*entry),
+		children: make(map[string][]string),
+	}
+
+	fs.entries[""] = &entry{name: "", mode: os.ModeDir | 0555}
+	return fs
+}
+
+// add stores the entry, creating its parent directories if needed.
+func (fs *archiveFS) add(p string, e *entry) {
+	p = clean(p)
+	if p == "" {
+		return
+	}
+
+	if _, ok := fs.entries[p]; !ok {
+		dir := path.Dir(p)
+		if dir == "." {
+			dir = ""
+		}
+
+		if _, ok := fs.entries[dir]; !ok {
+			fs.add(dir, &entry{mode: os.ModeDir | 0555, modTime: e.modTime})
+		}
+
+		fs.children[dir] = append(fs.children[dir], p)
+	}
+
+	e.name = path.Base(p)
+	fs.entries[p] = e
+}
+
+func clean(p string) string {
+	p = path.Clean("/" + filepath.ToSlash(p))
+	return strings.TrimPrefix(p, "/")
+}
+
+// readTar indexes the files of a tar archive. The contents of the files are
+// read from the archive when opened.
+func readTar(open opener, size int64) (*archiveFS, error) {
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cr := &countingReader{r: io.NewSectionReader(f, 0, size)}
+	tr := tar.NewReader(cr)
+
+	fs := newArchiveFS()
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fs, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		e := &entry{
+			size:    hdr.Size,
+			mode:    hdr.FileInfo().Mode(),
+			modTime: hdr.ModTime,
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg, tar.TypeRegA:
+			offset, size := cr.pos, hdr.Size
+			e.open = func() (content, error) {
+				return openSection(open, offset, size)
+			}
+		default:
+			// links and special files are not supported
+			continue
+		}
+
+		fs.add(hdr.Name, e)
+	}
+}
+
+// readTarGzip indexes the files of a gzip compressed tar archive. The
+// archive can't be read at random positions so only the position of each
+// file in the archive is kept. When a file is opened the archive is
+// decompressed up to it and its content is read to memory and saved in the
+// cache.
+func readTarGzip(open opener, c *contentCache) (*archiveFS, error) {
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+
+	fs := newArchiveFS()
+	for n := 0; ; n++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fs, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		e := &entry{
+			size:    hdr.Size,
+			mode:    hdr.FileInfo().Mode(),
+			modTime: hdr.ModTime,
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+		case tar.TypeReg, tar.TypeRegA:
+			key := cacheKey(f.Name(), n)
+			n := n
+			e.open = func() (content, error) {
+				return c.open(key, func() ([]byte, error) {
+					return readTarGzipFile(open, n)
+				})
+			}
+		default:
+			continue
+		}
+
+		fs.add(hdr.Name, e)
+	}
+}
+
+// readTarGzipFile returns the content of the nth file of a gzip compressed
+// tar archive.
+func readTarGzipFile(open opener, n int) ([]byte, error) {
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for i := 0; i <= n; i++ {
+		if _, err := tr.Next(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return nil, err
+		}
+	}
+
+	return ioutil.ReadAll(tr)
+}
+
+// readZip indexes the files of a zip archive. Files stored without
+// compression are read from the archive when opened, compressed ones are
+// decompressed to memory and saved in the cache.
+func readZip(open opener, size int64, c *contentCache) (*archiveFS, error) {
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := newArchiveFS()
+	for n, zf := range zr.File {
+		mode := zf.Mode()
+		e := &entry{
+			size:    int64(zf.UncompressedSize64),
+			mode:    mode,
+			modTime: zf.Modified,
+		}
+
+		switch {
+		case mode.IsDir():
+		case mode.IsRegular():
+			offset, err := zf.DataOffset()
+			if err != nil {
+				return nil, err
+			}
+
+			e.open = zipOpener(open, c, cacheKey(f.Name(), n), zf, offset)
+		default:
+			continue
+		}
+
+		fs.add(zf.Name, e)
+	}
+
+	return fs, nil
+}
+
+// zipOpener returns the function to open the content of a zip file stored
+// at the given offset of the archive.
+func zipOpener(
+	open opener,
+	c *contentCache,
+	key string,
+	zf *zip.File,
+	offset int64,
+) func() (content, error) {
+	method := zf.Method
+	compressed := int64(zf.CompressedSize64)
+	size := int64(zf.UncompressedSize64)
+
+	switch method {
+	case zip.Store:
+		return func() (content, error) {
+			return openSection(open, offset, size)
+		}
+	case zip.Deflate:
+		return func() (content, error) {
+			return c.open(key, func() ([]byte, error) {
+				f, err := open()
+				if err != nil {
+					return nil, err
+				}
+				defer f.Close()
+
+				fr := flate.NewReader(io.NewSectionReader(f, offset, compressed))
+				defer fr.Close()
+
+				data, err := ioutil.ReadAll(io.LimitReader(fr, size))
+				if err != nil {
+					return nil, err
+				}
+
+				if int64(len(data)) != size {
+					return nil, io.ErrUnexpectedEOF
+				}
+
+				return data, nil
+			})
+		}
+	default:
+		return func() (content, error) {
+			return nil, zip.ErrAlgorithm
+		}
+	}
+}
+
+// countingReader keeps the position of the reader so the offset of the
+// tar entries can be known.
+type countingReader struct {
+	r   io.ReadSeeker
+	pos int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.pos += int64(n)
+	return n, err
+}
+
+func (c *countingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := c.r.Seek(offset, whence)
+	if err == nil {
+		c.pos = pos
+	}
+
+	return pos, err
+}
+
+func (fs *archiveFS) entry(op, p string) (string, *entry, error) {
+	p = clean(p)
+	e, ok := fs.entries[p]
+	if !ok {
+		return "", nil, &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+	}
+
+	return p, e, nil
+}
+
+// Create implements billy.Basic interface.
+func (fs *archiveFS) Create(filename string) (billy.File, error) {
+	return nil, billy.ErrReadOnly
+}
+
+// Open implements billy.Basic interface.
+func (fs *archiveFS) Open(filename string) (billy.File, error) {
+	p, e, err := fs.entry("open", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.open == nil {
+		return nil, &os.PathError{Op: "open", Path: p, Err: billy.ErrNotSupported}
+	}
+
+	c, err := e.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &file{name: filename, content: c}, nil
+}
+
+// OpenFile implements billy.Basic interface. Only files opened for reading
+// are supported.
+func (fs *archiveFS) OpenFile(
+	filename string,
+	flag int,
+	perm os.FileMode,
+) (billy.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_APPEND|os.O_TRUNC) != 0 {
+		return nil, billy.ErrReadOnly
+	}
+
+	return fs.Open(filename)
+}
+
+// Stat implements billy.Basic interface.
+func (fs *archiveFS) Stat(filename string) (os.FileInfo, error) {
+	_, e, err := fs.entry("stat", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Rename implements billy.Basic interface.
+func (fs *archiveFS) Rename(oldpath, newpath string) error {
+	return billy.ErrReadOnly
+}
+
+// Remove implements billy.Basic interface.
+func (fs *archiveFS) Remove(filename string) error {
+	return billy.ErrReadOnly
+}
+
+// Join implements billy.Basic interface.
+func (fs *archiveFS) Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+// TempFile implements billy.TempFile interface.
+func (fs *archiveFS) TempFile(dir, prefix string) (billy.File, error) {
+	return nil, billy.ErrReadOnly
+}
+
+// ReadDir implements billy.Dir interface. The entries are sorted by name.
+func (fs *archiveFS) ReadDir(p string) ([]os.FileInfo, error) {
+	p, e, err := fs.entry("readdir", p)
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: os.ErrInvalid}
+	}
+
+	children := fs.children[p]
+	infos := make([]os.FileInfo, 0, len(children))
+	for _, c := range children {
+		infos = append(infos, fs.entries[c])
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	return infos, nil
+}
+
+// MkdirAll implements billy.Dir interface.
+func (fs *archiveFS) MkdirAll(filename string, perm os.FileMode) error {
+	return billy.ErrReadOnly
+}
+
+// Lstat implements billy.Symlink interface. Links are not supported so it's
+// the same as Stat.
+func (fs *archiveFS) Lstat(filename string) (os.FileInfo, error) {
+	return fs.Stat(filename)
+}
+
+// Symlink implements billy.Symlink interface.
+func (fs *archiveFS) Symlink(target, link string) error {
+	return billy.ErrReadOnly
+}
+
+// Readlink implements billy.Symlink interface.
+func (fs *archiveFS) Readlink(link string) (string, error) {
+	return "", billy.ErrNotSupported
+}
+
+// Chroot implements billy.Chroot interface.
+func (fs *archiveFS) Chroot(p string) (billy.Filesystem, error) {
+	return chroot.New(fs, p), nil
+}
+
+// Root implements billy.Chroot interface.
+func (fs *archiveFS) Root() string {
+	return string(filepath.Separator)
+}
+
+// Capabilities implements billy.Capable interface.
+func (fs *archiveFS) Capabilities() billy.Capability {
+	return billy.ReadCapability | billy.SeekCapability
+}
+
+// file is a read only billy.File for the content of an archive entry.
+type file struct {
+	name string
+	content
+}
+
+var _ billy.File = (*file)(nil)
+
+func (f *file) Name() string {
+	return f.name
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	return 0, billy.ErrReadOnly
+}
+
+func (f *file) Close() error {
+	return f.content.Close()
+}
+
+func (f *file) Lock() error {
+	return nil
+}
+
+func (f *file) Unlock() error {
+	return nil
+}
+
+func (f *file) Truncate(int64) error {
+	return billy.ErrReadOnly
+}
@@ -0,0 +1,454 @@
+package archive
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/util"
+
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+)
+
+// LibraryOptions hold configuration options for the library.
+type LibraryOptions struct {
+	// Cache specifies the shared cache used in repositories. If not defined
+	// a new default cache will be created for each repository.
+	Cache cache.Object
+	// Timeout set a timeout for library operations. Some operations could
+	// potentially take long so timing out them will make an error be
+	// returned. A 0 value sets a default value of 20 seconds.
+	Timeout time.Duration
+	// MaxLocations is the number of locations kept in memory with the index
+	// of their archive. When there are more the least recently used is
+	// discarded and indexed again when needed. A 0 value sets a default
+	// value of 16.
+	MaxLocations int
+	// ContentCacheSize is the maximum size in bytes of the decompressed
+	// contents of gzip compressed tar archives and compressed zip entries
+	// kept in memory. A 0 value sets a default value of 64 MiB.
+	ContentCacheSize int64
+}
+
+// Library is a read only borges.Library implementation for repositories
+// stored in archives. Each archive is a Location.
+type Library struct {
+	id   borges.LibraryID
+	fs   billy.Filesystem
+	opts *LibraryOptions
+
+	contents *contentCache
+
+	m    sync.Mutex
+	lru  *list.List
+	locs map[borges.LocationID]*list.Element
+	// repos holds the location of the repositories of the archives already
+	// indexed so they are not indexed again to find them.
+	repos   map[borges.RepositoryID]borges.LocationID
+	indexes map[borges.LocationID]bool
+}
+
+var _ borges.ContextLibrary = (*Library)(nil)
+
+const (
+	timeout          = 20 * time.Second
+	maxLocations     = 16
+	contentCacheSize = 64 * 1024 * 1024
+)
+
+// archiveExtensions are the supported archive file extensions.
+var archiveExtensions = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
+// NewLibrary builds a new Library with the archives stored in the root of
+// the given filesystem.
+func NewLibrary(
+	id string,
+	fs billy.Filesystem,
+	options *LibraryOptions,
+) *Library {
+	var opts LibraryOptions
+	if options != nil {
+		opts = *options
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = timeout
+	}
+
+	if opts.MaxLocations == 0 {
+		opts.MaxLocations = maxLocations
+	}
+
+	if opts.ContentCacheSize == 0 {
+		opts.ContentCacheSize = contentCacheSize
+	}
+
+	return &Library{
+		id:       borges.LibraryID(id),
+		fs:       fs,
+		opts:     &opts,
+		contents: newContentCache(opts.ContentCacheSize),
+		lru:      list.New(),
+		locs:     make(map[borges.LocationID]*list.Element),
+		repos:    make(map[borges.RepositoryID]borges.LocationID),
+		indexes:  make(map[borges.LocationID]bool),
+	}
+}
+
+// ID implements the borges.Library interface.
+func (l *Library) ID() borges.LibraryID {
+	return l.id
+}
+
+// Init implements the borges.Library interface.
+func (l *Library) Init(borges.RepositoryID) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
+// InitContext implements the borges.ContextLibrary interface.
+func (l *Library) InitContext(
+	context.Context,
+	borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
+// GetOrInit implements the borges.Library interface.
+func (l *Library) GetOrInit(borges.RepositoryID) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
+// GetOrInitContext implements the borges.ContextLibrary interface.
+func (l *Library) GetOrInitContext(
+	context.Context,
+	borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
+// Get implements the borges.Library interface. It only retrieves repositories
+// in borges.ReadOnlyMode ignoring the given parameter.
+func (l *Library) Get(
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.GetContext(ctx, id, mode)
+}
+
+// GetContext implements the borges.ContextLibrary interface. It only
+// retrieves repositories in borges.ReadOnlyMode ignoring the given
+// parameter.
+func (l *Library) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ok, _, locID, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, borges.ErrRepositoryNotExists.New(id)
+	}
+
+	loc, err := l.location(locID)
+	if err != nil {
+		return nil, err
+	}
+
+	return loc.GetContext(ctx, id, mode)
+}
+
+// Has implements the borges.Library interface.
+func (l *Library) Has(
+	id borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.HasContext(ctx, id)
+}
+
+// HasContext implements the borges.ContextLibrary interface. Only the
+// archives not indexed before are read to find the repository.
+func (l *Library) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
+	archives, err := l.archives(ctx)
+	if err != nil {
+		return false, "", "", err
+	}
+
+	l.m.Lock()
+	locID, ok := l.repos[id]
+	l.m.Unlock()
+
+	if ok {
+		if _, ok := archives[locID]; ok {
+			return true, l.id, locID, nil
+		}
+	}
+
+	for _, locID := range sortedIDs(archives) {
+		select {
+		case <-ctx.Done():
+			return false, "", "", ctx.Err()
+		default:
+		}
+
+		l.m.Lock()
+		done := l.indexes[locID]
+		l.m.Unlock()
+
+		if done {
+			continue
+		}
+
+		loc, err := l.location(locID)
+		if err != nil {
+			return false, "", "", err
+		}
+
+		has, err := loc.HasContext(ctx, id)
+		if err != nil {
+			return false, "", "", err
+		}
+
+		if has {
+			return true, l.id, locID, nil
+		}
+	}
+
+	return false, "", "", nil
+}
+
+// indexed adds the repositories of an indexed archive to the library index.
+// If a repository is in more than one archive the first one indexed is used.
+func (l *Library) indexed(
+	locID borges.LocationID,
+	repos map[borges.RepositoryID]string,
+) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.indexes[locID] = true
+	for id := range repos {
+		if _, ok := l.repos[id]; !ok {
+			l.repos[id] = locID
+		}
+	}
+}
+
+// Repositories implements the borges.Library interface. It only retrieves
+// repositories in borges.ReadOnlyMode ignoring the given parameter.
+func (l *Library) Repositories(
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.RepositoriesContext(ctx, mode)
+}
+
+// RepositoriesContext implements the borges.ContextLibrary interface. It
+// only retrieves repositories in borges.ReadOnlyMode ignoring the given
+// parameter.
+func (l *Library) RepositoriesContext(
+	ctx context.Context,
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	locs, err := l.locations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.NewLocationRepositoryIterator(locs, mode), nil
+}
+
+// Location implements the borges.Library interface.
+func (l *Library) Location(id borges.LocationID) (borges.Location, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.LocationContext(ctx, id)
+}
+
+// LocationContext implements the borges.ContextLibrary interface.
+func (l *Library) LocationContext(
+	ctx context.Context,
+	id borges.LocationID,
+) (borges.Location, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	return l.location(id)
+}
+
+// location returns the location with the given ID. The locations are kept
+// in memory up to LibraryOptions.MaxLocations.
+func (l *Library) location(id borges.LocationID) (*Location, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if e, ok := l.locs[id]; ok {
+		l.lru.MoveToFront(e)
+		return e.Value.(*Location), nil
+	}
+
+	for _, ext := range archiveExtensions {
+		path := string(id) + ext
+		if _, err := l.fs.Stat(path); err != nil {
+			continue
+		}
+
+		loc := newLocation(id, l, path)
+		l.locs[id] = l.lru.PushFront(loc)
+		if l.lru.Len() > l.opts.MaxLocations {
+			e := l.lru.Back()
+			l.lru.Remove(e)
+			delete(l.locs, e.Value.(*Location).id)
+		}
+
+		return loc, nil
+	}
+
+	return nil, borges.ErrLocationNotExists.New(id)
+}
+
+// Locations implements the borges.Library interface.
+func (l *Library) Locations() (borges.LocationIterator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.LocationsContext(ctx)
+}
+
+// LocationsContext implements the borges.ContextLibrary interface.
+func (l *Library) LocationsContext(
+	ctx context.Context,
+) (borges.LocationIterator, error) {
+	locs, err := l.locations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.NewLocationIterator(locs), nil
+}
+
+// locations returns a Location for each archive sorted by ID. The
+// locations not kept in memory are not added to it so iterating all of them
+// does not discard the ones in use.
+func (l *Library) locations(ctx context.Context) ([]borges.Location, error) {
+	archives, err := l.archives(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := sortedIDs(archives)
+	locs := make([]borges.Location, 0, len(ids))
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	for _, id := range ids {
+		if e, ok := l.locs[id]; ok {
+			locs = append(locs, e.Value.(*Location))
+			continue
+		}
+
+		locs = append(locs, newLocation(id, l, archives[id]))
+	}
+
+	return locs, nil
+}
+
+// archives returns the path of the archive of each location. When there are
+// several archives for the same location the first supported extension is
+// used like in Library.Location.
+func (l *Library) archives(
+	ctx context.Context,
+) (map[borges.LocationID]string, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	files, err := l.fs.ReadDir("")
+	if err != nil {
+		return nil, err
+	}
+
+	archives := make(map[borges.LocationID]string)
+	for _, ext := range archiveExtensions {
+		for _, f := range files {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+
+			id, ok := toLocID(f.Name())
+			if !ok || f.Name() != string(id)+ext {
+				continue
+			}
+
+			if _, ok := archives[id]; !ok {
+				archives[id] = f.Name()
+			}
+		}
+	}
+
+	return archives, nil
+}
+
+// Close discards the locations and decompressed contents kept in memory.
+// Archive files are only open while they are read so there's nothing else
+// to release.
+func (l *Library) Close() error {
+	l.m.Lock()
+	l.lru.Init()
+	l.locs = make(map[borges.LocationID]*list.Element)
+	l.repos = make(map[borges.RepositoryID]borges.LocationID)
+	l.indexes = make(map[borges.LocationID]bool)
+	l.m.Unlock()
+
+	l.contents.clear()
+	return nil
+}
+
+func sortedIDs(archives map[borges.LocationID]string) []borges.LocationID {
+	ids := make([]borges.LocationID, 0, len(archives))
+	for id := range archives {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids
+}
+
+// toLocID returns the location ID of an archive file name and false if it
+// does not have a supported extension.
+func toLocID(name string) (borges.LocationID, bool) {
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(name, ext) && len(name) > len(ext) {
+			return borges.LocationID(strings.TrimSuffix(name, ext)), true
+		}
+	}
+
+	return "", false
+}
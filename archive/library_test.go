@@ -0,0 +1,264 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	fixtures "gopkg.in/src-d/go-git-fixtures.v3"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func TestLibrary(t *testing.T) {
+	require.NoError(t, fixtures.Init())
+	defer fixtures.Clean()
+
+	dotgit := fixtures.Basic().One().DotGit().Root()
+
+	tests := []struct {
+		name  string
+		write func(*testing.T, io.Writer, map[string]string)
+	}{
+		{"repos.tar", writeTar},
+		{"repos.tar.gz", writeTarGzip},
+		{"repos.zip", writeZip(zip.Deflate)},
+		{"repos.zip", writeZip(zip.Store)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			fs := memfs.New()
+			f, err := fs.Create(test.name)
+			require.NoError(err)
+			test.write(t, f, map[string]string{
+				"github.com/foo/bar":      dotgit,
+				"github.com/foo/baz/.git": dotgit,
+			})
+			require.NoError(f.Close())
+
+			lib := NewLibrary("test", fs, nil)
+			defer lib.Close()
+
+			testLibrary(t, lib)
+		})
+	}
+}
+
+func TestLibrary_Limits(t *testing.T) {
+	require := require.New(t)
+	require.NoError(fixtures.Init())
+	defer fixtures.Clean()
+
+	dotgit := fixtures.Basic().One().DotGit().Root()
+
+	fs := memfs.New()
+	for name, write := range map[string]func(*testing.T, io.Writer, map[string]string){
+		"a.tar.gz": writeTarGzip,
+		"b.zip":    writeZip(zip.Deflate),
+	} {
+		f, err := fs.Create(name)
+		require.NoError(err)
+		write(t, f, map[string]string{
+			"github.com/foo/" + name: dotgit,
+		})
+		require.NoError(f.Close())
+	}
+
+	lib := NewLibrary("test", fs, &LibraryOptions{
+		MaxLocations:     1,
+		ContentCacheSize: 1024,
+	})
+	defer lib.Close()
+
+	for _, name := range []string{"a.tar.gz", "b.zip"} {
+		id := borges.RepositoryID("github.com/foo/" + name)
+		has, _, _, err := lib.Has(id)
+		require.NoError(err)
+		require.True(has)
+
+		r, err := lib.Get(id, borges.ReadOnlyMode)
+		require.NoError(err)
+
+		head, err := r.R().Head()
+		require.NoError(err)
+		_, err = r.R().CommitObject(head.Hash())
+		require.NoError(err)
+		require.NoError(r.Close())
+	}
+
+	require.Len(lib.locs, 1)
+	require.Len(lib.repos, 2)
+	require.True(lib.contents.size <= 1024)
+
+	has, _, _, err := lib.Has("github.com/foo/missing")
+	require.NoError(err)
+	require.False(has)
+}
+
+func testLibrary(t *testing.T, lib *Library) {
+	t.Helper()
+	require := require.New(t)
+
+	var locs []borges.LocationID
+	iter, err := lib.Locations()
+	require.NoError(err)
+	require.NoError(iter.ForEach(func(l borges.Location) error {
+		locs = append(locs, l.ID())
+		return nil
+	}))
+	require.Equal([]borges.LocationID{"repos"}, locs)
+
+	var ids []borges.RepositoryID
+	repos, err := lib.Repositories(borges.RWMode)
+	require.NoError(err)
+	require.NoError(repos.ForEach(func(r borges.Repository) error {
+		ids = append(ids, r.ID())
+		require.Equal(borges.ReadOnlyMode, r.Mode())
+		require.True(borges.ErrNonTransactional.Is(r.Commit()))
+		return r.Close()
+	}))
+	require.Equal([]borges.RepositoryID{
+		"github.com/foo/bar",
+		"github.com/foo/baz",
+	}, ids)
+
+	has, _, locID, err := lib.Has("github.com/foo/baz")
+	require.NoError(err)
+	require.True(has)
+	require.Equal(borges.LocationID("repos"), locID)
+
+	_, err = lib.Get("github.com/foo", borges.ReadOnlyMode)
+	require.True(borges.ErrRepositoryNotExists.Is(err))
+
+	_, err = lib.Init("github.com/foo/new")
+	require.True(borges.ErrNotImplemented.Is(err))
+
+	r, err := lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	head, err := r.R().Head()
+	require.NoError(err)
+	require.Equal(
+		plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		head.Hash(),
+	)
+
+	commits, err := r.R().Log(&git.LogOptions{From: head.Hash()})
+	require.NoError(err)
+	var count int
+	require.NoError(commits.ForEach(func(c *object.Commit) error {
+		_, err := c.Tree()
+		count++
+		return err
+	}))
+	require.Equal(8, count)
+
+	err = r.R().Storer.SetReference(
+		plumbing.NewHashReference("refs/heads/new", head.Hash()))
+	require.Error(err)
+
+	_, err = r.FS().Create("new")
+	require.Equal(billy.ErrReadOnly, err)
+}
+
+// walkFiles calls fn with the path relative to the archive of each file
+// and directory of dirs, a map of archive directories to local ones.
+func walkFiles(
+	t *testing.T,
+	dirs map[string]string,
+	fn func(name, local string, fi os.FileInfo),
+) {
+	t.Helper()
+
+	for prefix, dir := range dirs {
+		err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+
+			fn(path.Join(prefix, filepath.ToSlash(rel)), p, fi)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+}
+
+func writeTar(t *testing.T, w io.Writer, dirs map[string]string) {
+	t.Helper()
+	require := require.New(t)
+
+	tw := tar.NewWriter(w)
+	walkFiles(t, dirs, func(name, local string, fi os.FileInfo) {
+		hdr, err := tar.FileInfoHeader(fi, "")
+		require.NoError(err)
+		hdr.Name = name
+		require.NoError(tw.WriteHeader(hdr))
+
+		if fi.Mode().IsRegular() {
+			data, err := ioutil.ReadFile(local)
+			require.NoError(err)
+			_, err = tw.Write(data)
+			require.NoError(err)
+		}
+	})
+
+	require.NoError(tw.Close())
+}
+
+func writeTarGzip(t *testing.T, w io.Writer, dirs map[string]string) {
+	t.Helper()
+
+	gw := gzip.NewWriter(w)
+	writeTar(t, gw, dirs)
+	require.NoError(t, gw.Close())
+}
+
+func writeZip(method uint16) func(*testing.T, io.Writer, map[string]string) {
+	return func(t *testing.T, w io.Writer, dirs map[string]string) {
+		t.Helper()
+		require := require.New(t)
+
+		zw := zip.NewWriter(w)
+		walkFiles(t, dirs, func(name, local string, fi os.FileInfo) {
+			if !fi.Mode().IsRegular() {
+				return
+			}
+
+			hdr, err := zip.FileInfoHeader(fi)
+			require.NoError(err)
+			hdr.Name = name
+			hdr.Method = method
+
+			fw, err := zw.CreateHeader(hdr)
+			require.NoError(err)
+
+			data, err := ioutil.ReadFile(local)
+			require.NoError(err)
+			_, err = fw.Write(data)
+			require.NoError(err)
+		})
+
+		require.NoError(zw.Close())
+	}
+}
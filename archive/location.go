@@ -0,0 +1,321 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/plain"
+	"github.com/src-d/go-borges/util"
+
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+)
+
+// Location is a borges.Location for the repositories stored in an archive.
+type Location struct {
+	id   borges.LocationID
+	lib  *Library
+	path string
+
+	m     sync.Mutex
+	fs    *archiveFS
+	repos map[borges.RepositoryID]string
+}
+
+var _ borges.ContextLocation = (*Location)(nil)
+
+func newLocation(id borges.LocationID, lib *Library, path string) *Location {
+	return &Location{
+		id:   id,
+		lib:  lib,
+		path: path,
+	}
+}
+
+// ID implements the borges.Location interface.
+func (l *Location) ID() borges.LocationID {
+	return l.id
+}
+
+// Library implements the borges.Location interface.
+func (l *Location) Library() borges.Library {
+	return l.lib
+}
+
+// Init implements the borges.Location interface.
+func (l *Location) Init(borges.RepositoryID) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
+// InitContext implements the borges.ContextLocation interface.
+func (l *Location) InitContext(
+	context.Context,
+	borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
+// GetOrInit implements the borges.Location interface.
+func (l *Location) GetOrInit(borges.RepositoryID) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
+// GetOrInitContext implements the borges.ContextLocation interface.
+func (l *Location) GetOrInitContext(
+	context.Context,
+	borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
+// Get implements the borges.Location interface. It only retrieves
+// repositories in borges.ReadOnlyMode ignoring the given parameter.
+func (l *Location) Get(
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.lib.opts.Timeout)
+	defer cancel()
+
+	return l.GetContext(ctx, id, mode)
+}
+
+// GetContext implements the borges.ContextLocation interface. It only
+// retrieves repositories in borges.ReadOnlyMode ignoring the given
+// parameter.
+func (l *Location) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	_ borges.Mode,
+) (borges.Repository, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	fs, repos, err := l.archive()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, ok := repos[id]
+	if !ok {
+		return nil, borges.ErrRepositoryNotExists.New(id)
+	}
+
+	r, err := openRepository(l, id, fs, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Has implements the borges.Location interface.
+func (l *Location) Has(id borges.RepositoryID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.lib.opts.Timeout)
+	defer cancel()
+
+	return l.HasContext(ctx, id)
+}
+
+// HasContext implements the borges.ContextLocation interface.
+func (l *Location) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+	}
+
+	_, repos, err := l.archive()
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := repos[id]
+	return ok, nil
+}
+
+// Repositories implements the borges.Location interface. It only retrieves
+// repositories in borges.ReadOnlyMode ignoring the given parameter.
+func (l *Location) Repositories(
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	return l.RepositoriesContext(context.Background(), mode)
+}
+
+// RepositoriesContext implements the borges.ContextLocation interface. The
+// repositories are returned sorted by ID.
+func (l *Location) RepositoriesContext(
+	ctx context.Context,
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	_, repos, err := l.archive()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]borges.RepositoryID, 0, len(repos))
+	for id := range repos {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return &repositoryIterator{loc: l, mode: mode, ids: ids}, nil
+}
+
+func (l *Location) cache() cache.Object {
+	repoCache := l.lib.opts.Cache
+	if repoCache == nil {
+		repoCache = cache.NewObjectLRUDefault()
+	}
+
+	return repoCache
+}
+
+// archive returns the archive filesystem and the path of the git directory
+// of each repository. The archive is indexed the first time it's used and
+// its repositories are added to the library index.
+func (l *Location) archive() (
+	*archiveFS,
+	map[borges.RepositoryID]string,
+	error,
+) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.fs != nil {
+		return l.fs, l.repos, nil
+	}
+
+	fs, err := l.open()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	repos := make(map[borges.RepositoryID]string)
+	if err := l.findRepositories(fs, "", repos); err != nil {
+		return nil, nil, err
+	}
+
+	l.fs = fs
+	l.repos = repos
+	l.lib.indexed(l.id, repos)
+	return fs, repos, nil
+}
+
+func (l *Location) open() (*archiveFS, error) {
+	open := func() (billy.File, error) {
+		return l.lib.fs.Open(l.path)
+	}
+
+	if strings.HasSuffix(l.path, ".gz") || strings.HasSuffix(l.path, ".tgz") {
+		return readTarGzip(open, l.lib.contents)
+	}
+
+	fi, err := l.lib.fs.Stat(l.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(l.path, ".zip") {
+		return readZip(open, fi.Size(), l.lib.contents)
+	}
+
+	return readTar(open, fi.Size())
+}
+
+// findRepositories walks the directories of the archive adding to repos the
+// ones that contain a repository. A repository in the root of the archive
+// has the ID of the location.
+func (l *Location) findRepositories(
+	fs *archiveFS,
+	dir string,
+	repos map[borges.RepositoryID]string,
+) error {
+	id := borges.RepositoryID(dir)
+	if dir == "" {
+		id = borges.RepositoryID(l.id)
+	}
+
+	for _, bare := range []bool{true, false} {
+		ok, err := plain.IsRepository(fs, dir, bare)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			if !bare {
+				dir = path.Join(dir, ".git")
+			}
+
+			repos[id] = dir
+			return nil
+		}
+	}
+
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		err := l.findRepositories(fs, path.Join(dir, e.Name()), repos)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// repositoryIterator opens the repositories of a location.
+type repositoryIterator struct {
+	loc  *Location
+	mode borges.Mode
+	ids  []borges.RepositoryID
+}
+
+var _ borges.RepositoryIterator = (*repositoryIterator)(nil)
+
+// Next implements the borges.RepositoryIterator interface.
+func (i *repositoryIterator) Next() (borges.Repository, error) {
+	if len(i.ids) == 0 {
+		return nil, io.EOF
+	}
+
+	id := i.ids[0]
+	i.ids = i.ids[1:]
+
+	return i.loc.Get(id, i.mode)
+}
+
+// ForEach implements the borges.RepositoryIterator interface.
+func (i *repositoryIterator) ForEach(cb func(borges.Repository) error) error {
+	return util.ForEachRepositoryIterator(i, cb)
+}
+
+// Close implements the borges.RepositoryIterator interface.
+func (i *repositoryIterator) Close() {}
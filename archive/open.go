@@ -0,0 +1,34 @@
+package archive
+
+import (
+	"net/url"
+
+	borges "github.com/src-d/go-borges"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+func init() {
+	borges.Register("archive", open)
+}
+
+// open is the borges.Opener of the "archive" scheme described in the package
+// documentation.
+func open(u *url.URL) (borges.Library, error) {
+	path, err := borges.URLPath(u)
+	if err != nil {
+		return nil, err
+	}
+
+	o := borges.NewURLOptions(u)
+	id := o.String("id", "")
+	opts := &LibraryOptions{
+		Timeout: o.Duration("timeout", 0),
+	}
+
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewLibrary(id, osfs.New(path), opts), nil
+}
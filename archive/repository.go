@@ -0,0 +1,92 @@
+package archive
+
+import (
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/util"
+
+	billy "gopkg.in/src-d/go-billy.v4"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// Repository is a read only borges.Repository stored in an archive. It
+// doesn't support transactions.
+type Repository struct {
+	id   borges.RepositoryID
+	loc  *Location
+	repo *git.Repository
+	sto  *filesystem.Storage
+	fs   billy.Filesystem
+}
+
+var _ borges.Repository = (*Repository)(nil)
+
+func openRepository(
+	loc *Location,
+	id borges.RepositoryID,
+	archive *archiveFS,
+	dir string,
+) (*Repository, error) {
+	fs, err := archive.Chroot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sto := filesystem.NewStorageWithOptions(fs, loc.cache(),
+		filesystem.Options{
+			ExclusiveAccess: true,
+			KeepDescriptors: true,
+		},
+	)
+
+	repo, err := git.Open(&util.ReadOnlyStorer{Storer: sto}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		id:   id,
+		loc:  loc,
+		repo: repo,
+		sto:  sto,
+		fs:   fs,
+	}, nil
+}
+
+// ID implements the borges.Repository interface.
+func (r *Repository) ID() borges.RepositoryID {
+	return r.id
+}
+
+// Location implements the borges.Repository interface.
+func (r *Repository) Location() borges.Location {
+	return r.loc
+}
+
+// Mode implements the borges.Repository interface. It always returns
+// borges.ReadOnlyMode.
+func (r *Repository) Mode() borges.Mode {
+	return borges.ReadOnlyMode
+}
+
+// Commit implements the borges.Repository interface. It always returns
+// borges.ErrNonTransactional.
+func (r *Repository) Commit() error {
+	return borges.ErrNonTransactional.New()
+}
+
+// Close implements the borges.Repository interface.
+func (r *Repository) Close() error {
+	return r.sto.Close()
+}
+
+// R implements the borges.Repository interface.
+func (r *Repository) R() *git.Repository {
+	return r.repo
+}
+
+// FS implements the borges.Repository interface. The filesystem is read
+// only.
+func (r *Repository) FS() billy.Filesystem {
+	return r.fs
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/plain"
+	"github.com/src-d/go-borges/siva"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+var commands = map[string]*command{
+	"ls": {
+		args:  "[libraries|locations|repos]",
+		help:  "list the libraries, locations or repositories, by default repositories",
+		flags: lsFlags,
+		run:   ls,
+	},
+	"show": {
+		args: "<repository>",
+		help: "show the location, HEAD and references of a repository",
+		run:  show,
+	},
+	"has": {
+		args: "<repository>",
+		help: "show the location of a repository or fail if it does not exist",
+		run:  has,
+	},
+	"fsck": {
+		help:  "verify the integrity of the locations and repositories",
+		flags: fsckFlags,
+		run:   fsck,
+	},
+	"recover": {
+		help:  "repair siva files left by unfinished transactions",
+		write: true,
+		run:   recoverLocations,
+	},
+	"versions": {
+		args: "[location...]",
+		help: "show the library version and the versions of the siva locations",
+		run:  versions,
+	},
+	"set-version": {
+		args:  "<version>",
+		help:  "set the version of the siva library used for reading",
+		write: true,
+		run:   setVersion,
+	},
+	"export": {
+		args: "<repository> <directory>",
+		help: "write a siva repository to a directory as a bare git repository",
+		run:  export,
+	},
+	"import": {
+		args:  "<directory> <location>",
+		help:  "copy a git repository from a directory to a siva location",
+		write: true,
+		flags: importFlags,
+		run:   importRepository,
+	},
+}
+
+var errFsck = errors.New("problems found")
+
+func lsFlags(fs *flag.FlagSet, o *options) {
+	fs.BoolVar(&o.long, "l", false,
+		"show the location of each repository")
+}
+
+func ls(e *env, args []string) error {
+	what := "repos"
+	switch len(args) {
+	case 0:
+	case 1:
+		what = args[0]
+	default:
+		return errUsage
+	}
+
+	switch what {
+	case "libraries":
+		return listLibraries(e)
+	case "locations":
+		return listLocations(e)
+	case "repos", "repositories":
+		return listRepositories(e)
+	default:
+		return errUsage
+	}
+}
+
+func listLibraries(e *env) error {
+	fmt.Fprintln(e.out, e.lib.ID())
+
+	libs, ok := e.lib.Library.(interface {
+		Libraries() (borges.LibraryIterator, error)
+	})
+	if !ok {
+		return nil
+	}
+
+	iter, err := libs.Libraries()
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(l borges.Library) error {
+		fmt.Fprintln(e.out, l.ID())
+		return nil
+	})
+}
+
+func listLocations(e *env) error {
+	iter, err := e.lib.Locations()
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(l borges.Location) error {
+		fmt.Fprintln(e.out, l.ID())
+		return nil
+	})
+}
+
+func listRepositories(e *env) error {
+	iter, err := e.lib.Repositories(borges.ReadOnlyMode)
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(r borges.Repository) error {
+		if e.opts.long {
+			fmt.Fprintf(e.out, "%s\t%s\n", r.ID(), r.Location().ID())
+		} else {
+			fmt.Fprintln(e.out, r.ID())
+		}
+
+		return r.Close()
+	})
+}
+
+func show(e *env, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	r, err := e.lib.Get(borges.RepositoryID(args[0]), borges.ReadOnlyMode)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	fmt.Fprintf(e.out, "repository %s\n", r.ID())
+	fmt.Fprintf(e.out, "location %s\n", r.Location().ID())
+
+	head, err := r.R().Reference(plumbing.HEAD, false)
+	switch {
+	case err == plumbing.ErrReferenceNotFound:
+		fmt.Fprintln(e.out, "HEAD not found")
+	case err != nil:
+		return err
+	case head.Type() == plumbing.SymbolicReference:
+		resolved, err := r.R().Reference(plumbing.HEAD, true)
+		if err != nil {
+			fmt.Fprintf(e.out, "HEAD -> %s not found\n", head.Target())
+		} else {
+			fmt.Fprintf(e.out, "HEAD -> %s %s\n", head.Target(), resolved.Hash())
+		}
+	default:
+		fmt.Fprintf(e.out, "HEAD %s\n", head.Hash())
+	}
+
+	iter, err := r.R().Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() != plumbing.HEAD {
+			refs = append(refs, ref)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Name() < refs[j].Name()
+	})
+
+	fmt.Fprintln(e.out)
+	for _, ref := range refs {
+		fmt.Fprintln(e.out, ref)
+	}
+
+	return nil
+}
+
+func has(e *env, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	id := borges.RepositoryID(args[0])
+	ok, lib, loc, err := e.lib.Has(id)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return borges.ErrRepositoryNotExists.New(id)
+	}
+
+	if lib == "" {
+		fmt.Fprintln(e.out, loc)
+	} else {
+		fmt.Fprintf(e.out, "%s\t%s\n", lib, loc)
+	}
+
+	return nil
+}
+
+func fsckFlags(fs *flag.FlagSet, o *options) {
+	fs.BoolVar(&o.objects, "objects", false,
+		"read all the objects reachable from the references, it can be slow")
+}
+
+func fsck(e *env, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	report, err := borges.Verify(context.Background(), e.lib,
+		&borges.VerifyOptions{Objects: e.opts.objects})
+	if err != nil {
+		return err
+	}
+
+	for _, err := range report.Errors {
+		fmt.Fprintln(e.out, err)
+	}
+
+	var repos int
+	for _, l := range report.Locations {
+		for _, err := range l.Errors {
+			fmt.Fprintf(e.out, "%s: %s\n", l.ID, err)
+		}
+
+		for _, r := range l.Repositories {
+			repos++
+			for _, err := range r.Errors {
+				fmt.Fprintf(e.out, "%s %s: %s\n", l.ID, r.ID, err)
+			}
+		}
+	}
+
+	fmt.Fprintf(e.out, "%d locations and %d repositories verified\n",
+		len(report.Locations), repos)
+
+	if !report.OK() {
+		return errFsck
+	}
+
+	return nil
+}
+
+func recoverLocations(e *env, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	lib, err := e.lib.siva()
+	if err != nil {
+		return err
+	}
+
+	recovered, err := lib.Recover(context.Background())
+	for _, r := range recovered {
+		if r.Err != nil {
+			fmt.Fprintf(e.out, "%s: %s\n", r.Location, r.Err)
+		} else if r.Offset == 0 {
+			fmt.Fprintf(e.out, "%s: deleted\n", r.Location)
+		} else {
+			fmt.Fprintf(e.out, "%s: truncated from %d to %d bytes\n",
+				r.Location, r.Size, r.Offset)
+		}
+	}
+
+	return err
+}
+
+func versions(e *env, args []string) error {
+	lib, err := e.lib.siva()
+	if err != nil {
+		return err
+	}
+
+	v, err := lib.Version()
+	if err != nil {
+		return err
+	}
+
+	if v < 0 {
+		fmt.Fprintln(e.out, "library version not set")
+	} else {
+		fmt.Fprintf(e.out, "library version %d\n", v)
+	}
+
+	var locs []borges.Location
+	if len(args) == 0 {
+		iter, err := lib.Locations()
+		if err != nil {
+			return err
+		}
+
+		err = iter.ForEach(func(l borges.Location) error {
+			locs = append(locs, l)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range args {
+		l, err := lib.Location(borges.LocationID(id))
+		if err != nil {
+			return err
+		}
+
+		locs = append(locs, l)
+	}
+
+	for _, l := range locs {
+		loc, ok := l.(*siva.Location)
+		if !ok {
+			continue
+		}
+
+		for n := 0; n <= loc.LastVersion(); n++ {
+			v, err := loc.Version(n)
+			if err != nil {
+				continue
+			}
+
+			fmt.Fprintf(e.out, "%s\t%d\toffset %d\tsize %d\n",
+				loc.ID(), n, v.Offset, v.Size)
+		}
+	}
+
+	return nil
+}
+
+func setVersion(e *env, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid version %q", args[0])
+	}
+
+	lib, err := e.lib.siva()
+	if err != nil {
+		return err
+	}
+
+	return lib.SetVersion(n)
+}
+
+func export(e *env, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	if _, err := e.lib.siva(); err != nil {
+		return err
+	}
+
+	r, err := e.lib.Get(borges.RepositoryID(args[0]), borges.ReadOnlyMode)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return r.(*siva.Repository).Export(osfs.New(args[1]))
+}
+
+func importFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.repository, "repository", "",
+		"ID of the imported repository, by default the directory name")
+}
+
+// importedRepository changes the ID of the repository to import.
+type importedRepository struct {
+	borges.Repository
+	id borges.RepositoryID
+}
+
+func (r *importedRepository) ID() borges.RepositoryID {
+	return r.id
+}
+
+func importRepository(e *env, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	lib, err := e.lib.siva()
+	if err != nil {
+		return err
+	}
+
+	dir, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+
+	// non bare repositories have their git directory in .git
+	_, err = os.Stat(filepath.Join(dir, ".git"))
+	bare := os.IsNotExist(err)
+
+	src, err := plain.NewLocation("import", osfs.New(filepath.Dir(dir)),
+		&plain.LocationOptions{Bare: bare})
+	if err != nil {
+		return err
+	}
+
+	r, err := src.Get(borges.RepositoryID(filepath.Base(dir)), borges.ReadOnlyMode)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if id := e.opts.repository; id != "" {
+		r = &importedRepository{Repository: r, id: borges.RepositoryID(id)}
+	}
+
+	locID := borges.LocationID(args[1])
+	loc, err := lib.Location(locID)
+	if borges.ErrLocationNotExists.Is(err) {
+		loc, err = lib.AddLocation(locID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return siva.Import(r, loc.(*siva.Location))
+}
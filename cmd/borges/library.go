@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/legacysiva"
+	"github.com/src-d/go-borges/plain"
+	"github.com/src-d/go-borges/siva"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+const (
+	layoutSiva       = "siva"
+	layoutLegacySiva = "legacysiva"
+	layoutPlain      = "plain"
+)
+
+// libraryFlags are the flags shared by all the commands to choose the
+// library to use.
+type libraryFlags struct {
+	layout        string
+	path          string
+	id            string
+	bucket        int
+	rooted        bool
+	transactional bool
+	bare          bool
+}
+
+func (f *libraryFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.layout, "layout", layoutSiva,
+		"library layout: siva, legacysiva or plain")
+	fs.StringVar(&f.path, "path", ".", "directory of the library")
+	fs.StringVar(&f.id, "id", "", "library ID")
+	fs.IntVar(&f.bucket, "bucket", 0, "bucket level of siva files")
+	fs.BoolVar(&f.rooted, "rooted", true,
+		"show each remote of siva files as a repository")
+	fs.BoolVar(&f.transactional, "transactional", true,
+		"use transactions to write siva and plain repositories")
+	fs.BoolVar(&f.bare, "bare", true, "plain repositories are bare")
+}
+
+// library is an opened library. close must be called once it's not used.
+type library struct {
+	borges.Library
+	tmp string
+}
+
+func (l *library) close() error {
+	if l.tmp == "" {
+		return nil
+	}
+
+	return os.RemoveAll(l.tmp)
+}
+
+// siva returns the siva library or an error if the layout is other.
+func (l *library) siva() (*siva.Library, error) {
+	lib, ok := l.Library.(*siva.Library)
+	if !ok {
+		return nil, fmt.Errorf("only supported by %s layout", layoutSiva)
+	}
+
+	return lib, nil
+}
+
+// open opens the library chosen with the flags. Unless write is set the
+// library metadata is not created or modified.
+func (f *libraryFlags) open(write bool) (*library, error) {
+	fs := osfs.New(f.path)
+
+	switch f.layout {
+	case layoutSiva:
+		tmp, err := ioutil.TempDir("", "borges")
+		if err != nil {
+			return nil, err
+		}
+
+		lib, err := siva.NewLibrary(f.id, fs, &siva.LibraryOptions{
+			Bucket:           f.bucket,
+			RootedRepo:       f.rooted,
+			Transactional:    f.transactional,
+			TempFS:           osfs.New(tmp),
+			MetadataReadOnly: !write,
+		})
+		if err != nil {
+			_ = os.RemoveAll(tmp)
+			return nil, err
+		}
+
+		return &library{Library: lib, tmp: tmp}, nil
+
+	case layoutLegacySiva:
+		lib, err := legacysiva.NewLibrary(f.id, fs, &legacysiva.LibraryOptions{
+			Bucket:     f.bucket,
+			RootedRepo: f.rooted,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &library{Library: lib}, nil
+
+	case layoutPlain:
+		id := f.id
+		if id == "" {
+			abs, err := filepath.Abs(f.path)
+			if err != nil {
+				return nil, err
+			}
+
+			id = filepath.Base(abs)
+		}
+
+		loc, err := plain.NewLocation(borges.LocationID(id), fs,
+			&plain.LocationOptions{
+				Bare:          f.bare,
+				Transactional: f.transactional,
+			})
+		if err != nil {
+			return nil, err
+		}
+
+		lib := plain.NewLibrary(borges.LibraryID(id), nil)
+		lib.AddLocation(loc)
+
+		return &library{Library: lib}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown layout %q", f.layout)
+	}
+}
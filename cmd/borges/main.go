@@ -0,0 +1,123 @@
+// Command borges inspects and administers go-borges libraries stored in
+// siva, legacysiva or plain layouts.
+//
+// Usage:
+//
+//	borges <command> [flags] [arguments]
+//
+// Run "borges help" to list the commands and "borges <command> -h" to see
+// the flags of a command.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// command is a borges subcommand.
+type command struct {
+	// args describes the positional arguments of the command.
+	args string
+	// help is the one line description of the command.
+	help string
+	// write opens the library allowing to modify its metadata.
+	write bool
+	// flags registers the specific flags of the command in options.
+	flags func(*flag.FlagSet, *options)
+	// run executes the command with the remaining arguments.
+	run func(env *env, args []string) error
+}
+
+// options holds the values of the specific flags of the commands. Each
+// invocation of run uses a new one.
+type options struct {
+	// long is the -l flag of ls.
+	long bool
+	// objects is the -objects flag of fsck.
+	objects bool
+	// repository is the -repository flag of import.
+	repository string
+}
+
+// env is passed to the commands when they are executed.
+type env struct {
+	lib  *library
+	opts *options
+	out  io.Writer
+}
+
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "borges: %s\n", err)
+		}
+
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out, errOut io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" {
+		usage(errOut)
+		return flag.ErrHelp
+	}
+
+	name := args[0]
+	cmd, ok := commands[name]
+	if !ok {
+		usage(errOut)
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	var lf libraryFlags
+	var opts options
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	fs.Usage = func() {
+		fmt.Fprintf(errOut, "usage: borges %s [flags] %s\n\n%s\n\nflags:\n",
+			name, cmd.args, cmd.help)
+		fs.PrintDefaults()
+	}
+
+	lf.register(fs)
+	if cmd.flags != nil {
+		cmd.flags(fs, &opts)
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	lib, err := lf.open(cmd.write)
+	if err != nil {
+		return err
+	}
+	defer lib.close()
+
+	err = cmd.run(&env{lib: lib, opts: &opts, out: out}, fs.Args())
+	if err == errUsage {
+		fs.Usage()
+	}
+
+	return err
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: borges <command> [flags] [arguments]\n\ncommands:\n")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12s %s\n", name, commands[name].help)
+	}
+}
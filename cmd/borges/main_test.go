@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const rootedSiva = "cf2e799463e1a00dbd1addd2003b0c7db31dbfe2"
+
+func setupPath(t *testing.T) string {
+	t.Helper()
+	require := require.New(t)
+
+	path, err := ioutil.TempDir("", "go-borges-cmd")
+	require.NoError(err)
+
+	data, err := ioutil.ReadFile(
+		filepath.Join("..", "..", "_testdata", "rooted", rootedSiva+".siva"))
+	require.NoError(err)
+
+	err = ioutil.WriteFile(
+		filepath.Join(path, rootedSiva+".siva"), data, 0644)
+	require.NoError(err)
+
+	return path
+}
+
+func runCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+	err := run(args, &out, &errOut)
+	return out.String(), err
+}
+
+func TestRun(t *testing.T) {
+	require := require.New(t)
+
+	path := setupPath(t)
+	defer os.RemoveAll(path)
+
+	out, err := runCommand(t, "ls", "-path", path, "locations")
+	require.NoError(err)
+	require.Equal(rootedSiva+"\n", out)
+
+	out, err = runCommand(t, "ls", "-path", path, "-l")
+	require.NoError(err)
+	require.Contains(out, "gitserver.com/a\t"+rootedSiva+"\n")
+
+	// flags are not kept between invocations
+	out, err = runCommand(t, "ls", "-path", path)
+	require.NoError(err)
+	require.Contains(out, "gitserver.com/a\n")
+	require.NotContains(out, "\t")
+
+	out, err = runCommand(t, "has", "-path", path, "gitserver.com/a")
+	require.NoError(err)
+	require.Equal(rootedSiva+"\n", out)
+
+	_, err = runCommand(t, "has", "-path", path, "gitserver.com/missing")
+	require.Error(err)
+
+	out, err = runCommand(t, "show", "-path", path, "gitserver.com/a")
+	require.NoError(err)
+	require.True(strings.HasPrefix(out,
+		"repository gitserver.com/a\nlocation "+rootedSiva+"\n"))
+	require.Contains(out, "refs/heads/master")
+
+	out, err = runCommand(t, "fsck", "-path", path)
+	require.NoError(err)
+	require.Contains(out, "1 locations and")
+
+	_, err = runCommand(t, "ls", "-path", path, "unknown")
+	require.Equal(errUsage, err)
+
+	_, err = runCommand(t, "unknown")
+	require.Error(err)
+}
+
+func TestRun_Versions(t *testing.T) {
+	require := require.New(t)
+
+	path := setupPath(t)
+	defer os.RemoveAll(path)
+
+	out, err := runCommand(t, "versions", "-path", path)
+	require.NoError(err)
+	require.Equal("library version not set\n", out)
+
+	// read-only commands do not create the metadata
+	_, err = os.Stat(filepath.Join(path, "library.yaml"))
+	require.True(os.IsNotExist(err))
+
+	_, err = runCommand(t, "set-version", "-path", path, "3")
+	require.NoError(err)
+
+	out, err = runCommand(t, "versions", "-path", path)
+	require.NoError(err)
+	require.Equal("library version 3\n", out)
+
+	_, err = runCommand(t, "set-version", "-path", path, "three")
+	require.Error(err)
+
+	_, err = runCommand(t, "versions", "-layout", "plain", "-path", path)
+	require.Error(err)
+}
@@ -56,6 +56,20 @@ This example lists the repositories downloaded by gitcollector:
 		})
 	}
 
+Libraries can also be opened with a URL using Open. The scheme chooses the
+backend, that is registered importing its package, and the query holds its
+options:
+
+	import (
+		"github.com/src-d/go-borges"
+		_ "github.com/src-d/go-borges/siva"
+	)
+
+	lib, err := borges.Open("siva:///data/lib?bucket=2&rooted=true&transactional=true")
+
+New backends are made available to Open calling Register from the init
+function of their package.
+
 More information:
 
 * go-git: https://github.com/src-d/go-git
@@ -0,0 +1,291 @@
+package borges
+
+import (
+	"context"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage"
+)
+
+// DefaultFetchRefSpecs are the refspecs used by Fetch when none are
+// provided, the repository is not rooted and its remote has none configured.
+// As in git the branches of the remote are copied to "refs/remotes/origin/",
+// so the local branches and HEAD are not modified.
+var DefaultFetchRefSpecs = []config.RefSpec{
+	"+refs/heads/*:refs/remotes/origin/*",
+}
+
+// RootedFetchRefSpecs are the refspecs used by Fetch when none are provided
+// and the repository is rooted. All the references of the remote and its
+// HEAD are copied with the same name to the repository, that is the same as
+// fetching them to "refs/remotes/<id>/" of the rooted repository.
+var RootedFetchRefSpecs = []config.RefSpec{
+	"+HEAD:HEAD",
+	"+refs/*:refs/*",
+}
+
+// RootedStorer is implemented by the storers of repositories that are a
+// view of a rooted repository, where the references of the repository are
+// kept under "refs/remotes/<id>/".
+type RootedStorer interface {
+	storage.Storer
+	// RootedID returns the ID of the repository in the rooted repository
+	// or an empty string if the storer shows the whole rooted repository.
+	RootedID() string
+}
+
+// FetchOptions holds configuration options for Fetch.
+type FetchOptions struct {
+	// URL of the remote to fetch from. If it's empty the first URL of the
+	// repository remote with the same name as its ID, as in rooted
+	// repositories, or "origin" is used.
+	URL string
+	// RefSpecs to use in the fetch. If empty RootedFetchRefSpecs are used
+	// for rooted repositories. The rest use the refspecs of the remote
+	// used to find the URL or DefaultFetchRefSpecs if it has none.
+	RefSpecs []config.RefSpec
+	// Auth credentials, if required, to use with the remote repository.
+	Auth transport.AuthMethod
+	// Progress is where the human readable information sent by the server
+	// is stored. If nil nothing is stored.
+	Progress sideband.Progress
+}
+
+// ReferenceChange is a reference modified by Fetch. Old is zero for created
+// references and New is zero for deleted ones.
+type ReferenceChange struct {
+	Name plumbing.ReferenceName
+	Old  plumbing.Hash
+	New  plumbing.Hash
+}
+
+// Fetch is like FetchContext with a background context.
+func Fetch(
+	lib Library,
+	id RepositoryID,
+	options *FetchOptions,
+) ([]ReferenceChange, error) {
+	return FetchContext(context.Background(), lib, id, options)
+}
+
+// FetchContext fetches the remote into the repository of the library with
+// the given ID and returns the references that changed. The repository is
+// opened in RWMode and the changes are committed only if the fetch
+// succeeds, otherwise they are discarded. When the repository is already up
+// to date nothing is committed and no changes nor error are returned.
+func FetchContext(
+	ctx context.Context,
+	lib Library,
+	id RepositoryID,
+	options *FetchOptions,
+) ([]ReferenceChange, error) {
+	if options == nil {
+		options = &FetchOptions{}
+	}
+
+	var r Repository
+	var err error
+	if l, ok := lib.(ContextLibrary); ok {
+		r, err = l.GetContext(ctx, id, RWMode)
+	} else {
+		r, err = lib.Get(id, RWMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := fetch(ctx, r, options)
+	if err != nil || len(changes) == 0 {
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+
+		return nil, err
+	}
+
+	err = r.Commit()
+	if ErrNonTransactional.Is(err) {
+		err = r.Close()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func fetch(
+	ctx context.Context,
+	r Repository,
+	options *FetchOptions,
+) ([]ReferenceChange, error) {
+	remote, err := repositoryRemote(r)
+	if err != nil {
+		return nil, err
+	}
+
+	url := options.URL
+	if url == "" {
+		if remote == nil {
+			return nil, git.ErrRemoteNotFound
+		}
+
+		url = remote.URLs[0]
+	}
+
+	specs := options.RefSpecs
+	if len(specs) == 0 {
+		switch {
+		case isRooted(r):
+			specs = RootedFetchRefSpecs
+		case remote != nil && len(remote.Fetch) > 0:
+			specs = remote.Fetch
+		default:
+			specs = DefaultFetchRefSpecs
+		}
+	}
+
+	before, err := hashReferences(r.R())
+	if err != nil {
+		return nil, err
+	}
+
+	sto := &fetchStorer{Storer: r.R().Storer, url: url}
+	repo, err := git.Open(sto, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: fetchRemote,
+		RefSpecs:   specs,
+		Auth:       options.Auth,
+		Progress:   options.Progress,
+		Tags:       git.NoTags,
+	})
+	if err == git.NoErrAlreadyUpToDate {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := hashReferences(r.R())
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ReferenceChange
+	for name, hash := range after {
+		if old := before[name]; old != hash {
+			changes = append(changes, ReferenceChange{
+				Name: name,
+				Old:  old,
+				New:  hash,
+			})
+		}
+	}
+
+	for name, hash := range before {
+		if _, ok := after[name]; !ok {
+			changes = append(changes, ReferenceChange{
+				Name: name,
+				Old:  hash,
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes, nil
+}
+
+// repositoryRemote returns the configuration of the first remote with URLs
+// named as the repository or "origin", nil if there is none.
+func repositoryRemote(r Repository) (*config.RemoteConfig, error) {
+	for _, name := range []string{r.ID().String(), git.DefaultRemoteName} {
+		remote, err := r.R().Remote(name)
+		if err == git.ErrRemoteNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg := remote.Config(); len(cfg.URLs) > 0 {
+			return cfg, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// isRooted returns true if the repository is a view of a rooted repository.
+func isRooted(r Repository) bool {
+	sto, ok := r.R().Storer.(RootedStorer)
+	return ok && sto.RootedID() != ""
+}
+
+// fetchRemote is the name of the remote added by fetchStorer.
+const fetchRemote = "borges-fetch"
+
+// fetchStorer adds to the configuration of the storer a remote with the
+// URL to fetch. The stored configuration is not modified.
+type fetchStorer struct {
+	storage.Storer
+	url string
+}
+
+// Config implements config.ConfigStorer interface.
+func (s *fetchStorer) Config() (*config.Config, error) {
+	cfg, err := s.Storer.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	c := *cfg
+	c.Remotes = make(map[string]*config.RemoteConfig, len(cfg.Remotes)+1)
+	for name, remote := range cfg.Remotes {
+		c.Remotes[name] = remote
+	}
+
+	c.Remotes[fetchRemote] = &config.RemoteConfig{
+		Name: fetchRemote,
+		URLs: []string{s.url},
+	}
+
+	return &c, nil
+}
+
+func hashReferences(
+	r *git.Repository,
+) (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	iter, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make(map[plumbing.ReferenceName]plumbing.Hash)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			refs[ref.Name()] = ref.Hash()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
@@ -0,0 +1,187 @@
+package borges_test
+
+import (
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/plain"
+	"github.com/src-d/go-borges/siva"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	fixtures "gopkg.in/src-d/go-git-fixtures.v3"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+var (
+	master = plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch = plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+)
+
+func TestFetch_Siva(t *testing.T) {
+	require := require.New(t)
+	require.NoError(fixtures.Init())
+	defer fixtures.Clean()
+
+	fs := memfs.New()
+	lib, err := siva.NewLibrary("test", fs, &siva.LibraryOptions{
+		RootedRepo:    true,
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	loc, err := lib.AddLocation("loc")
+	require.NoError(err)
+	r, err := loc.Init("github.com/foo/bar")
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	testFetch(t, lib, "github.com/foo/bar", "refs/heads/")
+
+	// HEAD of the remote is also fetched
+	r, err = lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	ref, err := r.R().Reference(plumbing.HEAD, false)
+	require.NoError(err)
+	require.Equal(master, ref.Hash())
+	require.NoError(r.Close())
+
+	// references are stored in the remote of the repository
+	lib, err = siva.NewLibrary("test", fs, nil)
+	require.NoError(err)
+
+	r, err = lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	ref, err = r.R().Reference(
+		"refs/remotes/github.com/foo/bar/heads/master", false)
+	require.NoError(err)
+	require.Equal(master, ref.Hash())
+}
+
+func TestFetch_SivaNotRooted(t *testing.T) {
+	require := require.New(t)
+	require.NoError(fixtures.Init())
+	defer fixtures.Clean()
+
+	lib, err := siva.NewLibrary("test", memfs.New(), &siva.LibraryOptions{
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	loc, err := lib.AddLocation("loc")
+	require.NoError(err)
+	r, err := loc.Init("github.com/foo/bar")
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	// the refspecs of the remote are used
+	prefix := plumbing.ReferenceName("refs/remotes/github.com/foo/bar/")
+	testFetch(t, lib, "github.com/foo/bar", prefix+"heads/")
+
+	r, err = lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	ref, err := r.R().Reference(prefix+"HEAD", false)
+	require.NoError(err)
+	require.Equal(master, ref.Hash())
+
+	_, err = r.R().Reference("refs/remotes/origin/master", false)
+	require.Equal(plumbing.ErrReferenceNotFound, err)
+}
+
+func TestFetch_Plain(t *testing.T) {
+	require := require.New(t)
+	require.NoError(fixtures.Init())
+	defer fixtures.Clean()
+
+	loc, err := plain.NewLocation("loc", memfs.New(), &plain.LocationOptions{
+		Bare:          true,
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	lib := plain.NewLibrary("test", nil)
+	lib.AddLocation(loc)
+
+	r, err := loc.Init("github.com/foo/bar")
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	testFetch(t, lib, "github.com/foo/bar", "refs/remotes/origin/")
+
+	// HEAD and the local branches are not modified
+	r, err = lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	ref, err := r.R().Reference(plumbing.HEAD, false)
+	require.NoError(err)
+	require.Equal(plumbing.SymbolicReference, ref.Type())
+	require.Equal(plumbing.Master, ref.Target())
+
+	_, err = r.R().Reference(plumbing.Master, false)
+	require.Equal(plumbing.ErrReferenceNotFound, err)
+}
+
+func testFetch(
+	t *testing.T,
+	lib borges.Library,
+	id borges.RepositoryID,
+	prefix plumbing.ReferenceName,
+) {
+	t.Helper()
+	require := require.New(t)
+
+	url := "file://" + fixtures.Basic().One().DotGit().Root()
+
+	// failed fetches are discarded
+	_, err := borges.Fetch(lib, id, &borges.FetchOptions{
+		URL: url,
+		RefSpecs: []config.RefSpec{
+			"+refs/heads/master:refs/heads/master",
+			"+refs/heads/missing:refs/heads/missing",
+		},
+	})
+	require.Error(err)
+
+	r, err := lib.Get(id, borges.ReadOnlyMode)
+	require.NoError(err)
+	_, err = r.R().Reference("refs/heads/master", false)
+	require.Equal(plumbing.ErrReferenceNotFound, err)
+	require.NoError(r.Close())
+
+	changes, err := borges.Fetch(lib, id, &borges.FetchOptions{URL: url})
+	require.NoError(err)
+
+	refs := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for _, c := range changes {
+		require.True(c.Old.IsZero())
+		refs[c.Name] = c.New
+	}
+
+	require.Equal(master, refs[prefix+"master"])
+	require.Equal(branch, refs[prefix+"branch"])
+
+	r, err = lib.Get(id, borges.ReadOnlyMode)
+	require.NoError(err)
+	ref, err := r.R().Reference(prefix+"branch", false)
+	require.NoError(err)
+	require.Equal(branch, ref.Hash())
+
+	_, err = r.R().CommitObject(master)
+	require.NoError(err)
+	require.NoError(r.Close())
+
+	// nothing is committed when it's up to date
+	changes, err = borges.Fetch(lib, id, &borges.FetchOptions{URL: url})
+	require.NoError(err)
+	require.Empty(changes)
+
+	r, err = lib.Get(id, borges.RWMode)
+	require.NoError(err)
+	require.NoError(r.Close())
+}
@@ -20,5 +20,6 @@ require (
 	gopkg.in/src-d/go-errors.v1 v1.0.0
 	gopkg.in/src-d/go-git-fixtures.v3 v3.5.0
 	gopkg.in/src-d/go-git.v4 v4.11.0
+	gopkg.in/src-d/go-siva.v1 v1.7.0
 	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
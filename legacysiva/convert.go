@@ -0,0 +1,76 @@
+package legacysiva
+
+import (
+	"context"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+)
+
+// Convert copies all the repositories of a legacy siva library into a siva
+// library, like a bucketed and transactional one, so the old format can be
+// retired. Each siva file is written to a location with the same ID and
+// each of its remotes is imported with siva.Import as a rooted repository
+// named after the remote URL. The references are renamed from the legacy
+// refs/<name>/<remote> to refs/remotes/<id>/<name>.
+//
+// Remotes already present in the destination are skipped so a conversion
+// can be resumed.
+func Convert(ctx context.Context, src *Library, dst *siva.Library) error {
+	locs, err := src.locations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, loc := range locs {
+		if err := convertLocation(ctx, loc.(*Location), dst); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func convertLocation(ctx context.Context, l *Location, dst *siva.Library) error {
+	remotes, err := l.remotes()
+	if err != nil {
+		return err
+	}
+
+	if len(remotes) == 0 {
+		return nil
+	}
+
+	loc, err := dst.AddLocation(l.id)
+	if siva.ErrLocationExists.Is(err) {
+		loc, err = dst.Location(l.id)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, rc := range remotes {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		r, err := newRemoteRepository(l, rc)
+		if err != nil {
+			return err
+		}
+
+		err = siva.Import(r, loc.(*siva.Location))
+		r.Close()
+		if borges.ErrRepositoryExists.Is(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
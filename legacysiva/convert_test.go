@@ -0,0 +1,93 @@
+package legacysiva
+
+import (
+	"context"
+	"testing"
+
+	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestConvert(t *testing.T) {
+	require := require.New(t)
+
+	src := setupLibrary(t, "legacy", &LibraryOptions{})
+
+	fs := memfs.New()
+	dst, err := siva.NewLibrary("converted", fs, &siva.LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+		RootedRepo:    true,
+	})
+	require.NoError(err)
+
+	err = Convert(context.Background(), src, dst)
+	require.NoError(err)
+
+	// converting again skips the existing repositories
+	err = Convert(context.Background(), src, dst)
+	require.NoError(err)
+
+	_, err = fs.Stat("library.yaml")
+	require.NoError(err)
+
+	_, err = fs.Stat("39/3974996807a9f596cf25ac3a714995c24bb97e2c.siva")
+	require.NoError(err)
+
+	var ids []borges.RepositoryID
+	repos, err := dst.Repositories(borges.ReadOnlyMode)
+	require.NoError(err)
+	err = repos.ForEach(func(r borges.Repository) error {
+		ids = append(ids, r.ID())
+		return r.Close()
+	})
+	require.NoError(err)
+	require.ElementsMatch([]borges.RepositoryID{
+		"github.com/rtyley/small-test-repo",
+		"github.com/kuldeep992/small-test-repo",
+		"github.com/kuldeep-singh-blueoptima/small-test-repo",
+		"github.com/jtoy/awesome-tensorflow",
+		"github.com/SiweiLuo/awesome-tensorflow",
+		"github.com/youtang1993/awesome-tensorflow",
+	}, ids)
+
+	r, err := dst.Get("github.com/rtyley/small-test-repo", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+	require.Equal(
+		borges.LocationID("3974996807a9f596cf25ac3a714995c24bb97e2c"),
+		r.Location().ID(),
+	)
+
+	expected := map[plumbing.ReferenceName]string{
+		"HEAD":              "ce1e0703402e989bedf03d5df535401340f54b42",
+		"refs/heads/master": "ce1e0703402e989bedf03d5df535401340f54b42",
+		"refs/pull/1/head":  "e5766c3a37b055320106dae013011686e7e0d94e",
+		"refs/pull/1/merge": "21cd3bb5a53c37f0dba377f46acfa1de87260746",
+	}
+
+	for name, hash := range expected {
+		ref, err := r.R().Reference(name, false)
+		require.NoError(err, name.String())
+		require.Equal(hash, ref.Hash().String(), name.String())
+	}
+
+	refs, err := r.R().References()
+	require.NoError(err)
+	var count int
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		count++
+		return nil
+	})
+	require.NoError(err)
+	require.Equal(len(expected)-1, count)
+
+	report, err := borges.Verify(context.Background(), dst,
+		&borges.VerifyOptions{Objects: true})
+	require.NoError(err)
+	require.True(report.OK())
+}
@@ -7,5 +7,25 @@ no filtering or conversion is done to its references or objects.
 It's meant to be used with siva files generated by borges. It's also a
 read only implementation and does not support transactionality.
 
+With the RootedRepo option each remote of the siva files is also available as
+a repository with the ID built from its URL, like in siva libraries. These
+only show the references of the remote, stored by borges as
+refs/heads/master/<remote>, without the remote suffix and with the HEAD of the
+remote as HEAD. Repositories and Location.Repositories return one repository
+for each remote.
+
+Convert writes the contents of a library to a siva library so the old format
+can be retired. Each remote of the siva files is stored as a rooted
+repository, with the ID built from its URL and the references borges stored
+as refs/heads/master/<remote> renamed to refs/remotes/<id>/heads/master.
+
+The files are found using the Bucket option or, when it's set, the PathLayout
+option with any of the layouts implemented in the siva package.
+
+Importing this package registers the "legacysiva" scheme for borges.Open
+with the options id, bucket, rooted, timeout and registry_cache:
+
+	legacysiva:///data/lib?bucket=2&rooted=true
+
 */
 package legacysiva
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/src-d/go-borges/siva"
 	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/memfs"
 	"gopkg.in/src-d/go-billy.v4/util"
@@ -84,14 +85,18 @@ func setupLibrary(
 	t.Helper()
 	var require = require.New(t)
 
-	fs, _ := setupMemFS(t, opts.Bucket)
+	layout := (&Library{opts: opts}).layout()
+	fs, _ := setupMemFS(t, layout)
 	lib, err := NewLibrary(id, fs, opts)
 	require.NoError(err)
 
 	return lib
 }
 
-func setupMemFS(t *testing.T, bucket int) (billy.Filesystem, []string) {
+func setupMemFS(
+	t *testing.T,
+	layout siva.PathLayout,
+) (billy.Filesystem, []string) {
 	t.Helper()
 	require := require.New(t)
 
@@ -117,8 +122,7 @@ func setupMemFS(t *testing.T, bucket int) (billy.Filesystem, []string) {
 		require.NoError(err)
 
 		id := toLocID(testSiva)
-		siva := buildSivaPath(id, bucket)
-		err = util.WriteFile(fs, siva, data, 0666)
+		err = util.WriteFile(fs, layout.Path(id), data, 0666)
 		require.NoError(err)
 	}
 
@@ -2,13 +2,12 @@ package legacysiva
 
 import (
 	"context"
-	"fmt"
 	"io"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
 	"github.com/src-d/go-borges/util"
 	"gopkg.in/src-d/go-billy.v4"
 	butil "gopkg.in/src-d/go-billy.v4/util"
@@ -24,6 +23,10 @@ type LibraryOptions struct {
 	RegistryCache int
 	// Bucket level to use to search and create siva files.
 	Bucket int
+	// PathLayout decides where the siva files are stored. When it's set
+	// Bucket is ignored. By default siva.BucketLayout with Bucket level is
+	// used.
+	PathLayout siva.PathLayout
 	// Cache specifies the shared cache used in repositories. If not defined
 	// a new default cache will be created for each repository.
 	Cache cache.Object
@@ -31,6 +34,10 @@ type LibraryOptions struct {
 	// potentially take long so timing out them will make an error be
 	// returned. A 0 value sets a default value of 20 seconds.
 	Timeout time.Duration
+	// RootedRepo makes each remote of the siva files a repository with the
+	// ID built from its URL, that only shows its own references. When it's
+	// false each siva file is a single repository with the location ID.
+	RootedRepo bool
 }
 
 // Library represents a borges.Library implementation based on siva files
@@ -45,7 +52,7 @@ type Library struct {
 	opts  *LibraryOptions
 }
 
-var _ borges.Library = (*Library)(nil)
+var _ borges.ContextLibrary = (*Library)(nil)
 
 const (
 	registryCacheSize = 10000
@@ -96,13 +103,34 @@ func (l *Library) Init(id borges.RepositoryID) (borges.Repository, error) {
 	return nil, borges.ErrNotImplemented.New()
 }
 
+// InitContext implements the borges.ContextLibrary interface.
+func (l *Library) InitContext(
+	_ context.Context,
+	_ borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
 // Get implements the borges.Library interface. It only retrieves repositories
 // in borges.ReadOnlyMode ignoring the given parameter.
 func (l *Library) Get(
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.GetContext(ctx, id, mode)
+}
+
+// GetContext implements the borges.ContextLibrary interface. It only
+// retrieves repositories in borges.ReadOnlyMode ignoring the given parameter.
+func (l *Library) GetContext(
+	ctx context.Context,
 	id borges.RepositoryID,
 	_ borges.Mode,
 ) (borges.Repository, error) {
-	ok, _, locID, err := l.Has(id)
+	ok, _, locID, err := l.HasContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -111,12 +139,12 @@ func (l *Library) Get(
 		return nil, borges.ErrRepositoryNotExists.New(id)
 	}
 
-	loc, err := l.Location(locID)
+	loc, err := l.location(locID)
 	if err != nil {
 		return nil, err
 	}
 
-	return loc.Get(id, borges.ReadOnlyMode)
+	return loc.GetContext(ctx, id, borges.ReadOnlyMode)
 }
 
 // GetOrInit implements the borges.Library interface.
@@ -124,6 +152,14 @@ func (l *Library) GetOrInit(_ borges.RepositoryID) (borges.Repository, error) {
 	return nil, borges.ErrNotImplemented.New()
 }
 
+// GetOrInitContext implements the borges.ContextLibrary interface.
+func (l *Library) GetOrInitContext(
+	_ context.Context,
+	_ borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
 // Has implements the borges.Library interface.
 func (l *Library) Has(
 	id borges.RepositoryID,
@@ -131,6 +167,14 @@ func (l *Library) Has(
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.HasContext(ctx, id)
+}
+
+// HasContext implements the borges.ContextLibrary interface.
+func (l *Library) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
 	locs, err := l.locations(ctx)
 	if err != nil {
 		return false, "", "", err
@@ -140,7 +184,7 @@ func (l *Library) Has(
 	defer it.Close()
 
 	for {
-		loc, err := it.Next()
+		location, err := it.Next()
 		if err == io.EOF {
 			return false, "", "", nil
 		}
@@ -149,7 +193,9 @@ func (l *Library) Has(
 			return false, "", "", err
 		}
 
-		has, err := loc.Has(id)
+		loc, _ := location.(*Location)
+
+		has, err := loc.HasContext(ctx, id)
 		if err != nil {
 			return false, "", "", err
 		}
@@ -163,11 +209,20 @@ func (l *Library) Has(
 // Repositories implements the borges.Library interface. It only retrieves
 // repositories in borges.ReadOnlyMode ignoring the given parameter.
 func (l *Library) Repositories(
-	_ borges.Mode,
+	mode borges.Mode,
 ) (borges.RepositoryIterator, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.RepositoriesContext(ctx, mode)
+}
+
+// RepositoriesContext implements the borges.ContextLibrary interface. It only
+// retrieves repositories in borges.ReadOnlyMode ignoring the given parameter.
+func (l *Library) RepositoriesContext(
+	ctx context.Context,
+	_ borges.Mode,
+) (borges.RepositoryIterator, error) {
 	locs, err := l.locations(ctx)
 	if err != nil {
 		return nil, err
@@ -181,15 +236,34 @@ func (l *Library) Repositories(
 
 // Location implements the borges.Library interface.
 func (l *Library) Location(id borges.LocationID) (borges.Location, error) {
-	return l.location(id)
+	return l.LocationContext(context.Background(), id)
 }
 
-func (l *Library) location(id borges.LocationID) (borges.Location, error) {
+// LocationContext implements the borges.ContextLibrary interface.
+func (l *Library) LocationContext(
+	ctx context.Context,
+	id borges.LocationID,
+) (borges.Location, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	loc, err := l.location(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return loc, nil
+}
+
+func (l *Library) location(id borges.LocationID) (*Location, error) {
 	if loc, ok := l.cache.Get(id); ok {
 		return loc.(*Location), nil
 	}
 
-	path := buildSivaPath(id, l.opts.Bucket)
+	path := l.layout().Path(id)
 	loc, err := newLocation(id, l, path)
 	if err != nil {
 		return nil, err
@@ -199,21 +273,13 @@ func (l *Library) location(id borges.LocationID) (borges.Location, error) {
 	return loc, nil
 }
 
-func buildSivaPath(id borges.LocationID, bucket int) string {
-	siva := fmt.Sprintf("%s.siva", id)
-	if bucket == 0 {
-		return siva
-	}
-
-	r := []rune(id)
-	var bucketDir string
-	if len(r) < bucket {
-		bucketDir = string(id) + strings.Repeat("-", bucket-len(r))
-	} else {
-		bucketDir = string(r[:bucket])
+// layout returns the siva.PathLayout of the library siva files.
+func (l *Library) layout() siva.PathLayout {
+	if l.opts.PathLayout != nil {
+		return l.opts.PathLayout
 	}
 
-	return filepath.Join(bucketDir, siva)
+	return siva.BucketLayout(l.opts.Bucket)
 }
 
 // Locations implements the borges.Library interface.
@@ -221,6 +287,13 @@ func (l *Library) Locations() (borges.LocationIterator, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.LocationsContext(ctx)
+}
+
+// LocationsContext implements the borges.ContextLibrary interface.
+func (l *Library) LocationsContext(
+	ctx context.Context,
+) (borges.LocationIterator, error) {
 	locs, err := l.locations(ctx)
 	if err != nil {
 		return nil, err
@@ -232,14 +305,14 @@ func (l *Library) Locations() (borges.LocationIterator, error) {
 func (l *Library) locations(ctx context.Context) ([]borges.Location, error) {
 	var locs []borges.Location
 
-	pattern := filepath.Join(strings.Repeat("?", l.opts.Bucket), "*.siva")
+	layout := l.layout()
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
 
-	sivas, err := butil.Glob(l.fs, pattern)
+	sivas, err := butil.Glob(l.fs, layout.Pattern())
 	if err != nil {
 		return nil, err
 	}
@@ -251,8 +324,12 @@ func (l *Library) locations(ctx context.Context) ([]borges.Location, error) {
 		default:
 		}
 
-		siva := filepath.Base(s)
-		loc, err := l.Location(toLocID(siva))
+		id, ok := layout.ID(s)
+		if !ok {
+			continue
+		}
+
+		loc, err := l.location(id)
 		if err != nil {
 			continue
 		}
@@ -8,6 +8,8 @@ import (
 
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 
 	"github.com/stretchr/testify/require"
@@ -142,3 +144,171 @@ func TestTimeout(t *testing.T) {
 	_, _, _, err = lib.Has("baz")
 	req.EqualError(err, context.DeadlineExceeded.Error())
 }
+
+func TestContextCanceled(t *testing.T) {
+	var req = require.New(t)
+
+	lib := setupLibrary(t, "test", &LibraryOptions{Bucket: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	id := "3974996807a9f596cf25ac3a714995c24bb97e2c"
+
+	_, err := lib.LocationsContext(ctx)
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = lib.RepositoriesContext(ctx, borges.ReadOnlyMode)
+	req.EqualError(err, context.Canceled.Error())
+
+	_, _, _, err = lib.HasContext(ctx, borges.RepositoryID(id))
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = lib.GetContext(ctx, borges.RepositoryID(id), borges.ReadOnlyMode)
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = lib.LocationContext(ctx, borges.LocationID(id))
+	req.EqualError(err, context.Canceled.Error())
+
+	r, err := lib.GetContext(
+		context.Background(),
+		borges.RepositoryID(id),
+		borges.ReadOnlyMode,
+	)
+	req.NoError(err)
+	req.NoError(r.Close())
+}
+
+func TestLibrary_RootedRepo(t *testing.T) {
+	var req = require.New(t)
+
+	lib := setupLibrary(t, "test", &LibraryOptions{
+		Bucket:     2,
+		RootedRepo: true,
+	})
+
+	repoIter, err := lib.Repositories(borges.ReadOnlyMode)
+	req.NoError(err)
+
+	var ids []borges.RepositoryID
+	req.NoError(repoIter.ForEach(func(r borges.Repository) error {
+		ids = append(ids, r.ID())
+		return r.Close()
+	}))
+	req.ElementsMatch([]borges.RepositoryID{
+		"github.com/rtyley/small-test-repo",
+		"github.com/kuldeep992/small-test-repo",
+		"github.com/kuldeep-singh-blueoptima/small-test-repo",
+		"github.com/jtoy/awesome-tensorflow",
+		"github.com/SiweiLuo/awesome-tensorflow",
+		"github.com/youtang1993/awesome-tensorflow",
+	}, ids)
+
+	locID := borges.LocationID("3974996807a9f596cf25ac3a714995c24bb97e2c")
+	for _, id := range []borges.RepositoryID{
+		"github.com/rtyley/small-test-repo",
+		"https://github.com/rtyley/small-test-repo.git",
+		"016b92d2-5b60-cbf8-a7d8-f0e0c6832d91",
+	} {
+		ok, _, l, err := lib.Has(id)
+		req.NoError(err)
+		req.True(ok, id)
+		req.Equal(locID, l)
+	}
+
+	ok, _, _, err := lib.Has("github.com/foo/bar")
+	req.NoError(err)
+	req.False(ok)
+
+	_, err = lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	req.True(borges.ErrRepositoryNotExists.Is(err))
+
+	r, err := lib.Get("github.com/rtyley/small-test-repo", borges.ReadOnlyMode)
+	req.NoError(err)
+	req.Equal(borges.RepositoryID("github.com/rtyley/small-test-repo"), r.ID())
+	req.Equal(locID, r.Location().ID())
+
+	head, err := r.R().Head()
+	req.NoError(err)
+	req.Equal("ce1e0703402e989bedf03d5df535401340f54b42", head.Hash().String())
+
+	refs, err := r.R().References()
+	req.NoError(err)
+	var names []string
+	req.NoError(refs.ForEach(func(ref *plumbing.Reference) error {
+		names = append(names, ref.Name().String())
+		return nil
+	}))
+	req.ElementsMatch([]string{
+		"refs/heads/master",
+		"refs/pull/1/head",
+		"refs/pull/1/merge",
+	}, names)
+
+	cfg, err := r.R().Config()
+	req.NoError(err)
+	req.Len(cfg.Remotes, 1)
+	req.NoError(r.Close())
+
+	// only the objects of the remote are returned
+	commits := map[borges.RepositoryID]int{
+		"github.com/rtyley/small-test-repo":     13,
+		"github.com/kuldeep992/small-test-repo": 2,
+	}
+
+	for id, expected := range commits {
+		r, err := lib.Get(id, borges.ReadOnlyMode)
+		req.NoError(err)
+
+		commitIter, err := r.R().CommitObjects()
+		req.NoError(err)
+
+		var count int
+		req.NoError(commitIter.ForEach(func(c *object.Commit) error {
+			count++
+			return nil
+		}))
+		req.Equal(expected, count, id)
+		req.NoError(r.Close())
+	}
+
+	// the whole siva file is still available with the location ID
+	r, err = lib.Get(borges.RepositoryID(locID), borges.ReadOnlyMode)
+	req.NoError(err)
+	cfg, err = r.R().Config()
+	req.NoError(err)
+	req.Len(cfg.Remotes, 3)
+	req.NoError(r.Close())
+}
+
+func TestLibrary_PathLayout(t *testing.T) {
+	require := require.New(t)
+
+	layout := siva.ShardLayout{Levels: 2, Width: 2}
+	lib := setupLibrary(t, "test", &LibraryOptions{
+		PathLayout: layout,
+	})
+
+	_, err := lib.fs.Stat(
+		"39/74/3974996807a9f596cf25ac3a714995c24bb97e2c.siva")
+	require.NoError(err)
+
+	var ids []borges.LocationID
+	locs, err := lib.Locations()
+	require.NoError(err)
+	require.NoError(locs.ForEach(func(l borges.Location) error {
+		ids = append(ids, l.ID())
+		return nil
+	}))
+	require.ElementsMatch([]borges.LocationID{
+		"3974996807a9f596cf25ac3a714995c24bb97e2c",
+		"f2cee90acf3c6644d51a37057845b98ab1580932",
+	}, ids)
+
+	r, err := lib.Get("f2cee90acf3c6644d51a37057845b98ab1580932",
+		borges.ReadOnlyMode)
+	require.NoError(err)
+	_, err = r.R().References()
+	require.NoError(err)
+	require.NoError(r.Close())
+}
@@ -1,8 +1,10 @@
 package legacysiva
 
 import (
+	"context"
 	"io"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -34,7 +36,7 @@ type Location struct {
 	m sync.RWMutex
 }
 
-var _ borges.Location = (*Location)(nil)
+var _ borges.ContextLocation = (*Location)(nil)
 
 func newLocation(
 	id borges.LocationID,
@@ -70,21 +72,58 @@ func (l *Location) Init(_ borges.RepositoryID) (borges.Repository, error) {
 	return nil, borges.ErrNotImplemented.New()
 }
 
+// InitContext implements the borges.ContextLocation interface.
+func (l *Location) InitContext(
+	_ context.Context,
+	_ borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
 // Get implements the borges.Location interface. It only retrieves repositories
 // in borges.ReadOnlyMode ignoring the given parameter.
 func (l *Location) Get(
-	id borges.RepositoryID, _ borges.Mode,
+	id borges.RepositoryID, mode borges.Mode,
 ) (borges.Repository, error) {
-	if id != "" && string(id) != string(l.id) {
+	return l.GetContext(context.Background(), id, mode)
+}
+
+// GetContext implements the borges.ContextLocation interface. It only
+// retrieves repositories in borges.ReadOnlyMode ignoring the given parameter.
+func (l *Location) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	_ borges.Mode,
+) (borges.Repository, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	if id == "" || string(id) == string(l.id) {
+		err := l.checkAndUpdate()
+		if err != nil {
+			return nil, err
+		}
+
+		return newRepository(l)
+	}
+
+	if !l.lib.opts.RootedRepo {
 		return nil, borges.ErrRepositoryNotExists.New(id)
 	}
 
-	err := l.checkAndUpdate()
+	rc, err := l.remote(id)
 	if err != nil {
 		return nil, err
 	}
 
-	return newRepository(l)
+	if rc == nil {
+		return nil, borges.ErrRepositoryNotExists.New(id)
+	}
+
+	return newRemoteRepository(l, rc)
 }
 
 func (l *Location) cache() cache.Object {
@@ -111,25 +150,143 @@ func (l *Location) GetOrInit(_ borges.RepositoryID) (borges.Repository, error) {
 	return nil, borges.ErrNotImplemented.New()
 }
 
+// GetOrInitContext implements the borges.ContextLocation interface.
+func (l *Location) GetOrInitContext(
+	_ context.Context,
+	_ borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
 // Has implements the borges.Location interface.
 func (l *Location) Has(id borges.RepositoryID) (bool, error) {
-	return string(id) == string(l.id), nil
+	return l.HasContext(context.Background(), id)
+}
+
+// HasContext implements the borges.ContextLocation interface.
+func (l *Location) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+	}
+
+	if string(id) == string(l.id) {
+		return true, nil
+	}
+
+	if !l.lib.opts.RootedRepo {
+		return false, nil
+	}
+
+	rc, err := l.remote(id)
+	if err != nil {
+		return false, err
+	}
+
+	return rc != nil, nil
+}
+
+// remote returns the remote of the location with the given RepositoryID
+// or nil if it's not found. Remotes are matched by their ID, built from the
+// URL, or their name.
+func (l *Location) remote(id borges.RepositoryID) (*config.RemoteConfig, error) {
+	remotes, err := l.remotes()
+	if err != nil {
+		return nil, err
+	}
+
+	name := borges.NormalizeRepositoryID(id.String())
+	for _, rc := range remotes {
+		if remoteID(rc) == name || rc.Name == id.String() {
+			return rc, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// remotes returns the remotes of the location sorted by name.
+func (l *Location) remotes() ([]*config.RemoteConfig, error) {
+	if err := l.checkAndUpdate(); err != nil {
+		return nil, err
+	}
+
+	l.m.RLock()
+	defer l.m.RUnlock()
+
+	var remotes []*config.RemoteConfig
+	if l.config != nil {
+		for _, rc := range l.config.Remotes {
+			remotes = append(remotes, rc)
+		}
+	}
+
+	sort.Slice(remotes, func(i, j int) bool {
+		return remotes[i].Name < remotes[j].Name
+	})
+
+	return remotes, nil
 }
 
 // Repositories implements the borges.Location interface. It only retrieves
 // repositories in borges.ReadOnlyMode ignoring the given parameter.
 func (l *Location) Repositories(
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	return l.RepositoriesContext(context.Background(), mode)
+}
+
+// RepositoriesContext implements the borges.ContextLocation interface. It
+// only retrieves repositories in borges.ReadOnlyMode ignoring the given
+// parameter.
+func (l *Location) RepositoriesContext(
+	ctx context.Context,
 	_ borges.Mode,
 ) (borges.RepositoryIterator, error) {
-	return &repoIter{loc: l}, nil
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	if !l.lib.opts.RootedRepo {
+		return &repoIter{loc: l}, nil
+	}
+
+	remotes, err := l.remotes()
+	if err != nil {
+		return nil, err
+	}
+
+	return &repoIter{loc: l, rooted: true, remotes: remotes}, nil
 }
 
+// repoIter iterates the repositories of a location. When rooted it returns
+// a repository for each remote, otherwise only the one for the whole siva
+// file.
 type repoIter struct {
 	loc      *Location
 	consumed bool
+	rooted   bool
+	remotes  []*config.RemoteConfig
+	pos      int
 }
 
 func (i *repoIter) Next() (borges.Repository, error) {
+	if i.rooted {
+		if i.pos >= len(i.remotes) {
+			return nil, io.EOF
+		}
+
+		rc := i.remotes[i.pos]
+		i.pos++
+		return newRemoteRepository(i.loc, rc)
+	}
+
 	if i.consumed {
 		return nil, io.EOF
 	}
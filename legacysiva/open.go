@@ -0,0 +1,42 @@
+package legacysiva
+
+import (
+	"net/url"
+
+	borges "github.com/src-d/go-borges"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+func init() {
+	borges.Register("legacysiva", open)
+}
+
+// open is the borges.Opener of the "legacysiva" scheme described in the package
+// documentation.
+func open(u *url.URL) (borges.Library, error) {
+	path, err := borges.URLPath(u)
+	if err != nil {
+		return nil, err
+	}
+
+	o := borges.NewURLOptions(u)
+	id := o.String("id", "")
+	opts := &LibraryOptions{
+		Bucket:        o.Int("bucket", 0),
+		RootedRepo:    o.Bool("rooted", false),
+		Timeout:       o.Duration("timeout", 0),
+		RegistryCache: o.Int("registry_cache", 0),
+	}
+
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+
+	lib, err := NewLibrary(id, osfs.New(path), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return lib, nil
+}
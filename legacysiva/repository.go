@@ -6,6 +6,8 @@ import (
 	sivafs "gopkg.in/src-d/go-billy-siva.v4"
 	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/storage"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 )
 
@@ -27,6 +29,23 @@ var _ borges.Repository = (*Repository)(nil)
 
 func newRepository(
 	location *Location,
+) (*Repository, error) {
+	return openRepository(location, borges.RepositoryID(location.ID()), "")
+}
+
+// newRemoteRepository opens a repository that only shows the references of
+// one of the remotes of the location.
+func newRemoteRepository(
+	location *Location,
+	rc *config.RemoteConfig,
+) (*Repository, error) {
+	return openRepository(location, remoteID(rc), rc.Name)
+}
+
+func openRepository(
+	location *Location,
+	id borges.RepositoryID,
+	remote string,
 ) (*Repository, error) {
 	fs, err := location.fs()
 	if err != nil {
@@ -52,13 +71,18 @@ func newRepository(
 		return nil, err
 	}
 
-	repo, err := git.Open(roSto, nil)
+	var gitSto storage.Storer = roSto
+	if remote != "" {
+		gitSto = newRemoteStorage(roSto, remote)
+	}
+
+	repo, err := git.Open(gitSto, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Repository{
-		id:   borges.RepositoryID(location.ID()),
+		id:   id,
 		loc:  location,
 		repo: repo,
 		sto:  roSto,
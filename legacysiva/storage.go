@@ -0,0 +1,232 @@
+package legacysiva
+
+import (
+	"io"
+	"strings"
+
+	"github.com/src-d/go-borges"
+
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/storage"
+)
+
+// legacyHEAD is the reference name used by borges to store the HEAD of
+// each remote.
+const legacyHEAD = "refs/heads/HEAD"
+
+// remoteStorage is a storage.Storer that only shows the references of one
+// of the remotes of a legacy siva file. These are stored by borges with the
+// remote name as suffix, like refs/heads/master/<remote>, and are shown
+// without it. The HEAD of the remote, refs/heads/HEAD/<remote>, is shown
+// as HEAD.
+type remoteStorage struct {
+	storage.Storer
+	remote string
+}
+
+var _ storage.Storer = (*remoteStorage)(nil)
+
+func newRemoteStorage(sto storage.Storer, remote string) *remoteStorage {
+	return &remoteStorage{
+		Storer: sto,
+		remote: remote,
+	}
+}
+
+func (s *remoteStorage) suffix() string {
+	return "/" + s.remote
+}
+
+func (s *remoteStorage) toLegacy(n plumbing.ReferenceName) plumbing.ReferenceName {
+	if n == plumbing.HEAD {
+		n = legacyHEAD
+	}
+
+	return plumbing.ReferenceName(n.String() + s.suffix())
+}
+
+// fromLegacy converts a reference name of the siva file. It returns false
+// when the reference does not belong to the remote.
+func (s *remoteStorage) fromLegacy(
+	n plumbing.ReferenceName,
+) (plumbing.ReferenceName, bool) {
+	if !strings.HasSuffix(n.String(), s.suffix()) {
+		return "", false
+	}
+
+	name := plumbing.ReferenceName(strings.TrimSuffix(n.String(), s.suffix()))
+	if name == legacyHEAD {
+		name = plumbing.HEAD
+	}
+
+	return name, true
+}
+
+func (s *remoteStorage) convert(ref *plumbing.Reference) *plumbing.Reference {
+	name, ok := s.fromLegacy(ref.Name())
+	if !ok {
+		return nil
+	}
+
+	if ref.Type() == plumbing.SymbolicReference {
+		target, ok := s.fromLegacy(ref.Target())
+		if !ok {
+			target = ref.Target()
+		}
+
+		return plumbing.NewSymbolicReference(name, target)
+	}
+
+	return plumbing.NewHashReference(name, ref.Hash())
+}
+
+// Reference implements ReferenceStorer interface.
+func (s *remoteStorage) Reference(
+	name plumbing.ReferenceName,
+) (*plumbing.Reference, error) {
+	ref, err := s.Storer.Reference(s.toLegacy(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.convert(ref), nil
+}
+
+// IterReferences implements ReferenceStorer interface.
+func (s *remoteStorage) IterReferences() (storer.ReferenceIter, error) {
+	iter, err := s.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if r := s.convert(ref); r != nil && r.Name() != plumbing.HEAD {
+			refs = append(refs, r)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return storer.NewReferenceSliceIter(refs), nil
+}
+
+// IterEncodedObjects implements EncodedObjectStorer interface. Only the
+// objects reachable from the references of the remote are returned.
+func (s *remoteStorage) IterEncodedObjects(
+	t plumbing.ObjectType,
+) (storer.EncodedObjectIter, error) {
+	refs, err := s.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []plumbing.Hash
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			hashes = append(hashes, ref.Hash())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := revlist.Objects(s.Storer, hashes, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &objectIter{
+		sto:    s.Storer,
+		t:      t,
+		hashes: objects,
+	}, nil
+}
+
+// Config implements ConfigStorer interface. Only the remote of the
+// repository is kept in the configuration.
+func (s *remoteStorage) Config() (*config.Config, error) {
+	cfg, err := s.Storer.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	c := *cfg
+	c.Remotes = make(map[string]*config.RemoteConfig)
+	if rc, ok := cfg.Remotes[s.remote]; ok {
+		c.Remotes[s.remote] = rc
+	}
+
+	return &c, nil
+}
+
+// remoteID returns the RepositoryID of a remote of a legacy siva file. It's
+// built from its first URL, the same way as in siva libraries, or its name
+// if it does not have URLs.
+func remoteID(rc *config.RemoteConfig) borges.RepositoryID {
+	if len(rc.URLs) == 0 {
+		return borges.RepositoryID(rc.Name)
+	}
+
+	return borges.NormalizeRepositoryID(rc.URLs[0])
+}
+
+// objectIter returns the objects of the given type from a list of hashes.
+type objectIter struct {
+	sto    storer.EncodedObjectStorer
+	t      plumbing.ObjectType
+	hashes []plumbing.Hash
+	pos    int
+}
+
+func (i *objectIter) Next() (plumbing.EncodedObject, error) {
+	for i.pos < len(i.hashes) {
+		h := i.hashes[i.pos]
+		i.pos++
+
+		obj, err := i.sto.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if i.t == plumbing.AnyObject || obj.Type() == i.t {
+			return obj, nil
+		}
+	}
+
+	return nil, io.EOF
+}
+
+func (i *objectIter) ForEach(f func(plumbing.EncodedObject) error) error {
+	defer i.Close()
+	for {
+		obj, err := i.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := f(obj); err != nil {
+			if err == storer.ErrStop {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+func (i *objectIter) Close() {
+	i.pos = len(i.hashes)
+}
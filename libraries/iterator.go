@@ -1,6 +1,7 @@
 package libraries
 
 import (
+	"context"
 	"io"
 	"sync"
 
@@ -180,6 +181,35 @@ func (i *mergedLibIter) Close() {
 	}
 }
 
+// contextRepoIter stops a borges.RepositoryIterator when its context is done.
+type contextRepoIter struct {
+	ctx  context.Context
+	iter borges.RepositoryIterator
+}
+
+var _ borges.RepositoryIterator = (*contextRepoIter)(nil)
+
+// Next implements the borges.RepositoryIterator interface.
+func (i *contextRepoIter) Next() (borges.Repository, error) {
+	select {
+	case <-i.ctx.Done():
+		return nil, i.ctx.Err()
+	default:
+	}
+
+	return i.iter.Next()
+}
+
+// ForEach implements the borges.RepositoryIterator interface.
+func (i *contextRepoIter) ForEach(cb func(borges.Repository) error) error {
+	return util.ForEachRepositoryIterator(i, cb)
+}
+
+// Close implements the borges.RepositoryIterator interface.
+func (i *contextRepoIter) Close() {
+	i.iter.Close()
+}
+
 // RepositoryDefaultIter returns a borges.RepositoryIterator with no specific
 // iteration order.
 func RepositoryDefaultIter(
@@ -39,7 +39,7 @@ type Libraries struct {
 	opts *Options
 }
 
-var _ borges.Library = (*Libraries)(nil)
+var _ borges.ContextLibrary = (*Libraries)(nil)
 
 const (
 	timeout = 60 * time.Second
@@ -90,11 +90,28 @@ func (l *Libraries) Init(borges.RepositoryID) (borges.Repository, error) {
 	return nil, borges.ErrNotImplemented.New()
 }
 
+// InitContext implements the ContextLibrary interface.
+func (l *Libraries) InitContext(
+	context.Context,
+	borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
 // Get implements the Library interface.
 func (l *Libraries) Get(id borges.RepositoryID, mode borges.Mode) (borges.Repository, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.GetContext(ctx, id, mode)
+}
+
+// GetContext implements the ContextLibrary interface.
+func (l *Libraries) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
 	for _, lib := range l.libs {
 		select {
 		case <-ctx.Done():
@@ -102,7 +119,7 @@ func (l *Libraries) Get(id borges.RepositoryID, mode borges.Mode) (borges.Reposi
 		default:
 		}
 
-		r, err := lib.Get(id, mode)
+		r, err := getContext(ctx, lib, id, mode)
 		if err != nil {
 			if borges.ErrRepositoryNotExists.Is(err) {
 				continue
@@ -122,11 +139,27 @@ func (l *Libraries) GetOrInit(borges.RepositoryID) (borges.Repository, error) {
 	return nil, borges.ErrNotImplemented.New()
 }
 
+// GetOrInitContext implements the ContextLibrary interface.
+func (l *Libraries) GetOrInitContext(
+	context.Context,
+	borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
 // Has implements the Library interface.
 func (l *Libraries) Has(id borges.RepositoryID) (bool, borges.LibraryID, borges.LocationID, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.HasContext(ctx, id)
+}
+
+// HasContext implements the ContextLibrary interface.
+func (l *Libraries) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
 	for _, lib := range l.libs {
 		select {
 		case <-ctx.Done():
@@ -134,7 +167,7 @@ func (l *Libraries) Has(id borges.RepositoryID) (bool, borges.LibraryID, borges.
 		default:
 		}
 
-		has, libID, locID, err := lib.Has(id)
+		has, libID, locID, err := hasContext(ctx, lib, id)
 		if err != nil {
 			return false, "", "", err
 		}
@@ -152,11 +185,40 @@ func (l *Libraries) Repositories(mode borges.Mode) (borges.RepositoryIterator, e
 	return l.opts.RepositoryIterOrder(l, mode)
 }
 
+// RepositoriesContext implements the ContextLibrary interface. The iterator
+// built by Options.RepositoryIterOrder stops with the context error once the
+// context is done.
+func (l *Libraries) RepositoriesContext(
+	ctx context.Context,
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	iter, err := l.opts.RepositoryIterOrder(l, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &contextRepoIter{ctx: ctx, iter: iter}, nil
+}
+
 // Location implements the Library interface.
 func (l *Libraries) Location(id borges.LocationID) (borges.Location, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.LocationContext(ctx, id)
+}
+
+// LocationContext implements the ContextLibrary interface.
+func (l *Libraries) LocationContext(
+	ctx context.Context,
+	id borges.LocationID,
+) (borges.Location, error) {
 	for _, lib := range l.libs {
 		select {
 		case <-ctx.Done():
@@ -164,7 +226,7 @@ func (l *Libraries) Location(id borges.LocationID) (borges.Location, error) {
 		default:
 		}
 
-		loc, err := lib.Location(id)
+		loc, err := locationContext(ctx, lib, id)
 		if err != nil {
 			if borges.ErrLocationNotExists.Is(err) {
 				continue
@@ -184,6 +246,13 @@ func (l *Libraries) Locations() (borges.LocationIterator, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.LocationsContext(ctx)
+}
+
+// LocationsContext implements the ContextLibrary interface.
+func (l *Libraries) LocationsContext(
+	ctx context.Context,
+) (borges.LocationIterator, error) {
 	var locations []borges.LocationIterator
 	for _, lib := range l.libs {
 		select {
@@ -192,7 +261,7 @@ func (l *Libraries) Locations() (borges.LocationIterator, error) {
 		default:
 		}
 
-		locs, err := lib.Locations()
+		locs, err := locationsContext(ctx, lib)
 		if err != nil {
 			return nil, err
 		}
@@ -255,3 +324,59 @@ func (l *Libraries) libraries(filter FilterLibraryFunc) ([]borges.Library, error
 
 	return libs, nil
 }
+
+// getContext calls GetContext if the library implements
+// borges.ContextLibrary, otherwise it falls back to Get.
+func getContext(
+	ctx context.Context,
+	lib borges.Library,
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	if cl, ok := lib.(borges.ContextLibrary); ok {
+		return cl.GetContext(ctx, id, mode)
+	}
+
+	return lib.Get(id, mode)
+}
+
+// hasContext calls HasContext if the library implements
+// borges.ContextLibrary, otherwise it falls back to Has.
+func hasContext(
+	ctx context.Context,
+	lib borges.Library,
+	id borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
+	if cl, ok := lib.(borges.ContextLibrary); ok {
+		return cl.HasContext(ctx, id)
+	}
+
+	return lib.Has(id)
+}
+
+// locationContext calls LocationContext if the library implements
+// borges.ContextLibrary, otherwise it falls back to Location.
+func locationContext(
+	ctx context.Context,
+	lib borges.Library,
+	id borges.LocationID,
+) (borges.Location, error) {
+	if cl, ok := lib.(borges.ContextLibrary); ok {
+		return cl.LocationContext(ctx, id)
+	}
+
+	return lib.Location(id)
+}
+
+// locationsContext calls LocationsContext if the library implements
+// borges.ContextLibrary, otherwise it falls back to Locations.
+func locationsContext(
+	ctx context.Context,
+	lib borges.Library,
+) (borges.LocationIterator, error) {
+	if cl, ok := lib.(borges.ContextLibrary); ok {
+		return cl.LocationsContext(ctx)
+	}
+
+	return lib.Locations()
+}
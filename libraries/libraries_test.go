@@ -1,6 +1,7 @@
 package libraries
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"testing"
@@ -70,6 +71,51 @@ func (s *librariesSuite) TestLibraryAndLocationAndHasAndGet() {
 	}
 }
 
+func (s *librariesSuite) TestContextCanceled() {
+	var require = s.Require()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, _, err := s.libs.HasContext(ctx, "github.com/jtoy/awesome-tensorflow")
+	require.EqualError(err, context.Canceled.Error())
+
+	_, err = s.libs.GetContext(
+		ctx,
+		"github.com/jtoy/awesome-tensorflow",
+		borges.ReadOnlyMode,
+	)
+	require.EqualError(err, context.Canceled.Error())
+
+	_, err = s.libs.LocationContext(
+		ctx,
+		"f2cee90acf3c6644d51a37057845b98ab1580932",
+	)
+	require.EqualError(err, context.Canceled.Error())
+
+	_, err = s.libs.LocationsContext(ctx)
+	require.EqualError(err, context.Canceled.Error())
+
+	_, err = s.libs.RepositoriesContext(ctx, borges.ReadOnlyMode)
+	require.EqualError(err, context.Canceled.Error())
+
+	// the iteration stops when the context is canceled
+	ctx, cancel = context.WithCancel(context.Background())
+	iter, err := s.libs.RepositoriesContext(ctx, borges.ReadOnlyMode)
+	require.NoError(err)
+	defer iter.Close()
+
+	r, err := iter.Next()
+	require.NoError(err)
+	require.NoError(r.Close())
+
+	cancel()
+	err = iter.ForEach(func(r borges.Repository) error {
+		return r.Close()
+	})
+	require.EqualError(err, context.Canceled.Error())
+}
+
 func (s *librariesSuite) TestRepositories() {
 	var require = s.Require()
 
@@ -1,6 +1,7 @@
 package borges
 
 import (
+	"context"
 	"path"
 	"strings"
 
@@ -29,6 +30,16 @@ var (
 	// ErrNonTransactional returned when Repository.Commit is called on a
 	// repository that not support transactions.
 	ErrNonTransactional = errors.NewKind("non transactional repository")
+	// ErrLocationExists when a Location to be created already exists.
+	ErrLocationExists = errors.NewKind("location %s already exists")
+	// ErrTransactionTimeout is returned when a repository can't be retrieved
+	// in transactional mode because another transaction did not finish in
+	// time.
+	ErrTransactionTimeout = errors.NewKind("timeout exceeded: unable to " +
+		"retrieve repository from location %s in transactional mode.")
+	// ErrRepositoryClosed is returned when a repository was already closed
+	// or committed.
+	ErrRepositoryClosed = errors.NewKind("repository %s already closed")
 )
 
 // RepositoryID represents a Repository identifier, these IDs regularly are
@@ -50,6 +61,19 @@ func NewRepositoryID(endpoint string) (RepositoryID, error) {
 	return RepositoryID(path.Join(e.Host, e.Path)), nil
 }
 
+// NormalizeRepositoryID returns the RepositoryID used by the libraries for a
+// given endpoint, the one built by NewRepositoryID without the .git suffix.
+// Eg.: git@github.com:src-d/go-borges.git becomes github.com/src-d/go-borges
+// The endpoint is returned unchanged when it can't be parsed.
+func NormalizeRepositoryID(endpoint string) RepositoryID {
+	id, err := NewRepositoryID(endpoint)
+	if err != nil {
+		return RepositoryID(endpoint)
+	}
+
+	return RepositoryID(strings.TrimSuffix(id.String(), ".git"))
+}
+
 func (id RepositoryID) String() string {
 	return string(id)
 }
@@ -128,6 +152,30 @@ type Library interface {
 	Locations() (LocationIterator, error)
 }
 
+// ContextLibrary is a Library that accepts a context.Context on each of its
+// operations. The context can be used to cancel long running operations, like
+// scanning all the locations, or to propagate deadlines. The methods without
+// context of the Library interface are equivalent to calling these ones with a
+// context bounded by the default timeout of the implementation.
+type ContextLibrary interface {
+	Library
+	// InitContext is the context aware version of Library.Init.
+	InitContext(context.Context, RepositoryID) (Repository, error)
+	// GetContext is the context aware version of Library.Get.
+	GetContext(context.Context, RepositoryID, Mode) (Repository, error)
+	// GetOrInitContext is the context aware version of Library.GetOrInit.
+	GetOrInitContext(context.Context, RepositoryID) (Repository, error)
+	// HasContext is the context aware version of Library.Has.
+	HasContext(context.Context, RepositoryID) (bool, LibraryID, LocationID, error)
+	// RepositoriesContext is the context aware version of
+	// Library.Repositories.
+	RepositoriesContext(context.Context, Mode) (RepositoryIterator, error)
+	// LocationContext is the context aware version of Library.Location.
+	LocationContext(context.Context, LocationID) (Location, error)
+	// LocationsContext is the context aware version of Library.Locations.
+	LocationsContext(context.Context) (LocationIterator, error)
+}
+
 // LocationID represents a Location identifier.
 type LocationID string
 
@@ -156,3 +204,31 @@ type Location interface {
 	// the repositories contained in this Location.
 	Repositories(Mode) (RepositoryIterator, error)
 }
+
+// ContextLocation is a Location that accepts a context.Context on each of its
+// operations. The methods without context of the Location interface are
+// equivalent to calling these ones with a context bounded by the default
+// timeout of the implementation.
+type ContextLocation interface {
+	Location
+	// InitContext is the context aware version of Location.Init.
+	InitContext(context.Context, RepositoryID) (Repository, error)
+	// GetContext is the context aware version of Location.Get.
+	GetContext(context.Context, RepositoryID, Mode) (Repository, error)
+	// GetOrInitContext is the context aware version of Location.GetOrInit.
+	GetOrInitContext(context.Context, RepositoryID) (Repository, error)
+	// HasContext is the context aware version of Location.Has.
+	HasContext(context.Context, RepositoryID) (bool, error)
+	// RepositoriesContext is the context aware version of
+	// Location.Repositories.
+	RepositoriesContext(context.Context, Mode) (RepositoryIterator, error)
+}
+
+// RemoverLocation is a Location that supports deleting repositories.
+type RemoverLocation interface {
+	Location
+	// Remove deletes the repository with the given RepositoryID from this
+	// Location. If the repository can't be found ErrRepositoryNotExists is
+	// returned.
+	Remove(RepositoryID) error
+}
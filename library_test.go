@@ -0,0 +1,19 @@
+package borges
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeRepositoryID(t *testing.T) {
+	for endpoint, id := range map[string]RepositoryID{
+		"github.com/src-d/go-borges":             "github.com/src-d/go-borges",
+		"https://github.com/src-d/go-borges.git": "github.com/src-d/go-borges",
+		"git@github.com:src-d/go-borges.git":     "github.com/src-d/go-borges",
+		"git://github.com/src-d/go-borges":       "github.com/src-d/go-borges",
+		"http://%zz":                             "http://%zz",
+	} {
+		require.Equal(t, id, NormalizeRepositoryID(endpoint), endpoint)
+	}
+}
@@ -0,0 +1,25 @@
+/*
+
+Package memory implements a go-borges library that keeps all its locations
+and repositories in memory using go-git memory storage. Nothing is written to
+disk so it's meant to be used in tests and short lived processes.
+
+Locations are created with Library.AddLocation and hold any number of bare
+repositories. Library.Init and Library.GetOrInit create the new repositories
+in the location chosen by LibraryOptions.LocationSelector, by default a
+location with the same ID as the repository. Repository IDs are normalized
+like in siva libraries, "https://github.com/foo/bar.git" is stored as
+"github.com/foo/bar".
+
+With the Transactional option repositories opened in RWMode work on a private
+copy of the repository. The changes are only visible to other readers after
+Repository.Commit and are discarded by Repository.Close. Like in siva
+libraries only one transaction can be open at the same time for each
+location, others wait for it until TransactionTimeout. Without it the
+changes are written directly to the stored repository and Commit returns
+borges.ErrNonTransactional. In that case the storage is shared without
+locking, a repository must not be written while it's being read or written
+somewhere else.
+
+*/
+package memory
@@ -0,0 +1,346 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/util"
+)
+
+// LibraryOptions hold configuration options for the library.
+type LibraryOptions struct {
+	// Transactional enables transactions for repository writes. Without
+	// it the repositories opened in RWMode write directly to the stored
+	// repository so they must not be used while others are reading or
+	// writing it.
+	Transactional bool
+	// TransactionTimeout is the time it will wait while another transaction
+	// is being done before error. 0 means default.
+	TransactionTimeout time.Duration
+	// Timeout set a timeout for library operations. A 0 value sets a
+	// default value of 20 seconds.
+	Timeout time.Duration
+	// LocationSelector chooses the location used by Init and GetOrInit for
+	// new repositories. The location is created if it does not exist. By
+	// default each repository is created in a location with its same ID.
+	LocationSelector borges.LocationSelector
+}
+
+const (
+	timeout   = 20 * time.Second
+	txTimeout = 60 * time.Second
+)
+
+// Library is a borges.Library implementation that keeps its locations and
+// repositories in memory.
+type Library struct {
+	id   borges.LibraryID
+	opts *LibraryOptions
+
+	m    sync.RWMutex
+	locs map[borges.LocationID]*Location
+}
+
+var _ borges.ContextLibrary = (*Library)(nil)
+
+// NewLibrary returns a new empty Library instance.
+func NewLibrary(id borges.LibraryID, options *LibraryOptions) *Library {
+	var opts LibraryOptions
+	if options != nil {
+		opts = *options
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = timeout
+	}
+
+	if opts.TransactionTimeout == 0 {
+		opts.TransactionTimeout = txTimeout
+	}
+
+	if opts.LocationSelector == nil {
+		opts.LocationSelector = borges.LocationSelectorFunc(sameLocation)
+	}
+
+	return &Library{
+		id:   id,
+		opts: &opts,
+		locs: make(map[borges.LocationID]*Location),
+	}
+}
+
+// sameLocation is the default LocationSelector, it uses the repository ID
+// as location ID.
+func sameLocation(
+	_ context.Context,
+	_ borges.Library,
+	id borges.RepositoryID,
+) (borges.LocationID, error) {
+	return borges.LocationID(id), nil
+}
+
+// ID implements borges.Library interface.
+func (l *Library) ID() borges.LibraryID {
+	return l.id
+}
+
+// AddLocation creates a new empty location. If it already exists
+// borges.ErrLocationExists is returned.
+func (l *Library) AddLocation(id borges.LocationID) (*Location, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if _, ok := l.locs[id]; ok {
+		return nil, borges.ErrLocationExists.New(id)
+	}
+
+	return l.addLocation(id), nil
+}
+
+func (l *Library) addLocation(id borges.LocationID) *Location {
+	loc := newLocation(id, l)
+	l.locs[id] = loc
+	return loc
+}
+
+// Init implements borges.Library interface.
+func (l *Library) Init(id borges.RepositoryID) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.InitContext(ctx, id)
+}
+
+// InitContext implements borges.ContextLibrary interface. The location of the
+// new repository is chosen by LibraryOptions.LocationSelector.
+func (l *Library) InitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	id = borges.NormalizeRepositoryID(id.String())
+
+	has, _, _, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if has {
+		return nil, borges.ErrRepositoryExists.New(id)
+	}
+
+	locID, err := l.opts.LocationSelector.SelectLocation(ctx, l, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if locID == "" {
+		return nil, borges.ErrInvalidLocationID.New(id)
+	}
+
+	l.m.Lock()
+	loc, ok := l.locs[locID]
+	if !ok {
+		loc = l.addLocation(locID)
+	}
+	l.m.Unlock()
+
+	return loc.InitContext(ctx, id)
+}
+
+// Get implements borges.Library interface.
+func (l *Library) Get(
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.GetContext(ctx, id, mode)
+}
+
+// GetContext implements borges.ContextLibrary interface.
+func (l *Library) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ok, _, locID, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, borges.ErrRepositoryNotExists.New(id)
+	}
+
+	loc, err := l.location(locID)
+	if err != nil {
+		return nil, err
+	}
+
+	return loc.GetContext(ctx, id, mode)
+}
+
+// GetOrInit implements borges.Library interface.
+func (l *Library) GetOrInit(id borges.RepositoryID) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.GetOrInitContext(ctx, id)
+}
+
+// GetOrInitContext implements borges.ContextLibrary interface. If the
+// repository does not exist it's initialized as in InitContext.
+func (l *Library) GetOrInitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	has, _, locID, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return l.InitContext(ctx, id)
+	}
+
+	loc, err := l.location(locID)
+	if err != nil {
+		return nil, err
+	}
+
+	return loc.GetContext(ctx, id, borges.RWMode)
+}
+
+// Has implements borges.Library interface.
+func (l *Library) Has(
+	id borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.HasContext(ctx, id)
+}
+
+// HasContext implements borges.ContextLibrary interface.
+func (l *Library) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
+	locs, err := l.locations(ctx)
+	if err != nil {
+		return false, "", "", err
+	}
+
+	for _, loc := range locs {
+		has, err := loc.(*Location).HasContext(ctx, id)
+		if err != nil {
+			return false, "", "", err
+		}
+
+		if has {
+			return true, l.id, loc.ID(), nil
+		}
+	}
+
+	return false, "", "", nil
+}
+
+// Repositories implements borges.Library interface.
+func (l *Library) Repositories(
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.RepositoriesContext(ctx, mode)
+}
+
+// RepositoriesContext implements borges.ContextLibrary interface.
+func (l *Library) RepositoriesContext(
+	ctx context.Context,
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	locs, err := l.locations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.NewLocationRepositoryIterator(locs, mode), nil
+}
+
+// Location implements borges.Library interface.
+func (l *Library) Location(id borges.LocationID) (borges.Location, error) {
+	return l.LocationContext(context.Background(), id)
+}
+
+// LocationContext implements borges.ContextLibrary interface.
+func (l *Library) LocationContext(
+	ctx context.Context,
+	id borges.LocationID,
+) (borges.Location, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	return l.location(id)
+}
+
+func (l *Library) location(id borges.LocationID) (*Location, error) {
+	l.m.RLock()
+	defer l.m.RUnlock()
+
+	loc, ok := l.locs[id]
+	if !ok {
+		return nil, borges.ErrLocationNotExists.New(id)
+	}
+
+	return loc, nil
+}
+
+// Locations implements borges.Library interface.
+func (l *Library) Locations() (borges.LocationIterator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.LocationsContext(ctx)
+}
+
+// LocationsContext implements borges.ContextLibrary interface.
+func (l *Library) LocationsContext(
+	ctx context.Context,
+) (borges.LocationIterator, error) {
+	locs, err := l.locations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.NewLocationIterator(locs), nil
+}
+
+// locations returns the library locations sorted by ID.
+func (l *Library) locations(ctx context.Context) ([]borges.Location, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	l.m.RLock()
+	locs := make([]borges.Location, 0, len(l.locs))
+	for _, loc := range l.locs {
+		locs = append(locs, loc)
+	}
+	l.m.RUnlock()
+
+	sort.Slice(locs, func(i, j int) bool {
+		return locs[i].ID() < locs[j].ID()
+	})
+
+	return locs, nil
+}
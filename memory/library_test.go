@@ -0,0 +1,204 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func TestLibrary(t *testing.T) {
+	require := require.New(t)
+
+	lib := NewLibrary("test", &LibraryOptions{
+		LocationSelector: borges.LocationSelectorFunc(func(
+			context.Context,
+			borges.Library,
+			borges.RepositoryID,
+		) (borges.LocationID, error) {
+			return "loc", nil
+		}),
+	})
+
+	for _, id := range []borges.RepositoryID{
+		"github.com/foo/qux",
+		"github.com/foo/bar",
+	} {
+		r, err := lib.Init(id)
+		require.NoError(err)
+		require.NoError(r.Close())
+	}
+
+	_, err := lib.Init("github.com/foo/bar")
+	require.True(borges.ErrRepositoryExists.Is(err))
+
+	_, err = lib.Init("https://github.com/foo/bar.git")
+	require.True(borges.ErrRepositoryExists.Is(err))
+
+	has, _, _, err := lib.Has("https://github.com/foo/qux.git")
+	require.NoError(err)
+	require.True(has)
+
+	has, libID, locID, err := lib.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.True(has)
+	require.Equal(borges.LibraryID("test"), libID)
+	require.Equal(borges.LocationID("loc"), locID)
+
+	has, _, _, err = lib.Has("github.com/foo/baz")
+	require.NoError(err)
+	require.False(has)
+
+	_, err = lib.Get("github.com/foo/baz", borges.ReadOnlyMode)
+	require.True(borges.ErrRepositoryNotExists.Is(err))
+
+	r, err := lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	require.Equal(borges.LocationID("loc"), r.Location().ID())
+	require.Nil(r.FS())
+
+	remote, err := r.R().Remote("origin")
+	require.NoError(err)
+	require.Equal([]string{"github.com/foo/bar"}, remote.Config().URLs)
+	require.NoError(r.Close())
+
+	r, err = lib.GetOrInit("github.com/foo/baz")
+	require.NoError(err)
+	require.Equal(borges.RWMode, r.Mode())
+	require.NoError(r.Close())
+
+	var ids []borges.RepositoryID
+	repos, err := lib.Repositories(borges.ReadOnlyMode)
+	require.NoError(err)
+	require.NoError(repos.ForEach(func(r borges.Repository) error {
+		ids = append(ids, r.ID())
+		return r.Close()
+	}))
+	require.Equal([]borges.RepositoryID{
+		"github.com/foo/bar",
+		"github.com/foo/baz",
+		"github.com/foo/qux",
+	}, ids)
+
+	_, err = lib.Location("other")
+	require.True(borges.ErrLocationNotExists.Is(err))
+
+	_, err = lib.AddLocation("other")
+	require.NoError(err)
+	_, err = lib.AddLocation("other")
+	require.True(borges.ErrLocationExists.Is(err))
+
+	var locs []borges.LocationID
+	iter, err := lib.Locations()
+	require.NoError(err)
+	require.NoError(iter.ForEach(func(l borges.Location) error {
+		locs = append(locs, l.ID())
+		return nil
+	}))
+	require.Equal([]borges.LocationID{"loc", "other"}, locs)
+}
+
+func TestLibrary_DefaultSelector(t *testing.T) {
+	require := require.New(t)
+
+	lib := NewLibrary("test", nil)
+
+	r, err := lib.GetOrInit("github.com/foo/bar")
+	require.NoError(err)
+	require.Equal(borges.LocationID("github.com/foo/bar"), r.Location().ID())
+	require.True(borges.ErrNonTransactional.Is(r.Commit()))
+	require.NoError(r.Close())
+}
+
+func TestLibrary_InvalidLocationID(t *testing.T) {
+	require := require.New(t)
+
+	lib := NewLibrary("test", &LibraryOptions{
+		LocationSelector: borges.LocationSelectorFunc(func(
+			context.Context,
+			borges.Library,
+			borges.RepositoryID,
+		) (borges.LocationID, error) {
+			return "", nil
+		}),
+	})
+
+	_, err := lib.Init("github.com/foo/bar")
+	require.True(borges.ErrInvalidLocationID.Is(err))
+}
+
+func TestLibrary_TransactionTimeout(t *testing.T) {
+	require := require.New(t)
+
+	lib := NewLibrary("test", &LibraryOptions{
+		Transactional:      true,
+		TransactionTimeout: 50 * time.Millisecond,
+	})
+
+	r, err := lib.Init("github.com/foo/bar")
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	r, err = lib.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+
+	_, err = lib.Get("github.com/foo/bar", borges.RWMode)
+	require.True(borges.ErrTransactionTimeout.Is(err))
+
+	ro, err := lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	require.NoError(ro.Close())
+
+	require.NoError(r.Close())
+
+	r, err = lib.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	require.NoError(r.Close())
+}
+
+// createCommit adds to the repository a commit with an empty tree pointing
+// to the given branch.
+func createCommit(
+	t *testing.T,
+	r *git.Repository,
+	branch string,
+	msg string,
+) plumbing.Hash {
+	t.Helper()
+	require := require.New(t)
+
+	tree := &object.Tree{}
+	obj := r.Storer.NewEncodedObject()
+	require.NoError(tree.Encode(obj))
+	treeHash, err := r.Storer.SetEncodedObject(obj)
+	require.NoError(err)
+
+	sig := object.Signature{
+		Name:  "test",
+		Email: "test@example.com",
+		When:  time.Now(),
+	}
+
+	commit := &object.Commit{
+		Author:    sig,
+		Committer: sig,
+		Message:   msg,
+		TreeHash:  treeHash,
+	}
+
+	obj = r.Storer.NewEncodedObject()
+	require.NoError(commit.Encode(obj))
+	hash, err := r.Storer.SetEncodedObject(obj)
+	require.NoError(err)
+
+	ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), hash)
+	require.NoError(r.Storer.SetReference(ref))
+
+	return hash
+}
@@ -0,0 +1,436 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/util"
+
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// Location is a borges.Location implementation that keeps its repositories
+// in memory.
+type Location struct {
+	id  borges.LocationID
+	lib *Library
+
+	m     sync.RWMutex
+	repos map[borges.RepositoryID]*memory.Storage
+
+	// tx holds a token while there's no transaction in progress.
+	tx chan struct{}
+}
+
+var (
+	_ borges.ContextLocation = (*Location)(nil)
+	_ borges.RemoverLocation = (*Location)(nil)
+)
+
+func newLocation(id borges.LocationID, lib *Library) *Location {
+	tx := make(chan struct{}, 1)
+	tx <- struct{}{}
+
+	return &Location{
+		id:    id,
+		lib:   lib,
+		repos: make(map[borges.RepositoryID]*memory.Storage),
+		tx:    tx,
+	}
+}
+
+// ID implements borges.Location interface.
+func (l *Location) ID() borges.LocationID {
+	return l.id
+}
+
+// Library implements borges.Location interface.
+func (l *Location) Library() borges.Library {
+	return l.lib
+}
+
+// Init implements borges.Location interface.
+func (l *Location) Init(id borges.RepositoryID) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.lib.opts.Timeout)
+	defer cancel()
+
+	return l.InitContext(ctx, id)
+}
+
+// InitContext implements borges.ContextLocation interface. In transactional
+// mode the repository is not visible until it's committed.
+func (l *Location) InitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	return l.repository(id, borges.RWMode, true)
+}
+
+// Get implements borges.Location interface.
+func (l *Location) Get(
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.lib.opts.Timeout)
+	defer cancel()
+
+	return l.GetContext(ctx, id, mode)
+}
+
+// GetContext implements borges.ContextLocation interface.
+func (l *Location) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	return l.repository(id, mode, false)
+}
+
+// GetOrInit implements borges.Location interface.
+func (l *Location) GetOrInit(id borges.RepositoryID) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.lib.opts.Timeout)
+	defer cancel()
+
+	return l.GetOrInitContext(ctx, id)
+}
+
+// GetOrInitContext implements borges.ContextLocation interface.
+func (l *Location) GetOrInitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	has, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if has {
+		return l.GetContext(ctx, id, borges.RWMode)
+	}
+
+	return l.InitContext(ctx, id)
+}
+
+// Has implements borges.Location interface.
+func (l *Location) Has(id borges.RepositoryID) (bool, error) {
+	return l.HasContext(context.Background(), id)
+}
+
+// HasContext implements borges.ContextLocation interface.
+func (l *Location) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+	}
+
+	_, ok := l.storage(borges.NormalizeRepositoryID(id.String()))
+	return ok, nil
+}
+
+// Remove implements borges.RemoverLocation interface.
+func (l *Location) Remove(id borges.RepositoryID) error {
+	id = borges.NormalizeRepositoryID(id.String())
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if _, ok := l.repos[id]; !ok {
+		return borges.ErrRepositoryNotExists.New(id)
+	}
+
+	delete(l.repos, id)
+	return nil
+}
+
+// Repositories implements borges.Location interface.
+func (l *Location) Repositories(
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	return l.RepositoriesContext(context.Background(), mode)
+}
+
+// RepositoriesContext implements borges.ContextLocation interface. The
+// repositories are returned sorted by ID.
+func (l *Location) RepositoriesContext(
+	ctx context.Context,
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	l.m.RLock()
+	ids := make([]borges.RepositoryID, 0, len(l.repos))
+	for id := range l.repos {
+		ids = append(ids, id)
+	}
+	l.m.RUnlock()
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return &repositoryIterator{loc: l, mode: mode, ids: ids}, nil
+}
+
+func (l *Location) storage(id borges.RepositoryID) (*memory.Storage, bool) {
+	l.m.RLock()
+	defer l.m.RUnlock()
+
+	sto, ok := l.repos[id]
+	return sto, ok
+}
+
+// repository opens the repository with the given ID. With init it's created
+// and ErrRepositoryExists is returned if it already exists.
+func (l *Location) repository(
+	id borges.RepositoryID,
+	mode borges.Mode,
+	init bool,
+) (borges.Repository, error) {
+	id = borges.NormalizeRepositoryID(id.String())
+
+	switch mode {
+	case borges.ReadOnlyMode:
+		sto, ok := l.storage(id)
+		if !ok {
+			return nil, borges.ErrRepositoryNotExists.New(id)
+		}
+
+		r, err := openRepository(l, id, &util.ReadOnlyStorer{Storer: sto},
+			nil, mode)
+		if err != nil {
+			return nil, err
+		}
+
+		return r, nil
+
+	case borges.RWMode:
+		transactional := l.lib.opts.Transactional
+		if transactional {
+			if err := l.startTransaction(); err != nil {
+				return nil, err
+			}
+		}
+
+		r, err := l.writeRepository(id, init, transactional)
+		if err != nil {
+			if transactional {
+				l.endTransaction()
+			}
+
+			return nil, err
+		}
+
+		return r, nil
+
+	default:
+		return nil, borges.ErrModeNotSupported.New(mode)
+	}
+}
+
+func (l *Location) writeRepository(
+	id borges.RepositoryID,
+	init bool,
+	transactional bool,
+) (*Repository, error) {
+	base, ok := l.storage(id)
+	switch {
+	case init && ok:
+		return nil, borges.ErrRepositoryExists.New(id)
+	case !init && !ok:
+		return nil, borges.ErrRepositoryNotExists.New(id)
+	}
+
+	var sto *memory.Storage
+	switch {
+	case init:
+		sto = memory.NewStorage()
+	case transactional:
+		var err error
+		sto, err = cloneStorage(base)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		sto = base
+	}
+
+	var tx *memory.Storage
+	if transactional {
+		tx = sto
+	}
+
+	if !init {
+		return openRepository(l, id, sto, tx, borges.RWMode)
+	}
+
+	r, err := initRepository(l, id, sto, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !transactional {
+		l.m.Lock()
+		defer l.m.Unlock()
+
+		if _, ok := l.repos[id]; ok {
+			return nil, borges.ErrRepositoryExists.New(id)
+		}
+
+		l.repos[id] = sto
+	}
+
+	return r, nil
+}
+
+// publish replaces the stored repository with the committed one.
+func (l *Location) publish(id borges.RepositoryID, sto *memory.Storage) {
+	l.m.Lock()
+	l.repos[id] = sto
+	l.m.Unlock()
+}
+
+func (l *Location) startTransaction() error {
+	timer := time.NewTimer(l.lib.opts.TransactionTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-l.tx:
+		return nil
+	case <-timer.C:
+		return borges.ErrTransactionTimeout.New(l.id)
+	}
+}
+
+func (l *Location) endTransaction() {
+	l.tx <- struct{}{}
+}
+
+// repositoryIterator opens the repositories of a location.
+type repositoryIterator struct {
+	loc  *Location
+	mode borges.Mode
+	ids  []borges.RepositoryID
+}
+
+var _ borges.RepositoryIterator = (*repositoryIterator)(nil)
+
+// Next implements borges.RepositoryIterator interface. Repositories removed
+// after the iterator was created are skipped.
+func (i *repositoryIterator) Next() (borges.Repository, error) {
+	for len(i.ids) > 0 {
+		id := i.ids[0]
+		i.ids = i.ids[1:]
+
+		r, err := i.loc.repository(id, i.mode, false)
+		if borges.ErrRepositoryNotExists.Is(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return r, nil
+	}
+
+	return nil, io.EOF
+}
+
+// ForEach implements borges.RepositoryIterator interface.
+func (i *repositoryIterator) ForEach(cb func(borges.Repository) error) error {
+	return util.ForEachRepositoryIterator(i, cb)
+}
+
+// Close implements borges.RepositoryIterator interface.
+func (i *repositoryIterator) Close() {}
+
+// cloneStorage returns a copy of the storage that can be modified without
+// changing the original one. Objects are immutable so they are shared.
+func cloneStorage(s *memory.Storage) (*memory.Storage, error) {
+	c := memory.NewStorage()
+
+	for h, o := range s.Objects {
+		c.Objects[h] = o
+	}
+	for h, o := range s.Commits {
+		c.Commits[h] = o
+	}
+	for h, o := range s.Trees {
+		c.Trees[h] = o
+	}
+	for h, o := range s.Blobs {
+		c.Blobs[h] = o
+	}
+	for h, o := range s.Tags {
+		c.Tags[h] = o
+	}
+
+	for n, r := range s.ReferenceStorage {
+		c.ReferenceStorage[n] = r
+	}
+
+	shallow, err := s.Shallow()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(shallow) > 0 {
+		if err := c.SetShallow(shallow); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := copyConfig(s, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func copyConfig(src, dst storage.Storer) error {
+	cfg, err := src.Config()
+	if err != nil {
+		return err
+	}
+
+	data, err := cfg.Marshal()
+	if err != nil {
+		return err
+	}
+
+	c, err := dst.Config()
+	if err != nil {
+		return err
+	}
+
+	if err := c.Unmarshal(data); err != nil {
+		return err
+	}
+
+	return dst.SetConfig(c)
+}
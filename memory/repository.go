@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"sync"
+
+	borges "github.com/src-d/go-borges"
+
+	billy "gopkg.in/src-d/go-billy.v4"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// Repository is a borges.Repository implementation for repositories kept in
+// memory.
+type Repository struct {
+	id   borges.RepositoryID
+	l    *Location
+	mode borges.Mode
+	repo *git.Repository
+
+	// tx is the private copy of the repository storage, only set in
+	// transactional mode.
+	tx *memory.Storage
+
+	mu     sync.Mutex
+	closed bool
+}
+
+var _ borges.Repository = (*Repository)(nil)
+
+func initRepository(
+	l *Location,
+	id borges.RepositoryID,
+	sto storage.Storer,
+	tx *memory.Storage,
+) (*Repository, error) {
+	r, err := git.Init(sto, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{id.String()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		id:   id,
+		l:    l,
+		mode: borges.RWMode,
+		repo: r,
+		tx:   tx,
+	}, nil
+}
+
+func openRepository(
+	l *Location,
+	id borges.RepositoryID,
+	sto storage.Storer,
+	tx *memory.Storage,
+	mode borges.Mode,
+) (*Repository, error) {
+	r, err := git.Open(sto, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		id:   id,
+		l:    l,
+		mode: mode,
+		repo: r,
+		tx:   tx,
+	}, nil
+}
+
+// ID implements borges.Repository interface.
+func (r *Repository) ID() borges.RepositoryID {
+	return r.id
+}
+
+// Location implements borges.Repository interface.
+func (r *Repository) Location() borges.Location {
+	return r.l
+}
+
+// Mode implements borges.Repository interface.
+func (r *Repository) Mode() borges.Mode {
+	return r.mode
+}
+
+// Commit implements borges.Repository interface. The changes are made
+// visible to the repositories opened afterwards and the repository is
+// closed.
+func (r *Repository) Commit() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return borges.ErrRepositoryClosed.New(r.id)
+	}
+
+	if r.tx == nil {
+		return borges.ErrNonTransactional.New()
+	}
+
+	r.closed = true
+	r.l.publish(r.id, r.tx)
+	r.l.endTransaction()
+
+	return nil
+}
+
+// Close implements borges.Repository interface. In transactional mode the
+// changes not committed are discarded.
+func (r *Repository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return borges.ErrRepositoryClosed.New(r.id)
+	}
+
+	r.closed = true
+	if r.tx != nil {
+		r.l.endTransaction()
+	}
+
+	return nil
+}
+
+// R implements borges.Repository interface.
+func (r *Repository) R() *git.Repository {
+	return r.repo
+}
+
+// FS implements borges.Repository interface. Memory repositories don't have
+// a filesystem so it always returns nil.
+func (r *Repository) FS() billy.Filesystem {
+	return nil
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestRepository_Transactional(t *testing.T) {
+	require := require.New(t)
+
+	lib := NewLibrary("test", &LibraryOptions{Transactional: true})
+	loc, err := lib.AddLocation("loc")
+	require.NoError(err)
+
+	r, err := loc.Init("github.com/foo/bar")
+	require.NoError(err)
+
+	has, err := loc.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.False(has, "repository visible before commit")
+
+	first := createCommit(t, r.R(), "master", "first")
+	require.NoError(r.Commit())
+	require.True(borges.ErrRepositoryClosed.Is(r.Close()))
+
+	has, err = loc.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.True(has)
+
+	// changes are discarded on close
+	r, err = loc.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	createCommit(t, r.R(), "master", "discarded")
+	_, err = r.R().CreateRemote(&config.RemoteConfig{
+		Name: "other",
+		URLs: []string{"github.com/foo/other"},
+	})
+	require.NoError(err)
+
+	ro, err := loc.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	requireBranch(t, ro, "master", first)
+	require.NoError(ro.Close())
+
+	require.NoError(r.Close())
+
+	ro, err = loc.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	requireBranch(t, ro, "master", first)
+	_, err = ro.R().Remote("other")
+	require.Error(err)
+	require.NoError(ro.Close())
+
+	// readers opened before commit keep seeing the old version
+	old, err := loc.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+
+	r, err = loc.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	second := createCommit(t, r.R(), "master", "second")
+	require.NoError(r.Commit())
+
+	requireBranch(t, old, "master", first)
+	require.NoError(old.Close())
+
+	ro, err = loc.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	requireBranch(t, ro, "master", second)
+	require.NoError(ro.Close())
+}
+
+func TestRepository_NonTransactional(t *testing.T) {
+	require := require.New(t)
+
+	lib := NewLibrary("test", nil)
+	loc, err := lib.AddLocation("loc")
+	require.NoError(err)
+
+	r, err := loc.Init("github.com/foo/bar")
+	require.NoError(err)
+
+	has, err := loc.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.True(has)
+
+	hash := createCommit(t, r.R(), "master", "first")
+	require.True(borges.ErrNonTransactional.Is(r.Commit()))
+	require.NoError(r.Close())
+
+	ro, err := loc.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	requireBranch(t, ro, "master", hash)
+
+	err = ro.R().Storer.SetReference(
+		plumbing.NewHashReference("refs/heads/other", hash))
+	require.Error(err)
+	require.NoError(ro.Close())
+
+	require.NoError(loc.Remove("github.com/foo/bar"))
+	require.True(borges.ErrRepositoryNotExists.Is(
+		loc.Remove("github.com/foo/bar")))
+
+	_, err = loc.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.True(borges.ErrRepositoryNotExists.Is(err))
+}
+
+func requireBranch(
+	t *testing.T,
+	r borges.Repository,
+	branch string,
+	hash plumbing.Hash,
+) {
+	t.Helper()
+
+	ref, err := r.R().Reference(plumbing.NewBranchReferenceName(branch), false)
+	require.NoError(t, err)
+	require.Equal(t, hash, ref.Hash())
+}
@@ -0,0 +1,281 @@
+package objectstore
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	errors "gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrBlobNotExists is returned by BlobStore.Get when the blob can't be
+	// found.
+	ErrBlobNotExists = errors.NewKind("blob %s not exists")
+	// ErrBlobExists is returned by BlobStore.PutIfAbsent when there's
+	// already a blob with the same key.
+	ErrBlobExists = errors.NewKind("blob %s already exists")
+)
+
+// BlobStore is a store of immutable blobs identified by a key, like the
+// buckets of S3 like object storage services. Keys are slash separated
+// paths.
+type BlobStore interface {
+	// Get returns the contents of the blob. If it does not exist
+	// ErrBlobNotExists is returned.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Put stores the blob replacing any other with the same key. The blob
+	// must not be visible to Get until it's completely written.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// PutIfAbsent stores the blob only if there isn't another one with the
+	// same key, otherwise ErrBlobExists is returned. The check and the
+	// write must be atomic, like the conditional writes of object storage
+	// services.
+	PutIfAbsent(ctx context.Context, key string, r io.Reader) error
+	// Delete removes the blob. Deleting a blob that does not exist is not
+	// an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the sorted keys of the blobs that start with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// DirStore is a BlobStore that keeps the blobs as files in a directory of a
+// billy.Filesystem. It's meant to be used in tests and as a local stand-in of
+// object storage services.
+type DirStore struct {
+	fs billy.Filesystem
+	// m serializes the conditional writes in the process, the lock file
+	// does it between processes when the filesystem supports locks.
+	m sync.Mutex
+}
+
+var _ BlobStore = (*DirStore)(nil)
+
+// NewDirStore returns a new DirStore that keeps the blobs in the given
+// filesystem.
+func NewDirStore(fs billy.Filesystem) *DirStore {
+	return &DirStore{fs: fs}
+}
+
+const (
+	tmpDir   = ".tmp"
+	lockFile = ".tmp/lock"
+)
+
+// Get implements BlobStore interface.
+func (s *DirStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	f, err := s.fs.Open(filepath.FromSlash(key))
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotExists.New(key)
+	}
+
+	return f, err
+}
+
+// Put implements BlobStore interface. The blob is written to a temporary
+// file that is renamed once complete.
+func (s *DirStore) Put(ctx context.Context, key string, r io.Reader) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	tmp, err := s.write(r)
+	if err != nil {
+		return err
+	}
+
+	return s.rename(tmp, key)
+}
+
+// PutIfAbsent implements BlobStore interface. The blob is written to a
+// temporary file that is renamed, while holding a lock, if there's no blob
+// with the same key.
+func (s *DirStore) PutIfAbsent(
+	ctx context.Context,
+	key string,
+	r io.Reader,
+) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	tmp, err := s.write(r)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock()
+	if err != nil {
+		s.fs.Remove(tmp)
+		return err
+	}
+	defer unlock()
+
+	_, err = s.fs.Stat(filepath.FromSlash(key))
+	if err == nil || !os.IsNotExist(err) {
+		s.fs.Remove(tmp)
+		if err == nil {
+			err = ErrBlobExists.New(key)
+		}
+
+		return err
+	}
+
+	return s.rename(tmp, key)
+}
+
+// write copies the blob to a temporary file and returns its name.
+func (s *DirStore) write(r io.Reader) (string, error) {
+	f, err := util.TempFile(s.fs, tmpDir, "blob")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		s.fs.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// rename moves the temporary file to the path of the blob.
+func (s *DirStore) rename(tmp, key string) error {
+	p := filepath.FromSlash(key)
+	err := s.fs.MkdirAll(filepath.Dir(p), 0755)
+	if err == nil {
+		err = s.fs.Rename(tmp, p)
+	}
+
+	if err != nil {
+		s.fs.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+func (s *DirStore) lock() (func(), error) {
+	s.m.Lock()
+
+	f, err := s.fs.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		s.m.Unlock()
+		return nil, err
+	}
+
+	if err := f.Lock(); err != nil {
+		f.Close()
+		s.m.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		f.Unlock()
+		f.Close()
+		s.m.Unlock()
+	}, nil
+}
+
+// Delete implements BlobStore interface.
+func (s *DirStore) Delete(ctx context.Context, key string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	err := s.fs.Remove(filepath.FromSlash(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// List implements BlobStore interface.
+func (s *DirStore) List(ctx context.Context, prefix string) ([]string, error) {
+	// only the directory holding the prefix is walked
+	dir := path.Dir(prefix)
+	if strings.HasSuffix(prefix, "/") {
+		dir = strings.TrimSuffix(prefix, "/")
+	}
+
+	if dir == "." {
+		dir = ""
+	}
+
+	if dir == tmpDir || strings.HasPrefix(dir, tmpDir+"/") {
+		return nil, nil
+	}
+
+	var keys []string
+	err := s.walk(ctx, dir, func(key string) {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *DirStore) walk(ctx context.Context, dir string, fn func(string)) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	entries, err := s.fs.ReadDir(filepath.FromSlash(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, e := range entries {
+		key := path.Join(dir, e.Name())
+		if !e.IsDir() {
+			fn(key)
+			continue
+		}
+
+		if key == tmpDir {
+			continue
+		}
+
+		if err := s.walk(ctx, key, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package objectstore
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+)
+
+func TestDirStore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	store := NewDirStore(memfs.New())
+
+	_, err := store.Get(ctx, "foo/bar")
+	require.True(ErrBlobNotExists.Is(err))
+
+	for _, key := range []string{"foo/bar", "foo/baz", "qux"} {
+		err = store.Put(ctx, key, strings.NewReader("data "+key))
+		require.NoError(err)
+	}
+
+	err = store.Put(ctx, "foo/bar", strings.NewReader("new data"))
+	require.NoError(err)
+
+	r, err := store.Get(ctx, "foo/bar")
+	require.NoError(err)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(err)
+	require.NoError(r.Close())
+	require.Equal("new data", string(data))
+
+	keys, err := store.List(ctx, "")
+	require.NoError(err)
+	require.Equal([]string{"foo/bar", "foo/baz", "qux"}, keys)
+
+	keys, err = store.List(ctx, "foo/")
+	require.NoError(err)
+	require.Equal([]string{"foo/bar", "foo/baz"}, keys)
+
+	require.NoError(store.Delete(ctx, "foo/bar"))
+	require.NoError(store.Delete(ctx, "foo/bar"))
+
+	keys, err = store.List(ctx, "foo/")
+	require.NoError(err)
+	require.Equal([]string{"foo/baz"}, keys)
+
+	keys, err = store.List(ctx, "foo/ba")
+	require.NoError(err)
+	require.Equal([]string{"foo/baz"}, keys)
+
+	keys, err = store.List(ctx, "q")
+	require.NoError(err)
+	require.Equal([]string{"qux"}, keys)
+
+	keys, err = store.List(ctx, "missing/")
+	require.NoError(err)
+	require.Empty(keys)
+
+	err = store.PutIfAbsent(ctx, "foo/qux", strings.NewReader("first"))
+	require.NoError(err)
+	err = store.PutIfAbsent(ctx, "foo/qux", strings.NewReader("second"))
+	require.True(ErrBlobExists.Is(err))
+
+	r, err = store.Get(ctx, "foo/qux")
+	require.NoError(err)
+	data, err = ioutil.ReadAll(r)
+	require.NoError(err)
+	require.NoError(r.Close())
+	require.Equal("first", string(data))
+
+	keys, err = store.List(ctx, "")
+	require.NoError(err)
+	require.Equal([]string{"foo/baz", "foo/qux", "qux"}, keys)
+}
@@ -0,0 +1,32 @@
+/*
+
+Package objectstore implements a go-borges library that keeps its locations
+in a BlobStore, an interface for object storage services where blobs can be
+written and read but not modified. DirStore is a BlobStore backed by a local
+directory.
+
+Each location is stored as a sequence of immutable generations. A generation
+is a siva file with rooted repositories, like the ones used by siva
+libraries, saved as "<location>/<generation>-<random>.siva", and a manifest,
+"<location>/manifests/<generation>.yaml", with the key of the siva file and
+the IDs of its repositories so they can be found without downloading the
+location. The current generation is the one with the highest number.
+
+Repositories opened in RWMode download the current generation and work on a
+local copy. Repository.Commit uploads it and then writes the manifest of the
+next generation with BlobStore.PutIfAbsent, that only stores it if it does
+not exist. If another library committed that generation first
+ErrConcurrentCommit is returned and the changes are discarded. Only one
+transaction can be open at the same time for each location in a library.
+Readers keep using the generation they opened and
+LibraryOptions.KeepGenerations sets how many of the previous generations are
+kept for them.
+
+Importing this package registers the "objectstore" scheme for borges.Open
+that stores the library in a local directory with DirStore. The options are
+id, timeout, transaction_timeout and keep_generations:
+
+	objectstore:///data/store?keep_generations=2
+
+*/
+package objectstore
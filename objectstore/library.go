@@ -0,0 +1,377 @@
+package objectstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/util"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+)
+
+// LibraryOptions hold configuration options for the library.
+type LibraryOptions struct {
+	// Timeout set a timeout for library operations. Some operations could
+	// potentially take long so timing out them will make an error be
+	// returned. A 0 value sets a default value of 20 seconds.
+	Timeout time.Duration
+	// TransactionTimeout is the time it will wait while another transaction
+	// is being done before error. 0 means default.
+	TransactionTimeout time.Duration
+	// Cache specifies the shared cache used in repositories. If not defined
+	// a new default cache will be created for each repository.
+	Cache cache.Object
+	// LocationSelector chooses the location used by Init and GetOrInit for
+	// new repositories, the location is created if it does not exist. If
+	// it's not set Init, and GetOrInit for repositories that do not exist,
+	// return borges.ErrNotImplemented.
+	LocationSelector borges.LocationSelector
+	// KeepGenerations is the number of previous generations of a location
+	// kept after a commit so readers that already read the manifest can
+	// still download them. A 0 value sets a default value of 1.
+	KeepGenerations int
+}
+
+const (
+	timeout         = 20 * time.Second
+	txTimeout       = 60 * time.Second
+	keepGenerations = 1
+)
+
+// Library is a borges.Library implementation that stores its locations as
+// immutable blobs in a BlobStore. Each location is a siva file with rooted
+// repositories and every commit writes a new generation of it.
+type Library struct {
+	id    borges.LibraryID
+	store BlobStore
+	opts  *LibraryOptions
+
+	m    sync.Mutex
+	locs map[borges.LocationID]*Location
+}
+
+var _ borges.ContextLibrary = (*Library)(nil)
+
+// NewLibrary returns a new Library that keeps its locations in the given
+// BlobStore.
+func NewLibrary(
+	id string,
+	store BlobStore,
+	options *LibraryOptions,
+) *Library {
+	var opts LibraryOptions
+	if options != nil {
+		opts = *options
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = timeout
+	}
+
+	if opts.TransactionTimeout == 0 {
+		opts.TransactionTimeout = txTimeout
+	}
+
+	if opts.KeepGenerations == 0 {
+		opts.KeepGenerations = keepGenerations
+	}
+
+	return &Library{
+		id:    borges.LibraryID(id),
+		store: store,
+		opts:  &opts,
+		locs:  make(map[borges.LocationID]*Location),
+	}
+}
+
+// ID implements borges.Library interface.
+func (l *Library) ID() borges.LibraryID {
+	return l.id
+}
+
+// AddLocation creates a new empty location. It's stored when its first
+// repository is committed. If it already exists borges.ErrLocationExists is
+// returned.
+func (l *Library) AddLocation(id borges.LocationID) (*Location, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	_, err := l.location(ctx, id)
+	if err == nil {
+		return nil, borges.ErrLocationExists.New(id)
+	}
+
+	if !borges.ErrLocationNotExists.Is(err) {
+		return nil, err
+	}
+
+	return l.addLocation(id), nil
+}
+
+func (l *Library) addLocation(id borges.LocationID) *Location {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	loc, ok := l.locs[id]
+	if !ok {
+		loc = newLocation(id, l)
+		l.locs[id] = loc
+	}
+
+	return loc
+}
+
+// Init implements borges.Library interface.
+func (l *Library) Init(id borges.RepositoryID) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.InitContext(ctx, id)
+}
+
+// InitContext implements borges.ContextLibrary interface. The location of the
+// new repository is chosen by LibraryOptions.LocationSelector, if it's not set
+// borges.ErrNotImplemented is returned.
+func (l *Library) InitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	if l.opts.LocationSelector == nil {
+		return nil, borges.ErrNotImplemented.New()
+	}
+
+	id = borges.NormalizeRepositoryID(id.String())
+	has, _, _, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if has {
+		return nil, borges.ErrRepositoryExists.New(id)
+	}
+
+	locID, err := l.opts.LocationSelector.SelectLocation(ctx, l, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if locID == "" {
+		return nil, borges.ErrInvalidLocationID.New(id)
+	}
+
+	loc := l.addLocation(locID)
+	return loc.InitContext(ctx, id)
+}
+
+// Get implements borges.Library interface.
+func (l *Library) Get(
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.GetContext(ctx, id, mode)
+}
+
+// GetContext implements borges.ContextLibrary interface.
+func (l *Library) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ok, _, locID, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, borges.ErrRepositoryNotExists.New(id)
+	}
+
+	loc, err := l.location(ctx, locID)
+	if err != nil {
+		return nil, err
+	}
+
+	return loc.GetContext(ctx, id, mode)
+}
+
+// GetOrInit implements borges.Library interface.
+func (l *Library) GetOrInit(id borges.RepositoryID) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.GetOrInitContext(ctx, id)
+}
+
+// GetOrInitContext implements borges.ContextLibrary interface. If the
+// repository does not exist it's initialized as in InitContext.
+func (l *Library) GetOrInitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	has, _, locID, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return l.InitContext(ctx, id)
+	}
+
+	loc, err := l.location(ctx, locID)
+	if err != nil {
+		return nil, err
+	}
+
+	return loc.GetContext(ctx, id, borges.RWMode)
+}
+
+// Has implements borges.Library interface.
+func (l *Library) Has(
+	id borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.HasContext(ctx, id)
+}
+
+// HasContext implements borges.ContextLibrary interface. Only the location
+// manifests are read.
+func (l *Library) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
+	locs, err := l.locations(ctx)
+	if err != nil {
+		return false, "", "", err
+	}
+
+	for _, loc := range locs {
+		has, err := loc.(*Location).HasContext(ctx, id)
+		if err != nil {
+			return false, "", "", err
+		}
+
+		if has {
+			return true, l.id, loc.ID(), nil
+		}
+	}
+
+	return false, "", "", nil
+}
+
+// Repositories implements borges.Library interface.
+func (l *Library) Repositories(
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.RepositoriesContext(ctx, mode)
+}
+
+// RepositoriesContext implements borges.ContextLibrary interface.
+func (l *Library) RepositoriesContext(
+	ctx context.Context,
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	locs, err := l.locations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.NewLocationRepositoryIterator(locs, mode), nil
+}
+
+// Location implements borges.Library interface.
+func (l *Library) Location(id borges.LocationID) (borges.Location, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.LocationContext(ctx, id)
+}
+
+// LocationContext implements borges.ContextLibrary interface.
+func (l *Library) LocationContext(
+	ctx context.Context,
+	id borges.LocationID,
+) (borges.Location, error) {
+	return l.location(ctx, id)
+}
+
+func (l *Library) location(
+	ctx context.Context,
+	id borges.LocationID,
+) (*Location, error) {
+	l.m.Lock()
+	loc, ok := l.locs[id]
+	l.m.Unlock()
+	if ok {
+		return loc, nil
+	}
+
+	_, ok, err := readManifest(ctx, l.store, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, borges.ErrLocationNotExists.New(id)
+	}
+
+	return l.addLocation(id), nil
+}
+
+// Locations implements borges.Library interface.
+func (l *Library) Locations() (borges.LocationIterator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+
+	return l.LocationsContext(ctx)
+}
+
+// LocationsContext implements borges.ContextLibrary interface.
+func (l *Library) LocationsContext(
+	ctx context.Context,
+) (borges.LocationIterator, error) {
+	locs, err := l.locations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.NewLocationIterator(locs), nil
+}
+
+// locations returns the stored locations and the ones added but not yet
+// committed sorted by ID.
+func (l *Library) locations(ctx context.Context) ([]borges.Location, error) {
+	keys, err := l.store.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if id, ok := toLocID(key); ok {
+			l.addLocation(id)
+		}
+	}
+
+	l.m.Lock()
+	locs := make([]borges.Location, 0, len(l.locs))
+	for _, loc := range l.locs {
+		locs = append(locs, loc)
+	}
+	l.m.Unlock()
+
+	sort.Slice(locs, func(i, j int) bool {
+		return locs[i].ID() < locs[j].ID()
+	})
+
+	return locs, nil
+}
@@ -0,0 +1,264 @@
+package objectstore
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func setupLibrary(store BlobStore) *Library {
+	return NewLibrary("test", store, &LibraryOptions{
+		TransactionTimeout: 100 * time.Millisecond,
+		LocationSelector: borges.LocationSelectorFunc(func(
+			context.Context,
+			borges.Library,
+			borges.RepositoryID,
+		) (borges.LocationID, error) {
+			return "loc", nil
+		}),
+	})
+}
+
+func TestLibrary(t *testing.T) {
+	require := require.New(t)
+
+	store := NewDirStore(memfs.New())
+	lib := setupLibrary(store)
+
+	r, err := lib.Init("github.com/foo/bar")
+	require.NoError(err)
+
+	has, _, _, err := lib.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.False(has, "repository visible before commit")
+
+	_, err = lib.Init("github.com/foo/other")
+	require.True(borges.ErrTransactionTimeout.Is(err))
+
+	first := createCommit(t, r.R(), "first")
+	require.NoError(r.Commit())
+
+	require.Equal([]string{
+		"loc/00000001.siva",
+		"loc/manifests/00000001.yaml",
+	}, storedKeys(t, store))
+
+	r, err = lib.GetOrInit("github.com/foo/qux.git")
+	require.NoError(err)
+	require.Equal(borges.RepositoryID("github.com/foo/qux"), r.ID())
+	require.Equal(borges.LocationID("loc"), r.Location().ID())
+	require.NoError(r.Commit())
+
+	// changes are discarded on close
+	r, err = lib.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	createCommit(t, r.R(), "discarded")
+	require.NoError(r.Close())
+
+	requireBranch(t, lib, "github.com/foo/bar", first)
+
+	// readers opened before commit keep seeing the old generation
+	old, err := lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+
+	r, err = lib.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	second := createCommit(t, r.R(), "second")
+	require.NoError(r.Commit())
+
+	ref, err := old.R().Reference("refs/heads/master", true)
+	require.NoError(err)
+	require.Equal(first, ref.Hash())
+	require.NoError(old.Close())
+
+	requireBranch(t, lib, "github.com/foo/bar", second)
+
+	// only the previous generation is kept
+	require.Equal([]string{
+		"loc/00000002.siva",
+		"loc/00000003.siva",
+		"loc/manifests/00000002.yaml",
+		"loc/manifests/00000003.yaml",
+	}, storedKeys(t, store))
+
+	// a new library finds the stored locations
+	lib = setupLibrary(store)
+
+	var ids []borges.RepositoryID
+	repos, err := lib.Repositories(borges.ReadOnlyMode)
+	require.NoError(err)
+	require.NoError(repos.ForEach(func(r borges.Repository) error {
+		ids = append(ids, r.ID())
+		require.True(borges.ErrNonTransactional.Is(r.Commit()))
+		return r.Close()
+	}))
+	require.ElementsMatch([]borges.RepositoryID{
+		"github.com/foo/bar",
+		"github.com/foo/qux",
+	}, ids)
+
+	requireBranch(t, lib, "github.com/foo/bar", second)
+
+	_, err = lib.Init("github.com/foo/bar")
+	require.True(borges.ErrRepositoryExists.Is(err))
+
+	_, err = lib.AddLocation("loc")
+	require.True(borges.ErrLocationExists.Is(err))
+}
+
+func TestLibrary_ConcurrentCommit(t *testing.T) {
+	require := require.New(t)
+
+	store := NewDirStore(memfs.New())
+	lib := setupLibrary(store)
+
+	r, err := lib.Init("github.com/foo/bar")
+	require.NoError(err)
+	first := createCommit(t, r.R(), "first")
+	require.NoError(r.Commit())
+
+	// two libraries using the same store, like different processes
+	other := setupLibrary(store)
+
+	r1, err := lib.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	r2, err := other.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+
+	second := createCommit(t, r1.R(), "second")
+	require.NoError(r1.Commit())
+
+	createCommit(t, r2.R(), "conflict")
+	err = r2.Commit()
+	require.True(ErrConcurrentCommit.Is(err))
+
+	// the blob of the failed commit is deleted
+	require.Equal([]string{
+		"loc/00000001.siva",
+		"loc/00000002.siva",
+		"loc/manifests/00000001.yaml",
+		"loc/manifests/00000002.yaml",
+	}, storedKeys(t, store))
+
+	requireBranch(t, other, "github.com/foo/bar", second)
+	require.NotEqual(first, second)
+
+	// the location can be used after the failed commit
+	r2, err = other.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	require.NoError(r2.Close())
+}
+
+func TestLibrary_NoSelector(t *testing.T) {
+	require := require.New(t)
+
+	lib := NewLibrary("test", NewDirStore(memfs.New()), nil)
+
+	_, err := lib.Init("github.com/foo/bar")
+	require.True(borges.ErrNotImplemented.Is(err))
+
+	loc, err := lib.AddLocation("loc")
+	require.NoError(err)
+
+	r, err := loc.Init("github.com/foo/bar")
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	has, _, locID, err := lib.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.True(has)
+	require.Equal(borges.LocationID("loc"), locID)
+
+	// existing repositories do not need a selector
+	r, err = lib.GetOrInit("github.com/foo/bar")
+	require.NoError(err)
+	require.Equal(borges.LocationID("loc"), r.Location().ID())
+	require.NoError(r.Close())
+
+	_, err = lib.GetOrInit("github.com/foo/qux")
+	require.True(borges.ErrNotImplemented.Is(err))
+}
+
+// storedKeys returns the keys of the store without the random suffix of
+// the generation blobs.
+func storedKeys(t *testing.T, store BlobStore) []string {
+	t.Helper()
+
+	keys, err := store.List(context.Background(), "")
+	require.NoError(t, err)
+
+	for i, key := range keys {
+		if strings.HasSuffix(key, blobExt) {
+			keys[i] = key[:strings.IndexByte(key, '-')] + blobExt
+		}
+	}
+
+	return keys
+}
+
+func requireBranch(
+	t *testing.T,
+	lib *Library,
+	id borges.RepositoryID,
+	hash plumbing.Hash,
+) {
+	t.Helper()
+	require := require.New(t)
+
+	r, err := lib.Get(id, borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	ref, err := r.R().Reference("refs/heads/master", true)
+	require.NoError(err)
+	require.Equal(hash, ref.Hash())
+}
+
+// createCommit adds a commit with an empty tree on top of master.
+func createCommit(t *testing.T, r *git.Repository, msg string) plumbing.Hash {
+	t.Helper()
+	require := require.New(t)
+
+	tree := &object.Tree{}
+	obj := r.Storer.NewEncodedObject()
+	require.NoError(tree.Encode(obj))
+	treeHash, err := r.Storer.SetEncodedObject(obj)
+	require.NoError(err)
+
+	sig := object.Signature{
+		Name:  "test",
+		Email: "test@example.com",
+		When:  time.Now(),
+	}
+
+	commit := &object.Commit{
+		Author:    sig,
+		Committer: sig,
+		Message:   msg,
+		TreeHash:  treeHash,
+	}
+
+	master := plumbing.NewBranchReferenceName("master")
+	if ref, err := r.Reference(master, true); err == nil {
+		commit.ParentHashes = []plumbing.Hash{ref.Hash()}
+	}
+
+	obj = r.Storer.NewEncodedObject()
+	require.NoError(commit.Encode(obj))
+	hash, err := r.Storer.SetEncodedObject(obj)
+	require.NoError(err)
+
+	require.NoError(r.Storer.SetReference(
+		plumbing.NewHashReference(master, hash)))
+
+	return hash
+}
@@ -0,0 +1,508 @@
+package objectstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+	"github.com/src-d/go-borges/util"
+
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	errors "gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrConcurrentCommit is returned on commit when another process committed
+// a new generation of the location since the transaction started.
+var ErrConcurrentCommit = errors.NewKind("location %s was modified by " +
+	"another commit of generation %d")
+
+// sivaLocation is the ID of the location in the siva library built for each
+// generation.
+const sivaLocation = "location"
+
+// Location is a borges.Location stored as a siva file in a BlobStore.
+type Location struct {
+	id  borges.LocationID
+	lib *Library
+
+	// tx holds a token while there's no transaction in progress.
+	tx chan struct{}
+
+	m        sync.Mutex
+	snapshot *snapshot
+}
+
+// snapshot is a read only copy of a generation of the location.
+type snapshot struct {
+	generation int
+	loc        *siva.Location
+}
+
+var _ borges.ContextLocation = (*Location)(nil)
+
+func newLocation(id borges.LocationID, lib *Library) *Location {
+	tx := make(chan struct{}, 1)
+	tx <- struct{}{}
+
+	return &Location{
+		id:  id,
+		lib: lib,
+		tx:  tx,
+	}
+}
+
+// ID implements borges.Location interface.
+func (l *Location) ID() borges.LocationID {
+	return l.id
+}
+
+// Library implements borges.Location interface.
+func (l *Location) Library() borges.Library {
+	return l.lib
+}
+
+// Init implements borges.Location interface.
+func (l *Location) Init(id borges.RepositoryID) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.lib.opts.Timeout)
+	defer cancel()
+
+	return l.InitContext(ctx, id)
+}
+
+// InitContext implements borges.ContextLocation interface. The repository is
+// stored when it's committed.
+func (l *Location) InitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	return l.repository(ctx, borges.NormalizeRepositoryID(id.String()), borges.RWMode, true)
+}
+
+// Get implements borges.Location interface.
+func (l *Location) Get(
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.lib.opts.Timeout)
+	defer cancel()
+
+	return l.GetContext(ctx, id, mode)
+}
+
+// GetContext implements borges.ContextLocation interface.
+func (l *Location) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	return l.repository(ctx, borges.NormalizeRepositoryID(id.String()), mode, false)
+}
+
+// GetOrInit implements borges.Location interface.
+func (l *Location) GetOrInit(id borges.RepositoryID) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.lib.opts.Timeout)
+	defer cancel()
+
+	return l.GetOrInitContext(ctx, id)
+}
+
+// GetOrInitContext implements borges.ContextLocation interface.
+func (l *Location) GetOrInitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	has, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if has {
+		return l.GetContext(ctx, id, borges.RWMode)
+	}
+
+	return l.InitContext(ctx, id)
+}
+
+// Has implements borges.Location interface.
+func (l *Location) Has(id borges.RepositoryID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.lib.opts.Timeout)
+	defer cancel()
+
+	return l.HasContext(ctx, id)
+}
+
+// HasContext implements borges.ContextLocation interface. Only the location
+// manifest is read.
+func (l *Location) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, error) {
+	m, _, err := readManifest(ctx, l.lib.store, l.id)
+	if err != nil {
+		return false, err
+	}
+
+	return m.has(borges.NormalizeRepositoryID(id.String())), nil
+}
+
+// Repositories implements borges.Location interface.
+func (l *Location) Repositories(
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.lib.opts.Timeout)
+	defer cancel()
+
+	return l.RepositoriesContext(ctx, mode)
+}
+
+// RepositoriesContext implements borges.ContextLocation interface.
+func (l *Location) RepositoriesContext(
+	ctx context.Context,
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
+	m, _, err := readManifest(ctx, l.lib.store, l.id)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]borges.RepositoryID, len(m.Repositories))
+	copy(ids, m.Repositories)
+
+	return &repositoryIterator{loc: l, mode: mode, ids: ids}, nil
+}
+
+// repository opens the repository with the given ID. Read only
+// repositories use a shared copy of the current generation. Read write
+// repositories start a transaction with their own copy of it. With init the
+// repository is created and ErrRepositoryExists is returned if it already
+// exists.
+func (l *Location) repository(
+	ctx context.Context,
+	id borges.RepositoryID,
+	mode borges.Mode,
+	init bool,
+) (borges.Repository, error) {
+	switch mode {
+	case borges.ReadOnlyMode:
+		return l.readRepository(ctx, id)
+	case borges.RWMode:
+		if err := l.startTransaction(); err != nil {
+			return nil, err
+		}
+
+		r, err := l.writeRepository(ctx, id, init)
+		if err != nil {
+			l.endTransaction()
+			return nil, err
+		}
+
+		return r, nil
+	default:
+		return nil, borges.ErrModeNotSupported.New(mode)
+	}
+}
+
+func (l *Location) readRepository(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	m, _, err := readManifest(ctx, l.lib.store, l.id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !m.has(id) {
+		return nil, borges.ErrRepositoryNotExists.New(id)
+	}
+
+	l.m.Lock()
+	s := l.snapshot
+	l.m.Unlock()
+
+	if s == nil || s.generation != m.Generation {
+		loc, _, err := l.openGeneration(ctx, m, false)
+		if err != nil {
+			return nil, err
+		}
+
+		s = &snapshot{generation: m.Generation, loc: loc}
+
+		l.m.Lock()
+		if l.snapshot == nil || l.snapshot.generation < s.generation {
+			l.snapshot = s
+		}
+		l.m.Unlock()
+	}
+
+	r, err := s.loc.Get(id, borges.ReadOnlyMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{Repository: r, loc: l}, nil
+}
+
+func (l *Location) writeRepository(
+	ctx context.Context,
+	id borges.RepositoryID,
+	init bool,
+) (borges.Repository, error) {
+	m, _, err := readManifest(ctx, l.lib.store, l.id)
+	if err != nil {
+		return nil, err
+	}
+
+	has := m.has(id)
+	switch {
+	case init && has:
+		return nil, borges.ErrRepositoryExists.New(id)
+	case !init && !has:
+		return nil, borges.ErrRepositoryNotExists.New(id)
+	}
+
+	loc, fs, err := l.openGeneration(ctx, m, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var r borges.Repository
+	if init {
+		r, err = loc.Init(id)
+	} else {
+		r, err = loc.Get(id, borges.RWMode)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		Repository: r,
+		loc:        l,
+		sivaLoc:    loc,
+		fs:         fs,
+		manifest:   m,
+	}, nil
+}
+
+// openGeneration copies the siva file of the manifest generation to memory
+// and opens it with a rooted siva library.
+func (l *Location) openGeneration(
+	ctx context.Context,
+	m *manifest,
+	transactional bool,
+) (*siva.Location, billy.Filesystem, error) {
+	fs := memfs.New()
+	if m.Blob != "" {
+		if err := l.download(ctx, m.Blob, fs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	lib, err := siva.NewLibrary(string(l.lib.id), fs, &siva.LibraryOptions{
+		Transactional:    transactional,
+		RootedRepo:       true,
+		MetadataReadOnly: true,
+		TempFS:           memfs.New(),
+		Cache:            l.lib.opts.Cache,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var loc borges.Location
+	if m.Blob != "" {
+		loc, err = lib.Location(sivaLocation)
+	} else {
+		loc, err = lib.AddLocation(sivaLocation)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return loc.(*siva.Location), fs, nil
+}
+
+func (l *Location) download(
+	ctx context.Context,
+	key string,
+	fs billy.Filesystem,
+) error {
+	r, err := l.lib.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := fs.Create(sivaLocation + blobExt)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// upload stores the siva file as a new generation of the location and
+// writes its manifest. The manifest is only written if no other commit
+// stored the same generation before, otherwise the uploaded blob is deleted
+// and ErrConcurrentCommit is returned. Old generations are deleted once the
+// manifest of the new one is stored.
+func (l *Location) upload(
+	ctx context.Context,
+	loc *siva.Location,
+	fs billy.Filesystem,
+	prev *manifest,
+) error {
+	ids, err := repositoryIDs(loc)
+	if err != nil {
+		return err
+	}
+
+	m := &manifest{
+		Generation:   prev.Generation + 1,
+		Blob:         generationKey(l.id, prev.Generation+1),
+		Repositories: ids,
+	}
+
+	f, err := fs.Open(sivaLocation + blobExt)
+	if err != nil {
+		return err
+	}
+
+	err = l.lib.store.Put(ctx, m.Blob, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = writeManifest(ctx, l.lib.store, l.id, m)
+	if ErrBlobExists.Is(err) {
+		// TODO: log the error when the blob can't be deleted, it will be
+		// removed with the generation
+		_ = l.lib.store.Delete(ctx, m.Blob)
+		return ErrConcurrentCommit.New(l.id, m.Generation)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return l.deleteGenerations(ctx, m.Generation-l.lib.opts.KeepGenerations)
+}
+
+// deleteGenerations removes the manifests and blobs of the generations
+// older than the given one.
+func (l *Location) deleteGenerations(ctx context.Context, oldest int) error {
+	prefix := string(l.id) + "/"
+	keys, err := l.lib.store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, prefix)
+		ext := blobExt
+		if strings.HasPrefix(name, manifestsDir+"/") {
+			name = strings.TrimPrefix(name, manifestsDir+"/")
+			ext = manifestExt
+		}
+
+		gen, ok := toGeneration(name, ext)
+		if !ok || strings.Contains(name, "/") || gen >= oldest {
+			continue
+		}
+
+		if err := l.lib.store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func repositoryIDs(loc *siva.Location) ([]borges.RepositoryID, error) {
+	iter, err := loc.Repositories(borges.ReadOnlyMode)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []borges.RepositoryID
+	err = iter.ForEach(func(r borges.Repository) error {
+		ids = append(ids, r.ID())
+		return r.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (l *Location) startTransaction() error {
+	timer := time.NewTimer(l.lib.opts.TransactionTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-l.tx:
+		return nil
+	case <-timer.C:
+		return borges.ErrTransactionTimeout.New(l.id)
+	}
+}
+
+func (l *Location) endTransaction() {
+	l.tx <- struct{}{}
+}
+
+// repositoryIterator opens the repositories of a location.
+type repositoryIterator struct {
+	loc  *Location
+	mode borges.Mode
+	ids  []borges.RepositoryID
+}
+
+var _ borges.RepositoryIterator = (*repositoryIterator)(nil)
+
+// Next implements borges.RepositoryIterator interface. Repositories removed
+// after the iterator was created are skipped.
+func (i *repositoryIterator) Next() (borges.Repository, error) {
+	for len(i.ids) > 0 {
+		id := i.ids[0]
+		i.ids = i.ids[1:]
+
+		r, err := i.loc.Get(id, i.mode)
+		if borges.ErrRepositoryNotExists.Is(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return r, nil
+	}
+
+	return nil, io.EOF
+}
+
+// ForEach implements borges.RepositoryIterator interface.
+func (i *repositoryIterator) ForEach(cb func(borges.Repository) error) error {
+	return util.ForEachRepositoryIterator(i, cb)
+}
+
+// Close implements borges.RepositoryIterator interface.
+func (i *repositoryIterator) Close() {}
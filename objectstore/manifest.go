@@ -0,0 +1,164 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/uuid"
+)
+
+const (
+	manifestsDir = "manifests"
+	manifestExt  = ".yaml"
+	blobExt      = ".siva"
+)
+
+// manifest holds a generation of a location and the repositories it
+// contains so they can be found without downloading the location blob.
+// Manifests are never modified, each generation has its own one and the
+// current generation is the one with the highest number.
+type manifest struct {
+	// Generation is incremented with each commit. 0 means the location
+	// does not have any data.
+	Generation int `json:"generation"`
+	// Blob is the key of the siva file of the current generation.
+	Blob string `json:"blob,omitempty"`
+	// Repositories are the IDs of the repositories in the location.
+	Repositories []borges.RepositoryID `json:"repositories,omitempty"`
+}
+
+func (m *manifest) has(id borges.RepositoryID) bool {
+	for _, r := range m.Repositories {
+		if r == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func manifestsPrefix(id borges.LocationID) string {
+	return string(id) + "/" + manifestsDir + "/"
+}
+
+func manifestKey(id borges.LocationID, generation int) string {
+	return fmt.Sprintf("%s%08d%s", manifestsPrefix(id), generation, manifestExt)
+}
+
+// generationKey returns a new key for the blob of a generation. It has a
+// random suffix so commits of the same generation from different processes
+// don't overwrite each other blob.
+func generationKey(id borges.LocationID, generation int) string {
+	return fmt.Sprintf("%s/%08d-%s%s", id, generation, uuid.New(), blobExt)
+}
+
+// toLocID returns the location ID of a manifest key and false if the key is
+// not a manifest.
+func toLocID(key string) (borges.LocationID, bool) {
+	dir, name := path.Split(key)
+	if _, ok := toGeneration(name, manifestExt); !ok {
+		return "", false
+	}
+
+	dir = strings.TrimSuffix(dir, "/")
+	if path.Base(dir) != manifestsDir || path.Dir(dir) == "." {
+		return "", false
+	}
+
+	return borges.LocationID(path.Dir(dir)), true
+}
+
+// toGeneration returns the generation of a manifest or blob file name with
+// the given extension and false if it's not one.
+func toGeneration(name, ext string) (int, bool) {
+	if !strings.HasSuffix(name, ext) {
+		return 0, false
+	}
+
+	name = strings.TrimSuffix(name, ext)
+	if i := strings.IndexByte(name, '-'); i >= 0 {
+		name = name[:i]
+	}
+
+	gen, err := strconv.Atoi(name)
+	if err != nil {
+		return 0, false
+	}
+
+	return gen, true
+}
+
+// readManifest reads the manifest of the current generation of the
+// location. When it does not exist an empty one is returned with false.
+func readManifest(
+	ctx context.Context,
+	store BlobStore,
+	id borges.LocationID,
+) (*manifest, bool, error) {
+	keys, err := store.List(ctx, manifestsPrefix(id))
+	if err != nil {
+		return nil, false, err
+	}
+
+	key, ok := lastManifest(keys)
+	if !ok {
+		return &manifest{}, false, nil
+	}
+
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var m manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, false, err
+	}
+
+	return &m, true, nil
+}
+
+// lastManifest returns the key of the manifest with the highest generation.
+func lastManifest(keys []string) (string, bool) {
+	var last string
+	max := -1
+	for _, key := range keys {
+		gen, ok := toGeneration(path.Base(key), manifestExt)
+		if ok && gen > max {
+			last, max = key, gen
+		}
+	}
+
+	return last, max >= 0
+}
+
+// writeManifest stores the manifest of a new generation. If another commit
+// already stored it ErrBlobExists is returned.
+func writeManifest(
+	ctx context.Context,
+	store BlobStore,
+	id borges.LocationID,
+	m *manifest,
+) error {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	key := manifestKey(id, m.Generation)
+	return store.PutIfAbsent(ctx, key, bytes.NewReader(data))
+}
@@ -0,0 +1,85 @@
+package objectstore
+
+import (
+	"context"
+	"sync"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+
+	billy "gopkg.in/src-d/go-billy.v4"
+)
+
+// Repository is a borges.Repository of a location stored in a BlobStore. It
+// wraps the siva repository of the generation it was opened from.
+type Repository struct {
+	borges.Repository
+	loc *Location
+
+	// set only in read write mode
+	sivaLoc  *siva.Location
+	fs       billy.Filesystem
+	manifest *manifest
+
+	mu   sync.Mutex
+	done bool
+}
+
+var _ borges.Repository = (*Repository)(nil)
+
+// Location implements borges.Repository interface.
+func (r *Repository) Location() borges.Location {
+	return r.loc
+}
+
+// Commit implements borges.Repository interface. The changes are written as
+// a new generation of the location. If another commit was done to the
+// location since the repository was opened ErrConcurrentCommit is returned
+// and the changes are discarded.
+func (r *Repository) Commit() error {
+	if r.sivaLoc == nil {
+		return r.Repository.Commit()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.Repository.Commit(); err != nil {
+		r.end()
+		return err
+	}
+
+	defer r.end()
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		r.loc.lib.opts.Timeout,
+	)
+	defer cancel()
+
+	return r.loc.upload(ctx, r.sivaLoc, r.fs, r.manifest)
+}
+
+// Close implements borges.Repository interface. The changes not committed
+// are discarded.
+func (r *Repository) Close() error {
+	if r.sivaLoc == nil {
+		return r.Repository.Close()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	defer r.end()
+	return r.Repository.Close()
+}
+
+// end finishes the transaction of the location if it wasn't already.
+func (r *Repository) end() {
+	if r.done {
+		return
+	}
+
+	r.done = true
+	r.loc.endTransaction()
+}
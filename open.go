@@ -0,0 +1,225 @@
+package borges
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+var (
+	// ErrUnknownScheme is returned by Open when no backend is registered
+	// for the scheme of the URL.
+	ErrUnknownScheme = errors.NewKind("unknown library scheme %q")
+	// ErrInvalidURL is returned by Open when the URL can not be parsed or
+	// has options not supported by the backend.
+	ErrInvalidURL = errors.NewKind("invalid library URL: %s")
+)
+
+// Opener builds a Library from a URL with the scheme it was registered
+// with. The path and query of the URL are the backend specific parameters.
+type Opener func(u *url.URL) (Library, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = make(map[string]Opener)
+)
+
+// Register makes a backend available to Open with the given scheme. It's
+// meant to be called from the init function of the backend package so
+// importing it is enough to use it. It panics if the opener is nil or the
+// scheme is already registered.
+func Register(scheme string, opener Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	if opener == nil {
+		panic("borges: Register opener is nil")
+	}
+
+	if _, ok := openers[scheme]; ok {
+		panic("borges: Register called twice for scheme " + scheme)
+	}
+
+	openers[scheme] = opener
+}
+
+// Schemes returns the sorted list of registered schemes.
+func Schemes() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+
+	schemes := make([]string, 0, len(openers))
+	for s := range openers {
+		schemes = append(schemes, s)
+	}
+
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open returns the Library described by the URL, for example:
+//
+//	siva:///data/lib?bucket=2&rooted=true&transactional=true
+//
+// The scheme chooses the backend, which must have been registered
+// importing its package, and the query holds its options.
+func Open(rawurl string) (Library, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, ErrInvalidURL.Wrap(err, rawurl)
+	}
+
+	openersMu.RLock()
+	opener, ok := openers[u.Scheme]
+	openersMu.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownScheme.New(u.Scheme)
+	}
+
+	return opener(u)
+}
+
+// URLPath returns the filesystem path of a library URL. It's the path of
+// URLs like "siva:///data/lib" or the opaque part of relative ones like
+// "siva:data/lib".
+func URLPath(u *url.URL) (string, error) {
+	if u.Opaque != "" {
+		return u.Opaque, nil
+	}
+
+	if u.Host != "" {
+		return "", ErrInvalidURL.New(
+			fmt.Sprintf("unexpected host %q, use %s:///path", u.Host, u.Scheme))
+	}
+
+	if u.Path == "" {
+		return "", ErrInvalidURL.New("missing path")
+	}
+
+	return u.Path, nil
+}
+
+// URLOptions reads the typed options of the query of a library URL. The
+// first parse error is kept and returned by Err, that also fails if the
+// query has options that were not read.
+type URLOptions struct {
+	values url.Values
+	read   map[string]bool
+	err    error
+}
+
+// NewURLOptions returns the URLOptions of the query of the URL.
+func NewURLOptions(u *url.URL) *URLOptions {
+	return &URLOptions{
+		values: u.Query(),
+		read:   make(map[string]bool),
+	}
+}
+
+func (o *URLOptions) get(name string) (string, bool) {
+	o.read[name] = true
+	if _, ok := o.values[name]; !ok {
+		return "", false
+	}
+
+	return o.values.Get(name), true
+}
+
+func (o *URLOptions) fail(name, value string, err error) {
+	if o.err == nil {
+		o.err = ErrInvalidURL.New(
+			fmt.Sprintf("option %s=%q: %s", name, value, err))
+	}
+}
+
+// String returns the value of the option or def if it's not set.
+func (o *URLOptions) String(name, def string) string {
+	v, ok := o.get(name)
+	if !ok {
+		return def
+	}
+
+	return v
+}
+
+// Bool returns the value of a boolean option or def if it's not set. An
+// option without value, like "?rooted", is true.
+func (o *URLOptions) Bool(name string, def bool) bool {
+	v, ok := o.get(name)
+	if !ok {
+		return def
+	}
+
+	if v == "" {
+		return true
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		o.fail(name, v, err)
+		return def
+	}
+
+	return b
+}
+
+// Int returns the value of an integer option or def if it's not set.
+func (o *URLOptions) Int(name string, def int) int {
+	v, ok := o.get(name)
+	if !ok {
+		return def
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		o.fail(name, v, err)
+		return def
+	}
+
+	return i
+}
+
+// Duration returns the value of a duration option, like "30s", or def if
+// it's not set.
+func (o *URLOptions) Duration(name string, def time.Duration) time.Duration {
+	v, ok := o.get(name)
+	if !ok {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		o.fail(name, v, err)
+		return def
+	}
+
+	return d
+}
+
+// Err returns the first error parsing the options or an error if the
+// query has options that were not read.
+func (o *URLOptions) Err() error {
+	if o.err != nil {
+		return o.err
+	}
+
+	var unknown []string
+	for name := range o.values {
+		if !o.read[name] {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return ErrInvalidURL.New(fmt.Sprintf("unknown options %v", unknown))
+	}
+
+	return nil
+}
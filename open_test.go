@@ -0,0 +1,149 @@
+package borges_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/plain"
+	"github.com/src-d/go-borges/siva"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen_Siva(t *testing.T) {
+	require := require.New(t)
+
+	path, err := ioutil.TempDir("", "go-borges-open")
+	require.NoError(err)
+	defer os.RemoveAll(path)
+
+	name := "cf2e799463e1a00dbd1addd2003b0c7db31dbfe2.siva"
+	data, err := ioutil.ReadFile(filepath.Join("_testdata", "rooted", name))
+	require.NoError(err)
+	err = ioutil.WriteFile(filepath.Join(path, name), data, 0644)
+	require.NoError(err)
+
+	lib, err := borges.Open(
+		"siva://" + path + "?id=test&rooted=true&metadata_readonly=true")
+	require.NoError(err)
+	require.IsType(&siva.Library{}, lib)
+	require.Equal(borges.LibraryID("test"), lib.ID())
+
+	r, err := lib.Get("gitserver.com/a", borges.ReadOnlyMode)
+	require.NoError(err)
+	require.NoError(r.Close())
+
+	_, err = os.Stat(filepath.Join(path, "library.yaml"))
+	require.True(os.IsNotExist(err))
+
+	lib, err = borges.Open("siva://" + path + "?bucket=2&transactional")
+	require.NoError(err)
+
+	_, err = lib.Get("gitserver.com/a", borges.ReadOnlyMode)
+	require.True(borges.ErrRepositoryNotExists.Is(err))
+}
+
+func TestOpen_SivaLayout(t *testing.T) {
+	require := require.New(t)
+
+	path, err := ioutil.TempDir("", "go-borges-open")
+	require.NoError(err)
+	defer os.RemoveAll(path)
+
+	tmp := filepath.Join(path, "tmp")
+	lib, err := borges.Open("siva://" + path +
+		"?layout=shard&levels=2&width=1&selector=hash&locations=1" +
+		"&transactional&tmp=" + tmp)
+	require.NoError(err)
+
+	r, err := lib.Init("github.com/foo/bar")
+	require.NoError(err)
+	require.Equal(borges.LocationID("0"), r.Location().ID())
+	require.NoError(r.Commit())
+
+	_, err = os.Stat(filepath.Join(path, "0", "-", "0.siva"))
+	require.NoError(err)
+
+	_, err = os.Stat(tmp)
+	require.NoError(err)
+}
+
+func TestOpen_Plain(t *testing.T) {
+	require := require.New(t)
+
+	path, err := ioutil.TempDir("", "go-borges-open")
+	require.NoError(err)
+	defer os.RemoveAll(path)
+
+	lib, err := borges.Open("plain://" + path + "?bare=true&transactional=true")
+	require.NoError(err)
+	require.IsType(&plain.Library{}, lib)
+	require.Equal(borges.LibraryID(filepath.Base(path)), lib.ID())
+
+	loc, err := lib.Location(borges.LocationID(filepath.Base(path)))
+	require.NoError(err)
+
+	r, err := loc.Init("github.com/foo/bar")
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	_, err = os.Stat(filepath.Join(path, "github.com", "foo", "bar", "HEAD"))
+	require.NoError(err)
+}
+
+func TestOpen_Errors(t *testing.T) {
+	require := require.New(t)
+
+	require.Contains(borges.Schemes(), "siva")
+	require.Contains(borges.Schemes(), "plain")
+
+	_, err := borges.Open("unknown:///data")
+	require.True(borges.ErrUnknownScheme.Is(err))
+
+	tests := []string{
+		"siva://host/data",
+		"siva://",
+		"siva:///data?unknown=1",
+		"siva:///data?rooted=maybe",
+		"siva:///data?bucket=two",
+		"siva:///data?timeout=soon",
+		"siva:///data?layout=tree",
+		"siva:///data?layout=shard&bucket=2",
+		"siva:///data?levels=2",
+		"siva:///data?selector=rootcommit",
+		"siva:///data?selector=size&max_size=-1",
+		"%gh",
+	}
+
+	for _, u := range tests {
+		_, err := borges.Open(u)
+		require.True(borges.ErrInvalidURL.Is(err), u)
+	}
+}
+
+func TestURLOptions(t *testing.T) {
+	require := require.New(t)
+
+	u, err := url.Parse("siva:data/lib?a=x&b&c=3&d=1m&e=false")
+	require.NoError(err)
+
+	path, err := borges.URLPath(u)
+	require.NoError(err)
+	require.Equal("data/lib", path)
+
+	o := borges.NewURLOptions(u)
+	require.Equal("x", o.String("a", ""))
+	require.True(o.Bool("b", false))
+	require.Equal(3, o.Int("c", 0))
+	require.Equal(time.Minute, o.Duration("d", 0))
+	require.Error(o.Err())
+
+	require.False(o.Bool("e", true))
+	require.Equal("def", o.String("missing", "def"))
+	require.NoError(o.Err())
+}
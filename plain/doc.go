@@ -0,0 +1,10 @@
+// Package plain implements borges.Library with git repositories stored as
+// directories in a billy.Filesystem, bare or with a working tree.
+//
+// Importing this package registers the "plain" scheme for borges.Open. The
+// path of the URL is used as a single location and the options are id and
+// location, by default the base name of the path, bare, transactional,
+// performance and timeout:
+//
+//	plain:///data/repos?bare=true&transactional=true
+package plain
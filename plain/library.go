@@ -24,6 +24,8 @@ type Library struct {
 	opts *LibraryOptions
 }
 
+var _ borges.ContextLibrary = (*Library)(nil)
+
 const (
 	timeout = 20 * time.Second
 )
@@ -70,17 +72,44 @@ func (l *Library) GetOrInit(borges.RepositoryID) (borges.Repository, error) {
 	return nil, borges.ErrNotImplemented.New()
 }
 
+// GetOrInitContext is not implemented. It honors the borges.ContextLibrary
+// interface.
+func (l *Library) GetOrInitContext(
+	context.Context,
+	borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
 // Init is not implemented. It honors the borges.Library interface.
 func (l *Library) Init(borges.RepositoryID) (borges.Repository, error) {
 	return nil, borges.ErrNotImplemented.New()
 }
 
+// InitContext is not implemented. It honors the borges.ContextLibrary
+// interface.
+func (l *Library) InitContext(
+	context.Context,
+	borges.RepositoryID,
+) (borges.Repository, error) {
+	return nil, borges.ErrNotImplemented.New()
+}
+
 // Has returns true, the LibraryID and the LocationID if the given RepositoryID
 // matches any repository at any location belonging to this Library.
 func (l *Library) Has(id borges.RepositoryID) (bool, borges.LibraryID, borges.LocationID, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.HasContext(ctx, id)
+}
+
+// HasContext is the context aware version of Has. It honors the
+// borges.ContextLibrary interface.
+func (l *Library) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
 	ok, loc, err := l.doHasOnLocations(ctx, id)
 	if err != nil {
 		return false, "", "", err
@@ -102,7 +131,7 @@ func (l *Library) doHasOnLocations(ctx context.Context, id borges.RepositoryID)
 		default:
 		}
 
-		ok, err := loc.Has(id)
+		ok, err := loc.HasContext(ctx, id)
 		if ok || err != nil {
 			return ok, loc, err
 		}
@@ -140,6 +169,16 @@ func (l *Library) Get(id borges.RepositoryID, m borges.Mode) (borges.Repository,
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.GetContext(ctx, id, m)
+}
+
+// GetContext is the context aware version of Get. It honors the
+// borges.ContextLibrary interface.
+func (l *Library) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	m borges.Mode,
+) (borges.Repository, error) {
 	r, err := l.doGetOnLocations(ctx, id, m)
 	if r != nil && err == nil {
 		return r, nil
@@ -160,7 +199,7 @@ func (l *Library) doGetOnLocations(ctx context.Context, id borges.RepositoryID,
 		default:
 		}
 
-		ok, err := loc.Has(id)
+		ok, err := loc.HasContext(ctx, id)
 		if err != nil {
 			return nil, err
 		}
@@ -211,6 +250,15 @@ func (l *Library) Repositories(
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.RepositoriesContext(ctx, mode)
+}
+
+// RepositoriesContext is the context aware version of Repositories. It honors
+// the borges.ContextLibrary interface.
+func (l *Library) RepositoriesContext(
+	ctx context.Context,
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
 	locs, err := mapLocationsToSlice(ctx, l.locs)
 	if err != nil {
 		return nil, err
@@ -240,6 +288,21 @@ func mapLocationsToSlice(
 // Location returns the a Location with the given ID, if exists, otherwise
 // ErrLocationNotExists is returned.
 func (l *Library) Location(id borges.LocationID) (borges.Location, error) {
+	return l.LocationContext(context.Background(), id)
+}
+
+// LocationContext is the context aware version of Location. It honors the
+// borges.ContextLibrary interface.
+func (l *Library) LocationContext(
+	ctx context.Context,
+	id borges.LocationID,
+) (borges.Location, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
 	loc, ok := l.locs[id]
 	if !ok {
 		return nil, borges.ErrLocationNotExists.New(id)
@@ -254,6 +317,14 @@ func (l *Library) Locations() (borges.LocationIterator, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
 	defer cancel()
 
+	return l.LocationsContext(ctx)
+}
+
+// LocationsContext is the context aware version of Locations. It honors the
+// borges.ContextLibrary interface.
+func (l *Library) LocationsContext(
+	ctx context.Context,
+) (borges.LocationIterator, error) {
 	locs, err := mapLocationsToSlice(ctx, l.locs)
 	if err != nil {
 		return nil, err
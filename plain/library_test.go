@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"testing"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/stretchr/testify/suite"
 	"gopkg.in/src-d/go-billy.v4/memfs"
 	"gopkg.in/src-d/go-billy.v4/osfs"
+	butil "gopkg.in/src-d/go-billy.v4/util"
 )
 
 func newLibrary(t *testing.T, name string, opts *LibraryOptions) *Library {
@@ -127,3 +129,83 @@ func TestTimeout(t *testing.T) {
 	_, _, _, err = lib.Has("baz")
 	req.EqualError(err, context.DeadlineExceeded.Error())
 }
+
+func TestContextCanceled(t *testing.T) {
+	var req = require.New(t)
+
+	lib := newLibrary(t, "test", &LibraryOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := lib.LocationsContext(ctx)
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = lib.RepositoriesContext(ctx, borges.ReadOnlyMode)
+	req.EqualError(err, context.Canceled.Error())
+
+	_, _, _, err = lib.HasContext(ctx, "github.com/test/bar")
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = lib.GetContext(ctx, "github.com/test/bar", borges.ReadOnlyMode)
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = lib.LocationContext(ctx, "test-bar")
+	req.EqualError(err, context.Canceled.Error())
+
+	l, err := lib.Location("test-bar")
+	req.NoError(err)
+
+	loc, ok := l.(borges.ContextLocation)
+	req.True(ok)
+
+	_, err = loc.HasContext(ctx, "github.com/test/bar")
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = loc.InitContext(ctx, "github.com/test/baz")
+	req.EqualError(err, context.Canceled.Error())
+
+	r, err := lib.GetContext(
+		context.Background(),
+		"github.com/test/bar",
+		borges.ReadOnlyMode,
+	)
+	req.NoError(err)
+	req.Equal(borges.LocationID("test-bar"), r.Location().ID())
+}
+
+func TestVerify(t *testing.T) {
+	require := require.New(t)
+
+	loc := newLocationWithFixtures(require, nil)
+	lib := NewLibrary("test", &LibraryOptions{})
+	lib.AddLocation(loc)
+
+	opts := &borges.VerifyOptions{Objects: true}
+	report, err := borges.Verify(context.Background(), lib, opts)
+	require.NoError(err)
+	require.True(report.OK())
+	require.Len(report.Locations, 1)
+	require.Len(report.Locations[0].Repositories, 1)
+	require.Equal(
+		borges.RepositoryID("basic.git"),
+		report.Locations[0].Repositories[0].ID,
+	)
+
+	packs, err := butil.Glob(loc.fs, "basic.git/objects/pack/*.pack")
+	require.NoError(err)
+	require.Len(packs, 1)
+
+	f, err := loc.fs.OpenFile(packs[0], os.O_RDWR, 0666)
+	require.NoError(err)
+	stat, err := loc.fs.Stat(packs[0])
+	require.NoError(err)
+	require.NoError(f.Truncate(stat.Size() / 2))
+	require.NoError(f.Close())
+
+	report, err = borges.Verify(context.Background(), lib, opts)
+	require.NoError(err)
+	require.False(report.OK())
+	require.Empty(report.Locations[0].Errors)
+	require.NotEmpty(report.Locations[0].Repositories[0].Errors)
+}
@@ -1,6 +1,7 @@
 package plain
 
 import (
+	"context"
 	"io"
 	"os"
 
@@ -10,6 +11,7 @@ import (
 
 	"gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/memfs"
+	butil "gopkg.in/src-d/go-billy.v4/util"
 )
 
 // LocationOptions contains configuration options for a plain.Location.
@@ -49,6 +51,11 @@ type Location struct {
 	opts *LocationOptions
 }
 
+var (
+	_ borges.ContextLocation = (*Location)(nil)
+	_ borges.RemoverLocation = (*Location)(nil)
+)
+
 // NewLocation returns a new Location based on the given ID and Filesystem with
 // the given LocationOptions.
 func NewLocation(id borges.LocationID, fs billy.Filesystem, options *LocationOptions) (*Location, error) {
@@ -79,21 +86,37 @@ func (l *Location) Library() borges.Library {
 // GetOrInit get the requested repository based on the given id, or inits a
 // new repository. If the repository is opened this will be done in RWMode.
 func (l *Location) GetOrInit(id borges.RepositoryID) (borges.Repository, error) {
-	has, err := l.Has(id)
+	return l.GetOrInitContext(context.Background(), id)
+}
+
+// GetOrInitContext is the context aware version of GetOrInit.
+func (l *Location) GetOrInitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	has, err := l.HasContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
 	if has {
-		return l.Get(id, borges.RWMode)
+		return l.GetContext(ctx, id, borges.RWMode)
 	}
 
-	return l.Init(id)
+	return l.InitContext(ctx, id)
 }
 
 // Init initializes a new Repository at this Location.
 func (l *Location) Init(id borges.RepositoryID) (borges.Repository, error) {
-	has, err := l.Has(id)
+	return l.InitContext(context.Background(), id)
+}
+
+// InitContext is the context aware version of Init.
+func (l *Location) InitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	has, err := l.HasContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +131,20 @@ func (l *Location) Init(id borges.RepositoryID) (borges.Repository, error) {
 // Has returns true if the given RepositoryID matches any repository at this
 // location.
 func (l *Location) Has(id borges.RepositoryID) (bool, error) {
+	return l.HasContext(context.Background(), id)
+}
+
+// HasContext is the context aware version of Has.
+func (l *Location) HasContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+	}
+
 	_, err := l.fs.Stat(l.RepositoryPath(id))
 	if err == nil {
 		return true, nil
@@ -124,7 +161,16 @@ func (l *Location) Has(id borges.RepositoryID) (bool, error) {
 // perform any read operation. If a repository with the given RepositoryID
 // already exists ErrRepositoryExists is returned.
 func (l *Location) Get(id borges.RepositoryID, mode borges.Mode) (borges.Repository, error) {
-	has, err := l.Has(id)
+	return l.GetContext(context.Background(), id, mode)
+}
+
+// GetContext is the context aware version of Get.
+func (l *Location) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	has, err := l.HasContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -136,6 +182,21 @@ func (l *Location) Get(id borges.RepositoryID, mode borges.Mode) (borges.Reposit
 	return openRepository(l, id, mode)
 }
 
+// Remove deletes the directory of the repository with the given
+// RepositoryID, including its working tree when the location is not bare.
+func (l *Location) Remove(id borges.RepositoryID) error {
+	has, err := l.Has(id)
+	if err != nil {
+		return err
+	}
+
+	if !has {
+		return borges.ErrRepositoryNotExists.New(id)
+	}
+
+	return butil.RemoveAll(l.fs, id.String())
+}
+
 // RepositoryPath returns the location in the filesystem for a given RepositoryID.
 func (l *Location) RepositoryPath(id borges.RepositoryID) string {
 	if l.opts.Bare {
@@ -148,6 +209,20 @@ func (l *Location) RepositoryPath(id borges.RepositoryID) string {
 // Repositories returns a RepositoryIterator that iterates through all the
 // repositories contained in this Location.
 func (l *Location) Repositories(m borges.Mode) (borges.RepositoryIterator, error) {
+	return l.RepositoriesContext(context.Background(), m)
+}
+
+// RepositoriesContext is the context aware version of Repositories.
+func (l *Location) RepositoriesContext(
+	ctx context.Context,
+	m borges.Mode,
+) (borges.RepositoryIterator, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
 	return NewLocationIterator(l, m)
 }
 
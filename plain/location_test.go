@@ -348,3 +348,28 @@ func TestLocationCache(t *testing.T) {
 	_, ok = c.Get(hash)
 	require.True(ok, "object should be in cache")
 }
+
+func TestLocation_Remove(t *testing.T) {
+	require := require.New(t)
+
+	for _, bare := range []bool{false, true} {
+		fs := memfs.New()
+		location, err := NewLocation("foo", fs, &LocationOptions{Bare: bare})
+		require.NoError(err)
+
+		_, err = location.Init("github.com/foo/bar")
+		require.NoError(err)
+
+		err = location.Remove("github.com/foo/qux")
+		require.True(borges.ErrRepositoryNotExists.Is(err))
+
+		require.NoError(location.Remove("github.com/foo/bar"))
+
+		has, err := location.Has("github.com/foo/bar")
+		require.NoError(err)
+		require.False(has)
+
+		_, err = fs.Stat("github.com/foo/bar")
+		require.Error(err)
+	}
+}
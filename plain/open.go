@@ -0,0 +1,51 @@
+package plain
+
+import (
+	"net/url"
+	"path/filepath"
+
+	borges "github.com/src-d/go-borges"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+func init() {
+	borges.Register("plain", open)
+}
+
+// open is the borges.Opener of the "plain" scheme described in the package
+// documentation.
+func open(u *url.URL) (borges.Library, error) {
+	path, err := borges.URLPath(u)
+	if err != nil {
+		return nil, err
+	}
+
+	base := filepath.Base(path)
+
+	o := borges.NewURLOptions(u)
+	id := o.String("id", base)
+	locID := o.String("location", base)
+	libOpts := &LibraryOptions{
+		Timeout: o.Duration("timeout", 0),
+	}
+	locOpts := &LocationOptions{
+		Bare:          o.Bool("bare", false),
+		Transactional: o.Bool("transactional", false),
+		Performance:   o.Bool("performance", false),
+	}
+
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+
+	loc, err := NewLocation(borges.LocationID(locID), osfs.New(path), locOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	lib := NewLibrary(borges.LibraryID(id), libOpts)
+	lib.AddLocation(loc)
+
+	return lib, nil
+}
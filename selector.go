@@ -0,0 +1,41 @@
+package borges
+
+import (
+	"context"
+
+	"gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrInvalidLocationID is returned when a LocationSelector returns an empty
+// location ID.
+var ErrInvalidLocationID = errors.NewKind("invalid location ID for repository %s")
+
+// LocationSelector chooses the location where a new repository is
+// initialized by Library.Init and Library.GetOrInit in the libraries that
+// support it.
+type LocationSelector interface {
+	// SelectLocation returns the ID of the location where the repository
+	// with the given ID will be created. The location can be a new one.
+	SelectLocation(
+		ctx context.Context,
+		lib Library,
+		id RepositoryID,
+	) (LocationID, error)
+}
+
+// LocationSelectorFunc is an adapter to use ordinary functions as
+// LocationSelector.
+type LocationSelectorFunc func(
+	context.Context,
+	Library,
+	RepositoryID,
+) (LocationID, error)
+
+// SelectLocation implements the LocationSelector interface.
+func (f LocationSelectorFunc) SelectLocation(
+	ctx context.Context,
+	lib Library,
+	id RepositoryID,
+) (LocationID, error) {
+	return f(ctx, lib, id)
+}
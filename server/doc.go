@@ -0,0 +1,37 @@
+/*
+
+Package server serves the repositories of a go-borges library to git clients.
+
+Handler is an http.Handler implementing the git smart HTTP protocol. It
+resolves "<id>/info/refs" and "<id>/git-upload-pack" requests opening the
+repository with that ID in borges.ReadOnlyMode, so it can be cloned and
+fetched but not pushed. For example, to serve a siva library where each
+remote of the rooted repositories is shown as a standalone repository:
+
+	lib, err := siva.NewLibrary("library", fs, &siva.LibraryOptions{
+		RootedRepo: true,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	http.ListenAndServe(":8080", server.NewHandler(lib))
+
+And then:
+
+	git clone http://localhost:8080/github.com/src-d/go-borges
+
+ServeUploadPack and ServeReceivePack speak the git pack protocol on a reader
+and a writer, usually stdin and stdout of a command forced for SSH
+connections. Pushes open the repository in borges.RWMode and are only
+committed when all the references are updated, so in transactional libraries
+they are atomic. In rooted libraries the pushed references are stored under
+"refs/remotes/<id>/".
+
+Only the objects reachable from the references of the requested repository
+are served, even if the storage is shared with other repositories like in
+rooted libraries. multi_ack is not supported so, like git-upload-pack without
+it, only the first object in common with the client is acknowledged.
+
+*/
+package server
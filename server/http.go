@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	borges "github.com/src-d/go-borges"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+)
+
+const (
+	infoRefsPath   = "/info/refs"
+	uploadPackPath = "/" + transport.UploadPackServiceName
+
+	advertisementContentType = "application/x-git-upload-pack-advertisement"
+	resultContentType        = "application/x-git-upload-pack-result"
+)
+
+// Handler is an http.Handler that serves the repositories of a
+// borges.Library using the git smart HTTP protocol. The path of the request
+// up to "/info/refs" or "/git-upload-pack" is the repository ID.
+//
+// Repositories are opened in borges.ReadOnlyMode so only fetch and clone
+// are supported. Libraries of rooted repositories, like siva with the
+// RootedRepo option, show each remote as a standalone repository.
+type Handler struct {
+	lib borges.Library
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// NewHandler creates a new Handler that serves the repositories of the
+// given library.
+func NewHandler(lib borges.Library) *Handler {
+	return &Handler{lib: lib}
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case strings.HasSuffix(path, infoRefsPath):
+		h.infoRefs(w, r, toRepoID(strings.TrimSuffix(path, infoRefsPath)))
+	case strings.HasSuffix(path, uploadPackPath):
+		h.uploadPack(w, r, toRepoID(strings.TrimSuffix(path, uploadPackPath)))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) infoRefs(
+	w http.ResponseWriter,
+	r *http.Request,
+	id borges.RepositoryID,
+) {
+	if r.Method != http.MethodGet {
+		httpError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	service := r.URL.Query().Get("service")
+	if service != transport.UploadPackServiceName {
+		http.Error(w,
+			fmt.Sprintf("service %q not supported", service),
+			http.StatusForbidden)
+		return
+	}
+
+	repo, sess, err := openUploadPack(h.lib, id)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+	defer repo.Close()
+
+	ar, err := sess.AdvertisedReferences()
+	if err != nil {
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+
+	ar.Prefix = [][]byte{
+		[]byte(fmt.Sprintf("# service=%s", service)),
+		pktline.Flush,
+	}
+
+	w.Header().Set("Content-Type", advertisementContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = ar.Encode(w)
+}
+
+func (h *Handler) uploadPack(
+	w http.ResponseWriter,
+	r *http.Request,
+	id borges.RepositoryID,
+) {
+	if r.Method != http.MethodPost {
+		httpError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			httpError(w, http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+
+		body = gz
+	}
+
+	req := packp.NewUploadPackRequest()
+	if err := req.Decode(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo, sess, err := openUploadPack(h.lib, id)
+	if err != nil {
+		repositoryError(w, r, err)
+		return
+	}
+	defer repo.Close()
+
+	ar, err := sess.AdvertisedReferences()
+	if err != nil {
+		httpError(w, http.StatusInternalServerError)
+		return
+	}
+
+	sto := repo.R().Storer
+	if err := checkWants(sto, ar, req.Wants); err != nil {
+		if ErrWantNotReachable.Is(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			httpError(w, http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	// the ACK and NAK lines are buffered so errors can still be reported
+	// with their status code
+	var out bytes.Buffer
+	done, acked, err := readHaves(body, &out, sto, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the client continues the negotiation in a new request
+	if !done {
+		writeResult(w, out.Bytes())
+		return
+	}
+
+	resp, err := sess.UploadPack(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer resp.Close()
+
+	writeResult(w, out.Bytes())
+	_ = encodeResponse(w, resp, acked)
+}
+
+func writeResult(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", resultContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(data)
+}
+
+func repositoryError(w http.ResponseWriter, r *http.Request, err error) {
+	if borges.ErrRepositoryNotExists.Is(err) {
+		http.NotFound(w, r)
+		return
+	}
+
+	httpError(w, http.StatusInternalServerError)
+}
+
+func httpError(w http.ResponseWriter, code int) {
+	http.Error(w, http.StatusText(code), code)
+}
+
+func toRepoID(path string) borges.RepositoryID {
+	return borges.RepositoryID(strings.Trim(path, "/"))
+}
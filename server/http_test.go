@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/src-d/go-borges/siva"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+const rootedSiva = "../_testdata/rooted/cf2e799463e1a00dbd1addd2003b0c7db31dbfe2.siva"
+
+func setupLibrary(t *testing.T) *siva.Library {
+	t.Helper()
+	require := require.New(t)
+
+	data, err := ioutil.ReadFile(rootedSiva)
+	require.NoError(err)
+
+	fs := memfs.New()
+	err = util.WriteFile(fs, filepath.Base(rootedSiva), data, 0666)
+	require.NoError(err)
+
+	lib, err := siva.NewLibrary("test", fs, &siva.LibraryOptions{
+		RootedRepo: true,
+	})
+	require.NoError(err)
+
+	return lib
+}
+
+func TestHandler(t *testing.T) {
+	require := require.New(t)
+
+	srv := httptest.NewServer(NewHandler(setupLibrary(t)))
+	defer srv.Close()
+
+	r, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL: srv.URL + "/gitserver.com/a",
+	})
+	require.NoError(err)
+
+	var refs []string
+	iter, err := r.References()
+	require.NoError(err)
+	require.NoError(iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() != plumbing.HEAD {
+			refs = append(refs, ref.String())
+		}
+		return nil
+	}))
+
+	// only the references of gitserver.com/a are cloned
+	require.ElementsMatch([]string{
+		"e09387d4fb5e8ac82494955d03733a63f1936cd9 refs/heads/fix",
+		"4debba8a88e808bdef8364026db890c5cb2900de refs/remotes/origin/master",
+		"e09387d4fb5e8ac82494955d03733a63f1936cd9 refs/remotes/origin/fix",
+	}, refs)
+
+	commits, err := r.Log(&git.LogOptions{})
+	require.NoError(err)
+	require.NoError(commits.ForEach(func(c *object.Commit) error {
+		return nil
+	}))
+
+	err = r.Fetch(&git.FetchOptions{})
+	require.Equal(git.NoErrAlreadyUpToDate, err)
+
+	_, err = git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL: srv.URL + "/gitserver.com/missing",
+	})
+	require.Equal(transport.ErrRepositoryNotFound, err)
+}
+
+func TestHandler_Errors(t *testing.T) {
+	h := NewHandler(setupLibrary(t))
+
+	tests := []struct {
+		method string
+		url    string
+		code   int
+	}{
+		{"GET", "/gitserver.com/a/info/refs?service=git-receive-pack", http.StatusForbidden},
+		{"GET", "/gitserver.com/a/info/refs", http.StatusForbidden},
+		{"POST", "/gitserver.com/a/info/refs?service=git-upload-pack", http.StatusMethodNotAllowed},
+		{"GET", "/gitserver.com/a/git-upload-pack", http.StatusMethodNotAllowed},
+		{"POST", "/gitserver.com/a/git-receive-pack", http.StatusNotFound},
+		{"GET", "/gitserver.com/a/HEAD", http.StatusNotFound},
+		{"GET", "/gitserver.com/a/info/refs?service=git-upload-pack", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.url, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.url, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			require.Equal(t, test.code, w.Code)
+		})
+	}
+}
+
+func TestHandler_Negotiation(t *testing.T) {
+	require := require.New(t)
+
+	h := NewHandler(setupLibrary(t))
+
+	want := plumbing.NewHash("4debba8a88e808bdef8364026db890c5cb2900de")
+	have := plumbing.NewHash("e09387d4fb5e8ac82494955d03733a63f1936cd9")
+	unknown := plumbing.NewHash("0000000000000000000000000000000000000001")
+
+	request := func(
+		want, have plumbing.Hash,
+		done bool,
+	) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		e := pktline.NewEncoder(&body)
+		require.NoError(e.Encodef("want %s\n", want))
+		require.NoError(e.Flush())
+		require.NoError(e.Encodef("have %s\n", have))
+		require.NoError(e.Flush())
+		if done {
+			require.NoError(e.EncodeString("done\n"))
+		}
+
+		req := httptest.NewRequest("POST", "/gitserver.com/a/git-upload-pack", &body)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		return w
+	}
+
+	// without done the client continues the negotiation in a new request
+	w := request(want, unknown, false)
+	require.Equal(http.StatusOK, w.Code)
+	require.Equal(resultContentType, w.Header().Get("Content-Type"))
+	require.Equal("0008NAK\n", w.Body.String())
+
+	ack := fmt.Sprintf("0031ACK %s\n", have)
+	w = request(want, have, false)
+	require.Equal(http.StatusOK, w.Code)
+	require.Equal(ack, w.Body.String())
+
+	// the common object is acknowledged only once before the packfile
+	w = request(want, have, true)
+	require.Equal(http.StatusOK, w.Code)
+	require.True(strings.HasPrefix(w.Body.String(), ack+"PACK"))
+
+	// a NAK for the flush and another one for done
+	w = request(want, unknown, true)
+	require.Equal(http.StatusOK, w.Code)
+	require.True(strings.HasPrefix(w.Body.String(), "0008NAK\n0008NAK\nPACK"))
+
+	// master of gitserver.com/b is in the same siva file
+	w = request(masterB, unknown, true)
+	require.Equal(http.StatusBadRequest, w.Code)
+}
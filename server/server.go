@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	borges "github.com/src-d/go-borges"
+
+	errors "gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+)
+
+// ErrWantNotReachable is returned when an upload-pack request wants an
+// object that is not reachable from the references advertised for the
+// repository.
+var ErrWantNotReachable = errors.NewKind(
+	"want %s not reachable from the advertised references")
+
+// loader is a server.Loader that returns the storer of an already opened
+// repository whatever the endpoint is.
+type loader struct {
+	storer.Storer
+}
+
+var _ server.Loader = loader{}
+
+// Load implements server.Loader interface.
+func (l loader) Load(*transport.Endpoint) (storer.Storer, error) {
+	return l.Storer, nil
+}
+
+// openUploadPack opens the repository in read only mode and creates an
+// upload-pack session for it. The repository must be closed once the
+// session is finished.
+func openUploadPack(
+	lib borges.Library,
+	id borges.RepositoryID,
+) (borges.Repository, transport.UploadPackSession, error) {
+	repo, err := lib.Get(id, borges.ReadOnlyMode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	srv := server.NewServer(loader{repo.R().Storer})
+	sess, err := srv.NewUploadPackSession(nil, nil)
+	if err != nil {
+		_ = repo.Close()
+		return nil, nil, err
+	}
+
+	return repo, sess, nil
+}
+
+// checkWants returns ErrWantNotReachable if any of the wants is not an
+// advertised reference or a commit or tag reachable from them. Rooted
+// repositories share the storer with the rest of the repositories of their
+// location so it may contain objects that must not be served.
+func checkWants(
+	sto storer.EncodedObjectStorer,
+	ar *packp.AdvRefs,
+	wants []plumbing.Hash,
+) error {
+	pending := make(map[plumbing.Hash]struct{}, len(wants))
+	for _, h := range wants {
+		pending[h] = struct{}{}
+	}
+
+	var tips []plumbing.Hash
+	if ar.Head != nil {
+		tips = append(tips, *ar.Head)
+	}
+
+	for _, h := range ar.References {
+		tips = append(tips, h)
+	}
+
+	for _, h := range ar.Peeled {
+		tips = append(tips, h)
+	}
+
+	// wants are usually advertised references so they are checked before
+	// walking the history
+	for _, h := range tips {
+		delete(pending, h)
+	}
+
+	seen := make(map[plumbing.Hash]struct{})
+	for len(tips) > 0 && len(pending) > 0 {
+		h := tips[len(tips)-1]
+		tips = tips[:len(tips)-1]
+
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+		delete(pending, h)
+
+		obj, err := sto.EncodedObject(plumbing.AnyObject, h)
+		if err == plumbing.ErrObjectNotFound {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch obj.Type() {
+		case plumbing.CommitObject:
+			c, err := object.DecodeCommit(sto, obj)
+			if err != nil {
+				return err
+			}
+
+			tips = append(tips, c.ParentHashes...)
+		case plumbing.TagObject:
+			t, err := object.DecodeTag(sto, obj)
+			if err != nil {
+				return err
+			}
+
+			tips = append(tips, t.Target)
+		}
+	}
+
+	for _, h := range wants {
+		if _, ok := pending[h]; ok {
+			return ErrWantNotReachable.New(h)
+		}
+	}
+
+	return nil
+}
+
+// readHaves reads the haves sent after the wants of an upload-pack request
+// until "done" or the end of the request and returns true if "done" was
+// received. Objects not found in the storer can't be common with the client
+// and are skipped.
+//
+// multi_ack is not supported so, like git-upload-pack without it, only the
+// first common object is acknowledged as soon as it's found and a NAK is
+// written for each flush while there is none. It also returns true if the
+// ACK was written, then the response to "done" must not have another one.
+func readHaves(
+	r io.Reader,
+	w io.Writer,
+	sto storer.EncodedObjectStorer,
+	req *packp.UploadPackRequest,
+) (done, acked bool, err error) {
+	e := pktline.NewEncoder(w)
+	s := pktline.NewScanner(r)
+	for s.Scan() {
+		line := bytes.TrimSuffix(s.Bytes(), []byte("\n"))
+		switch {
+		case len(line) == 0:
+			if acked {
+				continue
+			}
+
+			if err := e.EncodeString("NAK\n"); err != nil {
+				return false, acked, err
+			}
+		case bytes.Equal(line, []byte("done")):
+			return true, acked, nil
+		case bytes.HasPrefix(line, []byte("have ")):
+			hash := plumbing.NewHash(string(line[len("have "):]))
+			if sto.HasEncodedObject(hash) != nil {
+				continue
+			}
+
+			req.Haves = append(req.Haves, hash)
+			if acked {
+				continue
+			}
+
+			if err := e.Encodef("ACK %s\n", hash); err != nil {
+				return false, acked, err
+			}
+
+			acked = true
+		default:
+			return false, acked, fmt.Errorf("unexpected line %q", line)
+		}
+	}
+
+	return false, acked, s.Err()
+}
+
+// encodeResponse writes the upload-pack response to w. The ACK or NAK
+// before the packfile is skipped if the common object was already
+// acknowledged while reading the haves.
+func encodeResponse(
+	w io.Writer,
+	resp *packp.UploadPackResponse,
+	acked bool,
+) error {
+	if !acked {
+		return resp.Encode(w)
+	}
+
+	_, err := io.Copy(w, resp)
+	return err
+}
+
+// endOfRequest returns true when the client finished the session sending a
+// flush or closing the connection instead of a request.
+func endOfRequest(r *bufio.Reader) (bool, error) {
+	b, err := r.Peek(len(pktline.FlushPkt))
+	if err == io.EOF {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if bytes.Equal(b, pktline.FlushPkt) {
+		_, err = r.Discard(len(b))
+		return true, err
+	}
+
+	return false, nil
+}
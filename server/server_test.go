@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestReadHaves(t *testing.T) {
+	require := require.New(t)
+
+	sto := memory.NewStorage()
+	obj := sto.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	have, err := sto.SetEncodedObject(obj)
+	require.NoError(err)
+
+	unknown := plumbing.NewHash("e09387d4fb5e8ac82494955d03733a63f1936cd9")
+
+	var in bytes.Buffer
+	e := pktline.NewEncoder(&in)
+	require.NoError(e.Encodef("have %s\n", have))
+	require.NoError(e.Encodef("have %s\n", unknown))
+	require.NoError(e.Flush())
+	require.NoError(e.EncodeString("done\n"))
+
+	var out bytes.Buffer
+	req := packp.NewUploadPackRequest()
+	done, acked, err := readHaves(&in, &out, sto, req)
+	require.NoError(err)
+	require.True(done)
+	require.True(acked)
+	require.Equal([]plumbing.Hash{have}, req.Haves)
+	require.Equal(fmt.Sprintf("0031ACK %s\n", have), out.String())
+
+	// a NAK is written for each flush while there are no common objects
+	in.Reset()
+	out.Reset()
+	require.NoError(e.Encodef("have %s\n", unknown))
+	require.NoError(e.Flush())
+	require.NoError(e.Encodef("have %s\n", have))
+	require.NoError(e.Flush())
+	require.NoError(e.EncodeString("done\n"))
+
+	done, acked, err = readHaves(&in, &out, sto, packp.NewUploadPackRequest())
+	require.NoError(err)
+	require.True(done)
+	require.True(acked)
+	require.Equal(fmt.Sprintf("0008NAK\n0031ACK %s\n", have), out.String())
+
+	// stateless requests end without done
+	in.Reset()
+	out.Reset()
+	require.NoError(e.Encodef("have %s\n", unknown))
+	require.NoError(e.Flush())
+
+	done, acked, err = readHaves(&in, &out, sto, packp.NewUploadPackRequest())
+	require.NoError(err)
+	require.False(done)
+	require.False(acked)
+	require.Equal("0008NAK\n", out.String())
+
+	in.Reset()
+	require.NoError(e.EncodeString("deepen 1\n"))
+
+	_, _, err = readHaves(&in, &out, sto, packp.NewUploadPackRequest())
+	require.Error(err)
+}
+
+func TestCheckWants(t *testing.T) {
+	require := require.New(t)
+
+	repo, sess, err := openUploadPack(setupLibrary(t), "gitserver.com/a")
+	require.NoError(err)
+	defer repo.Close()
+
+	ar, err := sess.AdvertisedReferences()
+	require.NoError(err)
+
+	sto := repo.R().Storer
+	commit, err := object.GetCommit(sto, masterA)
+	require.NoError(err)
+	require.NotEmpty(commit.ParentHashes)
+
+	require.NoError(checkWants(sto, ar, []plumbing.Hash{masterA}))
+	require.NoError(checkWants(sto, ar, commit.ParentHashes))
+
+	// the objects of other repositories of the location are in the storer
+	_, err = object.GetCommit(sto, masterB)
+	require.NoError(err)
+
+	err = checkWants(sto, ar, []plumbing.Hash{masterA, masterB})
+	require.True(ErrWantNotReachable.Is(err))
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	borges "github.com/src-d/go-borges"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+)
+
+// ServeUploadPack serves a git-upload-pack session for the repository with
+// the given ID reading the client requests from r and writing the responses
+// to w, like git-upload-pack does with stdin and stdout. The repository is
+// opened in borges.ReadOnlyMode.
+func ServeUploadPack(
+	ctx context.Context,
+	lib borges.Library,
+	id borges.RepositoryID,
+	r io.Reader,
+	w io.Writer,
+) error {
+	repo, sess, err := openUploadPack(lib, id)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	ar, err := sess.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+
+	if err := ar.Encode(w); err != nil {
+		return err
+	}
+
+	in := bufio.NewReader(r)
+	end, err := endOfRequest(in)
+	if err != nil || end {
+		return err
+	}
+
+	req := packp.NewUploadPackRequest()
+	if err := req.Decode(in); err != nil {
+		return err
+	}
+
+	sto := repo.R().Storer
+	if err := checkWants(sto, ar, req.Wants); err != nil {
+		return err
+	}
+
+	done, acked, err := readHaves(in, w, sto, req)
+	if err != nil {
+		return err
+	}
+
+	if !done {
+		return io.ErrUnexpectedEOF
+	}
+
+	resp, err := sess.UploadPack(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	return encodeResponse(w, resp, acked)
+}
+
+// ServeReceivePack serves a git-receive-pack session for the repository
+// with the given ID reading the client requests from r and writing the
+// responses to w, like git-receive-pack does with stdin and stdout.
+//
+// The repository is opened in borges.RWMode and the pushed changes are
+// committed once all the references are updated. If any of them fails
+// nothing is committed and every reference is reported as failed. For
+// libraries of rooted repositories, like siva with the RootedRepo option,
+// the references are stored under "refs/remotes/<id>/".
+func ServeReceivePack(
+	ctx context.Context,
+	lib borges.Library,
+	id borges.RepositoryID,
+	r io.Reader,
+	w io.Writer,
+) error {
+	repo, err := lib.Get(id, borges.RWMode)
+	if err != nil {
+		return err
+	}
+
+	srv := server.NewServer(loader{repo.R().Storer})
+	sess, err := srv.NewReceivePackSession(nil, nil)
+	if err != nil {
+		_ = repo.Close()
+		return err
+	}
+
+	ar, err := sess.AdvertisedReferences()
+	if err == nil {
+		err = ar.Encode(w)
+	}
+
+	if err != nil {
+		_ = repo.Close()
+		return err
+	}
+
+	in := bufio.NewReader(r)
+	end, err := endOfRequest(in)
+	if err != nil || end {
+		_ = repo.Close()
+		return err
+	}
+
+	req := packp.NewReferenceUpdateRequest()
+	if err := req.Decode(in); err != nil {
+		_ = repo.Close()
+		return err
+	}
+
+	rs, err := sess.ReceivePack(ctx, req)
+	if err != nil {
+		_ = repo.Close()
+	} else {
+		err = commit(repo)
+	}
+
+	if rs == nil {
+		return err
+	}
+
+	if err != nil {
+		discardStatus(rs, err)
+	}
+
+	if eerr := rs.Encode(w); err == nil {
+		err = eerr
+	}
+
+	return err
+}
+
+// commit commits the repository. Repositories that don't support
+// transactions already have the changes written so they are only closed.
+func commit(repo borges.Repository) error {
+	err := repo.Commit()
+	if borges.ErrNonTransactional.Is(err) {
+		return repo.Close()
+	}
+
+	return err
+}
+
+// discardStatus reports as failed the commands that succeeded as their
+// changes were not committed.
+func discardStatus(rs *packp.ReportStatus, err error) {
+	for _, s := range rs.CommandStatuses {
+		if s.Status == "ok" {
+			s.Status = fmt.Sprintf("not committed: %s", err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/siva"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/pktline"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+var (
+	masterA = plumbing.NewHash("4debba8a88e808bdef8364026db890c5cb2900de")
+	masterB = plumbing.NewHash("8c46128f7f8dca511321eb58940da6138a42ab42")
+)
+
+func TestServeUploadPack(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	lib := setupLibrary(t)
+
+	req := packp.NewUploadPackRequest()
+	req.Wants = []plumbing.Hash{masterA}
+
+	var in bytes.Buffer
+	require.NoError(req.UploadRequest.Encode(&in))
+	require.NoError(pktline.NewEncoder(&in).EncodeString("done\n"))
+
+	var out bytes.Buffer
+	err := ServeUploadPack(ctx, lib, "gitserver.com/a", &in, &out)
+	require.NoError(err)
+
+	ar := packp.NewAdvRefs()
+	require.NoError(ar.Decode(&out))
+	require.Equal(masterA, ar.References["refs/heads/master"])
+	require.NotContains(ar.References, "refs/heads/css")
+
+	resp := packp.NewUploadPackResponse(req)
+	require.NoError(resp.Decode(ioutil.NopCloser(&out)))
+
+	sto := memory.NewStorage()
+	require.NoError(packfile.UpdateObjectStorage(sto, resp))
+
+	commit, err := object.GetCommit(sto, masterA)
+	require.NoError(err)
+	require.Equal("add more stuff\n", commit.Message)
+
+	// the client ends the session without requesting objects
+	in.Reset()
+	out.Reset()
+	require.NoError(pktline.NewEncoder(&in).Flush())
+
+	err = ServeUploadPack(ctx, lib, "gitserver.com/a", &in, &out)
+	require.NoError(err)
+
+	err = ServeUploadPack(ctx, lib, "gitserver.com/missing", &in, &out)
+	require.True(borges.ErrRepositoryNotExists.Is(err))
+
+	// master of gitserver.com/b is in the same siva file
+	req.Wants = []plumbing.Hash{masterB}
+	in.Reset()
+	require.NoError(req.UploadRequest.Encode(&in))
+	require.NoError(pktline.NewEncoder(&in).EncodeString("done\n"))
+
+	err = ServeUploadPack(ctx, lib, "gitserver.com/a", &in, &out)
+	require.True(ErrWantNotReachable.Is(err))
+}
+
+func TestServeReceivePack(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	fs := memfs.New()
+	data, err := ioutil.ReadFile(rootedSiva)
+	require.NoError(err)
+	require.NoError(util.WriteFile(fs, "loc.siva", data, 0666))
+
+	lib, err := siva.NewLibrary("test", fs, &siva.LibraryOptions{
+		RootedRepo:    true,
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	// new commit on top of master in a client repository
+	client := memory.NewStorage()
+	tree := &object.Tree{}
+	obj := client.NewEncodedObject()
+	require.NoError(tree.Encode(obj))
+	treeHash, err := client.SetEncodedObject(obj)
+	require.NoError(err)
+
+	sig := object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	c := &object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      "pushed",
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{masterA},
+	}
+	obj = client.NewEncodedObject()
+	require.NoError(c.Encode(obj))
+	pushed, err := client.SetEncodedObject(obj)
+	require.NoError(err)
+
+	push := func(cmds ...*packp.Command) *packp.ReportStatus {
+		t.Helper()
+
+		var pack bytes.Buffer
+		_, err := packfile.NewEncoder(&pack, client, false).
+			Encode([]plumbing.Hash{pushed, treeHash}, 10)
+		require.NoError(err)
+
+		req := packp.NewReferenceUpdateRequest()
+		require.NoError(req.Capabilities.Set(capability.ReportStatus))
+		req.Commands = cmds
+		req.Packfile = ioutil.NopCloser(&pack)
+
+		var in, out bytes.Buffer
+		require.NoError(req.Encode(&in))
+
+		err = ServeReceivePack(ctx, lib, "gitserver.com/a", &in, &out)
+
+		ar := packp.NewAdvRefs()
+		require.NoError(ar.Decode(&out))
+
+		rs := packp.NewReportStatus()
+		require.NoError(rs.Decode(&out))
+		require.Equal(err == nil, rs.Error() == nil)
+
+		return rs
+	}
+
+	// a failed command discards the whole push
+	rs := push(
+		&packp.Command{Name: "refs/heads/new", New: pushed},
+		&packp.Command{Name: "refs/heads/master", New: pushed},
+	)
+	require.Error(rs.Error())
+	for _, s := range rs.CommandStatuses {
+		require.NotEqual("ok", s.Status)
+	}
+
+	requireRefs(t, lib, map[plumbing.ReferenceName]plumbing.Hash{
+		"refs/heads/master": masterA,
+	})
+
+	rs = push(
+		&packp.Command{Name: "refs/heads/new", New: pushed},
+		&packp.Command{Name: "refs/heads/master", Old: masterA, New: pushed},
+	)
+	require.NoError(rs.Error())
+
+	requireRefs(t, lib, map[plumbing.ReferenceName]plumbing.Hash{
+		"refs/heads/master": pushed,
+		"refs/heads/new":    pushed,
+	})
+
+	// the references are written under the remote of the repository
+	lib, err = siva.NewLibrary("test", fs, nil)
+	require.NoError(err)
+
+	r, err := lib.Get("gitserver.com/a", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	ref, err := r.R().Reference("refs/remotes/gitserver.com/a/heads/new", false)
+	require.NoError(err)
+	require.Equal(pushed, ref.Hash())
+
+	ref, err = r.R().Reference("refs/remotes/gitserver.com/b/heads/master", false)
+	require.NoError(err)
+	require.Equal(masterB, ref.Hash())
+}
+
+func requireRefs(
+	t *testing.T,
+	lib borges.Library,
+	refs map[plumbing.ReferenceName]plumbing.Hash,
+) {
+	t.Helper()
+	require := require.New(t)
+
+	r, err := lib.Get("gitserver.com/a", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	for name, hash := range refs {
+		ref, err := r.R().Reference(name, false)
+		require.NoError(err)
+		require.Equal(hash, ref.Hash(), name)
+	}
+
+	_, err = object.GetCommit(r.R().Storer, refs["refs/heads/master"])
+	require.NoError(err)
+}
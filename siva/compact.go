@@ -0,0 +1,672 @@
+package siva
+
+import (
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	sivafs "gopkg.in/src-d/go-billy-siva.v4"
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/idxfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+	siva "gopkg.in/src-d/go-siva.v1"
+)
+
+const (
+	compactExtension = ".compact"
+	packPrefix       = "objects/pack/pack-"
+	packWindow       = 10
+)
+
+// CompactOptions contains configuration options for Location.Compact.
+type CompactOptions struct {
+	// Prune also removes the objects that are not reachable from the
+	// references of the location or any of its versions. Packfiles
+	// containing unreachable objects are rewritten.
+	Prune bool
+}
+
+// Compact rewrites the siva file of the location keeping only the last
+// entry of each file. Every version in the location metadata is kept as a
+// separate block so it can still be read and its offset is updated. The new
+// file is written next to the current one and renamed once finished so
+// readers never observe a partially written file.
+//
+// The location transaction is held while compacting and any unfinished
+// transaction is rolled back first using the checkpoint. In non
+// transactional mode the caller must ensure there are no writers.
+func (l *Location) Compact(options *CompactOptions) error {
+	opts := &CompactOptions{}
+	if options != nil {
+		o := *options
+		opts = &o
+	}
+
+	if err := l.txer.Start(); err != nil {
+		return err
+	}
+	defer l.txer.Stop()
+
+	return l.compact(opts)
+}
+
+// compact does the compaction of the location. Must be called with the
+// location transaction held.
+func (l *Location) compact(opts *CompactOptions) error {
+	if _, err := l.recoverCheckpoint(); err != nil {
+		return err
+	}
+
+	stat, err := l.lib.fs.Stat(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c, err := newCompaction(l, uint64(stat.Size()))
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	if opts.Prune {
+		if err := c.prune(); err != nil {
+			return err
+		}
+	}
+
+	tmp := l.path + compactExtension
+	defer cleanup(l.lib.fs, tmp)
+
+	offsets, err := c.write(tmp)
+	if err != nil {
+		return err
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if err := l.lib.fs.Rename(tmp, l.path); err != nil {
+		return err
+	}
+
+	cp, err := newCheckpoint(l.lib.fs, l.path, false)
+	if err != nil {
+		return err
+	}
+
+	// force the references and config cache to be reloaded
+	l.checkpoint = cp
+	l.fSize = -1
+
+	// the offsets are saved once the file is replaced so readers never
+	// apply them to the old file. The previous ones are no longer valid, if
+	// the save fails the new ones are kept to be written with the next
+	// metadata save.
+	return l.updateVersionOffsets(offsets)
+}
+
+// updateVersionOffsets changes and saves the offsets of the location
+// versions to the ones in the compacted file. Must be called with the
+// location lock held.
+func (l *Location) updateVersionOffsets(offsets map[uint64]uint64) error {
+	if l.metadata == nil || len(l.metadata.Versions) == 0 {
+		return nil
+	}
+
+	var nums []int
+	for n := range l.metadata.Versions {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+
+	var prev uint64
+	for _, n := range nums {
+		v := l.metadata.Versions[n]
+		offset, ok := offsets[v.Offset]
+		if !ok {
+			continue
+		}
+
+		size := offset + 1
+		if prev > 0 {
+			size = offset - prev
+		}
+
+		l.metadata.setVersion(n, &Version{Offset: offset, Size: size})
+		prev = offset
+	}
+
+	return l.metadata.save()
+}
+
+// compactEntry is a file from one of the states of the siva file.
+type compactEntry struct {
+	siva.Header
+	size uint64
+	crc  uint32
+	open func() (io.ReadCloser, error)
+}
+
+func (e *compactEntry) equal(o *compactEntry) bool {
+	return e.Name == o.Name && e.Mode == o.Mode &&
+		e.ModTime.Equal(o.ModTime) && e.size == o.size && e.crc == o.crc
+}
+
+// compaction holds the states of a siva file that are kept when it's
+// compacted. There's one state for each version offset and one for the end
+// of the file.
+type compaction struct {
+	loc     *Location
+	f       billy.File
+	offsets []uint64
+	states  [][]*compactEntry
+	tmp     []string
+}
+
+func newCompaction(l *Location, size uint64) (*compaction, error) {
+	f, err := l.lib.fs.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compaction{loc: l, f: f}
+
+	c.offsets = l.versionOffsets(size)
+	for _, offset := range c.offsets {
+		state, err := c.state(offset)
+		if err != nil {
+			c.close()
+			return nil, err
+		}
+
+		c.states = append(c.states, state)
+	}
+
+	return c, nil
+}
+
+// versionOffsets returns the sorted offsets of the location versions that
+// are not greater than size, including size.
+func (l *Location) versionOffsets(size uint64) []uint64 {
+	seen := map[uint64]struct{}{size: {}}
+	offsets := []uint64{size}
+	if l.metadata != nil {
+		for _, v := range l.metadata.Versions {
+			if _, ok := seen[v.Offset]; ok || v.Offset == 0 || v.Offset > size {
+				continue
+			}
+
+			seen[v.Offset] = struct{}{}
+			offsets = append(offsets, v.Offset)
+		}
+	}
+
+	sort.Slice(offsets, func(i, j int) bool {
+		return offsets[i] < offsets[j]
+	})
+
+	return offsets
+}
+
+func (c *compaction) state(offset uint64) ([]*compactEntry, error) {
+	r := siva.NewReaderWithOffset(c.f, offset)
+	index, err := r.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	state := make([]*compactEntry, 0, len(index))
+	for _, e := range index {
+		e := e
+		state = append(state, &compactEntry{
+			Header: e.Header,
+			size:   e.Size,
+			crc:    e.CRC32,
+			open: func() (io.ReadCloser, error) {
+				sr, err := r.Get(e)
+				if err != nil {
+					return nil, err
+				}
+
+				return nopCloser{sr}, nil
+			},
+		})
+	}
+
+	return state, nil
+}
+
+func (c *compaction) close() {
+	for _, t := range c.tmp {
+		_ = c.loc.lib.tmp.Remove(t)
+	}
+
+	_ = c.f.Close()
+}
+
+// prune removes from all the states the loose objects not reachable from
+// the references of any state. Packfiles with unreachable objects are
+// rewritten with only the reachable ones or removed if none is reachable.
+func (c *compaction) prune() error {
+	reachable := make(map[plumbing.Hash]struct{})
+	storers := make([]*filesystem.Storage, len(c.offsets))
+
+	// the filesystems are used by repack so they are closed at the end
+	var filesystems []sivafs.SivaFS
+	defer func() {
+		for _, fs := range filesystems {
+			_ = fs.Sync()
+		}
+	}()
+
+	for i, offset := range c.offsets {
+		fs, err := sivafs.NewFilesystemWithOptions(
+			c.loc.lib.fs, c.loc.path, memfs.New(),
+			sivafs.SivaFSOptions{
+				UnsafePaths: true,
+				ReadOnly:    true,
+				Offset:      offset,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		filesystems = append(filesystems, fs)
+
+		sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+		storers[i] = sto
+
+		hashes, err := referenceHashes(sto)
+		if err != nil {
+			return err
+		}
+
+		objs, err := revlist.Objects(sto, hashes, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, h := range objs {
+			reachable[h] = struct{}{}
+		}
+	}
+
+	replaced := make(map[string][]*compactEntry)
+	for i, state := range c.states {
+		var pruned []*compactEntry
+		for _, e := range state {
+			if h, ok := looseObjectHash(e.Name); ok {
+				if _, ok := reachable[h]; ok {
+					pruned = append(pruned, e)
+				}
+
+				continue
+			}
+
+			if !strings.HasPrefix(e.Name, packPrefix) {
+				pruned = append(pruned, e)
+				continue
+			}
+
+			base := strings.TrimSuffix(e.Name, path.Ext(e.Name))
+			entries, ok := replaced[base]
+			if !ok {
+				var err error
+				entries, err = c.repack(base, state, storers[i], reachable)
+				if err != nil {
+					return err
+				}
+
+				replaced[base] = entries
+			}
+
+			for _, r := range entries {
+				if path.Ext(r.Name) != path.Ext(e.Name) {
+					continue
+				}
+
+				n := *r
+				n.ModTime = e.ModTime
+				n.Mode = e.Mode
+				pruned = append(pruned, &n)
+			}
+		}
+
+		c.states[i] = pruned
+	}
+
+	return nil
+}
+
+// repack returns the entries that replace the packfile with the given base
+// name. If all its objects are reachable the original entries are returned,
+// if none is reachable nothing is returned, otherwise a new packfile with
+// the reachable objects is created.
+func (c *compaction) repack(
+	base string,
+	state []*compactEntry,
+	sto *filesystem.Storage,
+	reachable map[plumbing.Hash]struct{},
+) ([]*compactEntry, error) {
+	var original []*compactEntry
+	var idx *compactEntry
+	for _, e := range state {
+		if strings.TrimSuffix(e.Name, path.Ext(e.Name)) == base {
+			original = append(original, e)
+			if path.Ext(e.Name) == ".idx" {
+				idx = e
+			}
+		}
+	}
+
+	if idx == nil {
+		return original, nil
+	}
+
+	hashes, total, err := reachableInIndex(idx, reachable)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hashes) == total {
+		return original, nil
+	}
+
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	packFile, err := util.TempFile(c.loc.lib.tmp, "", "compact-pack")
+	if err != nil {
+		return nil, err
+	}
+	c.tmp = append(c.tmp, packFile.Name())
+
+	checksum, err := packfile.NewEncoder(packFile, sto, false).
+		Encode(hashes, packWindow)
+	if cErr := packFile.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	idxFile, err := util.TempFile(c.loc.lib.tmp, "", "compact-idx")
+	if err != nil {
+		return nil, err
+	}
+	c.tmp = append(c.tmp, idxFile.Name())
+
+	err = writePackIndex(c.loc.lib.tmp, packFile.Name(), idxFile)
+	if cErr := idxFile.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := packPrefix + checksum.String()
+	pack, err := c.tmpEntry(name+".pack", packFile.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := c.tmpEntry(name+".idx", idxFile.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	return []*compactEntry{pack, index}, nil
+}
+
+// tmpEntry creates a compactEntry with the contents of a file from the
+// temporary filesystem.
+func (c *compaction) tmpEntry(name, tmp string) (*compactEntry, error) {
+	f, err := c.loc.lib.tmp.Open(tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	crc := crc32.NewIEEE()
+	size, err := io.Copy(crc, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compactEntry{
+		Header: siva.Header{Name: name},
+		size:   uint64(size),
+		crc:    crc.Sum32(),
+		open: func() (io.ReadCloser, error) {
+			return c.loc.lib.tmp.Open(tmp)
+		},
+	}, nil
+}
+
+// write creates a new siva file in the given path with a block for each
+// state. It returns the mapping between the offsets of the original file and
+// the new one.
+func (c *compaction) write(p string) (map[uint64]uint64, error) {
+	f, err := c.loc.lib.fs.OpenFile(
+		p,
+		os.O_CREATE|os.O_TRUNC|os.O_WRONLY,
+		0666,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := c.writeStates(f)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return offsets, nil
+}
+
+func (c *compaction) writeStates(f io.Writer) (map[uint64]uint64, error) {
+	w := &countWriter{w: f}
+	offsets := make(map[uint64]uint64, len(c.offsets))
+	prev := make(map[string]*compactEntry)
+	for i, state := range c.states {
+		sw := siva.NewWriter(w)
+		current := make(map[string]*compactEntry, len(state))
+		for _, e := range state {
+			current[e.Name] = e
+			if p, ok := prev[e.Name]; ok && p.equal(e) {
+				continue
+			}
+
+			if err := writeEntry(sw, e); err != nil {
+				return nil, err
+			}
+		}
+
+		var deleted []string
+		for name := range prev {
+			if _, ok := current[name]; !ok {
+				deleted = append(deleted, name)
+			}
+		}
+		sort.Strings(deleted)
+
+		for _, name := range deleted {
+			err := sw.WriteHeader(&siva.Header{
+				Name:    name,
+				ModTime: prev[name].ModTime,
+				Flags:   siva.FlagDeleted,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if err := sw.Close(); err != nil {
+			return nil, err
+		}
+
+		offsets[c.offsets[i]] = w.n
+		prev = current
+	}
+
+	return offsets, nil
+}
+
+func writeEntry(w siva.Writer, e *compactEntry) error {
+	header := e.Header
+	if err := w.WriteHeader(&header); err != nil {
+		return err
+	}
+
+	r, err := e.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// referenceHashes returns the hashes pointed by the hash references of the
+// storage.
+func referenceHashes(sto *filesystem.Storage) ([]plumbing.Hash, error) {
+	refs, err := sto.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []plumbing.Hash
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && !ref.Hash().IsZero() {
+			hashes = append(hashes, ref.Hash())
+		}
+
+		return nil
+	})
+
+	return hashes, err
+}
+
+// reachableInIndex returns the reachable objects contained in a packfile
+// index and the total number of objects.
+func reachableInIndex(
+	e *compactEntry,
+	reachable map[plumbing.Hash]struct{},
+) ([]plumbing.Hash, int, error) {
+	r, err := e.open()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Close()
+
+	idx := idxfile.NewMemoryIndex()
+	if err := idxfile.NewDecoder(r).Decode(idx); err != nil {
+		return nil, 0, err
+	}
+
+	entries, err := idx.Entries()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer entries.Close()
+
+	var hashes []plumbing.Hash
+	var total int
+	for {
+		entry, err := entries.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		total++
+		if _, ok := reachable[entry.Hash]; ok {
+			hashes = append(hashes, entry.Hash)
+		}
+	}
+
+	return hashes, total, nil
+}
+
+// writePackIndex generates the index of a packfile.
+func writePackIndex(fs billy.Filesystem, pack string, w io.Writer) error {
+	f, err := fs.Open(pack)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	writer := new(idxfile.Writer)
+	parser, err := packfile.NewParser(packfile.NewScanner(f), writer)
+	if err != nil {
+		return err
+	}
+
+	if _, err := parser.Parse(); err != nil {
+		return err
+	}
+
+	idx, err := writer.Index()
+	if err != nil {
+		return err
+	}
+
+	_, err = idxfile.NewEncoder(w).Encode(idx)
+	return err
+}
+
+// looseObjectHash returns the hash of a loose object from its path.
+func looseObjectHash(name string) (plumbing.Hash, bool) {
+	dir, file := path.Split(name)
+	if !strings.HasPrefix(dir, "objects/") || len(dir) != len("objects/xx/") {
+		return plumbing.ZeroHash, false
+	}
+
+	hex := dir[len("objects/"):len("objects/xx")] + file
+	if len(hex) != 40 {
+		return plumbing.ZeroHash, false
+	}
+
+	h := plumbing.NewHash(hex)
+	if h.String() != hex {
+		return plumbing.ZeroHash, false
+	}
+
+	return h, true
+}
+
+type countWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += uint64(n)
+	return n, err
+}
+
+type nopCloser struct {
+	io.Reader
+}
+
+func (nopCloser) Close() error { return nil }
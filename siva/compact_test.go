@@ -0,0 +1,175 @@
+package siva
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+)
+
+func TestCompactVersions(t *testing.T) {
+	require := require.New(t)
+
+	const (
+		locID    = "cf2e799463e1a00dbd1addd2003b0c7db31dbfe2"
+		versions = `
+---
+versions:
+  "0":
+    offset: 3180
+  "1":
+    offset: 6557
+  "5":
+    offset: 10296
+  "6":
+    offset: 17421
+`
+	)
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	path := locID + locMetadataFileExt
+	err := util.WriteFile(fs, path, []byte(versions), 0666)
+	require.NoError(err)
+
+	lib, err := NewLibrary("test", fs, &LibraryOptions{Transactional: true})
+	require.NoError(err)
+
+	repositories := func(v int) []string {
+		require.NoError(lib.SetVersion(v))
+
+		it, err := lib.Repositories(borges.ReadOnlyMode)
+		require.NoError(err)
+
+		var repos []string
+		err = it.ForEach(func(r borges.Repository) error {
+			repos = append(repos, r.ID().String())
+			return r.Close()
+		})
+		require.NoError(err)
+
+		return repos
+	}
+
+	before := make(map[int][]string)
+	for _, v := range []int{0, 1, 5, 6, 7} {
+		before[v] = repositories(v)
+	}
+
+	stat, err := fs.Stat(locID + ".siva")
+	require.NoError(err)
+	size := stat.Size()
+
+	loc, err := lib.Location(locID)
+	require.NoError(err)
+	require.NoError(loc.(*Location).Compact(nil))
+
+	stat, err = fs.Stat(locID + ".siva")
+	require.NoError(err)
+	require.True(stat.Size() < size,
+		"compacted size %v, original %v", stat.Size(), size)
+
+	_, err = fs.Stat(locID + ".siva" + compactExtension)
+	require.Error(err)
+
+	for v, expected := range before {
+		t.Run(strconv.Itoa(v), func(t *testing.T) {
+			require.ElementsMatch(expected, repositories(v))
+		})
+	}
+
+	// a new library reads the updated offsets
+	lib, err = NewLibrary("test", fs, &LibraryOptions{Transactional: true})
+	require.NoError(err)
+	for v, expected := range before {
+		require.ElementsMatch(expected, repositories(v))
+	}
+}
+
+func TestCompactPrune(t *testing.T) {
+	for _, transactional := range []bool{false, true} {
+		t.Run(fmt.Sprintf("transactional-%v", transactional), func(t *testing.T) {
+			testCompactPrune(t, transactional)
+		})
+	}
+}
+
+func testCompactPrune(t *testing.T, transactional bool) {
+	require := require.New(t)
+
+	const locID = "cf2e799463e1a00dbd1addd2003b0c7db31dbfe2"
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	lib, err := NewLibrary("test", fs, &LibraryOptions{
+		Transactional: transactional,
+	})
+	require.NoError(err)
+
+	loc, err := lib.Location(locID)
+	require.NoError(err)
+
+	// gitserver.com/e objects are in their own packfile and
+	// gitserver.com/d ones share packfile with other repositories
+	require.NoError(loc.(*Location).Remove("gitserver.com/d"))
+	require.NoError(loc.(*Location).Remove("gitserver.com/e"))
+	removed := []plumbing.Hash{
+		plumbing.NewHash("98030e4628f15c208b05320a31bd7ff942dd9cf6"),
+		plumbing.NewHash("c0c150234d53f27424c7266a5b64749f8f8b7d22"),
+		plumbing.NewHash("47055f43258f5f8e4910ba23755e5e9f5a7413a9"),
+		plumbing.NewHash("5c016197dc226e105f3b5edcd259d7cfb0516a89"),
+	}
+
+	r, err := loc.Get("", borges.RWMode)
+	require.NoError(err)
+
+	obj := r.R().Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	require.NoError(err)
+	_, err = w.Write([]byte("unreachable"))
+	require.NoError(err)
+	require.NoError(w.Close())
+	blob, err := r.R().Storer.SetEncodedObject(obj)
+	require.NoError(err)
+
+	if transactional {
+		require.NoError(r.Commit())
+	} else {
+		require.NoError(r.Close())
+	}
+
+	require.NoError(loc.(*Location).Compact(&CompactOptions{Prune: true}))
+
+	r, err = loc.Get("", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	for _, h := range removed {
+		_, err = r.R().CommitObject(h)
+		require.Equal(plumbing.ErrObjectNotFound, err, h.String())
+	}
+
+	_, err = r.R().BlobObject(blob)
+	require.Equal(plumbing.ErrObjectNotFound, err)
+
+	var hashes []plumbing.Hash
+	refs, err := r.R().References()
+	require.NoError(err)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && !ref.Hash().IsZero() {
+			hashes = append(hashes, ref.Hash())
+		}
+
+		return nil
+	})
+	require.NoError(err)
+	require.NotEmpty(hashes)
+
+	_, err = revlist.Objects(r.R().Storer, hashes, nil)
+	require.NoError(err)
+}
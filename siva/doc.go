@@ -81,5 +81,107 @@ For example:
 
 Note: When using repositories in non transactional mode you should call Close
 after finishing, otherwise the siva file will be corrupted.
+
+Transactions are also safe between different processes sharing the same
+filesystem. While a transaction is in progress a lock file, with the same name
+as the siva file plus ".lock", holds its owner host, process id and the last
+time it was refreshed. Other processes wait for the lock the same grace period.
+A lock is broken when its process does not exist anymore in the same host or
+it was not refreshed for StaleLockTimeout, and the changes of the unfinished
+transaction are discarded using its checkpoint file. The lock file is only
+checked, broken or refreshed while holding an operating system lock on a
+".lock.guard" file, so two processes can not break the same stale lock.
+
+Siva files are only repaired when their location is opened in read write mode.
+Library.Recover repairs all the siva files with a checkpoint file left by an
+unfinished transaction, for example after a crash, and reports the changes.
+A location that can not be repaired does not stop the rest, its error is
+reported with the changes.
+
+Versions
+
+Each location can keep in its metadata file the offsets of the siva file for
+several version numbers and the library metadata holds the current version.
+Repositories opened in read only mode show the state of the closest version
+not greater than the current one. The ReadVersion option pins the version read
+by a library and Location.GetAtVersion opens a repository at any version, so
+several snapshots can be read at the same time.
+
+Deleting a version from the metadata does not free its data from the siva
+file. Library.PruneVersions deletes the versions not kept by a RetentionPolicy,
+keeping the last N versions or the ones from a version number, and compacts
+the locations so the remaining versions are rewritten to their new offsets.
+
+Index
+
+Finding a repository by its ID needs to read the configuration of every
+location until it's found. Libraries with lots of locations can enable the
+Index option to keep a persistent file, "repositories.index", mapping each
+repository ID to its location. The index is built the first time it's used,
+updated each time a repository opened in read write mode is committed or
+closed, and can be regenerated with Library.RebuildIndex. It always holds the
+repositories of the last committed state of each location, even when the
+library reads an older version.
+
+Compaction
+
+Each transaction appends a new block to the siva file so files rewritten or
+deleted in later transactions are never freed. Location.Compact rewrites the
+siva file keeping only the last copy of each file, with a block for each
+location version so these can still be read. With the Prune option the
+objects not reachable from any reference are also deleted. Removing a
+repository with Location.Remove only deletes its remote and references so
+compaction with prune is needed to free its objects.
+
+Moving repositories
+
+Library.Move relocates a repository to another location, for example when it
+was stored in the wrong one. Its objects, references and remote are copied to
+the target location and removed from the source one while both are locked.
+It's only supported in transactional libraries.
+
+Repositories from other libraries, like plain git repositories, are added to
+a location with Import. It copies their objects and stores their references
+under refs/remotes/<id>/ as if they were fetched into a location initialized
+with Location.Init.
+
+The opposite is done by Repository.Export, that writes a repository of a
+location as a standalone bare repository with only its objects, references
+without the remote prefix and HEAD pointing to its branch.
+
+Buckets
+
+Siva files can be stored in subdirectories named with the first characters of
+the location ID, configured with the Bucket option. Library.Relayout moves all
+the files to a new bucket level and returns a library that uses it. While files are in several levels the
+ReadBuckets option makes the library search them in all of them.
+
+Other directory structures can be used setting the PathLayout option, for
+example ShardLayout that uses several levels of directories. The metadata and
+checkpoint files of each location are kept next to its siva file. Siva files
+that are not in the path of their location, for example copied to the wrong
+bucket directory, are ignored and reported by borges.Verify.
+
+URLs
+
+Importing this package registers the "siva" scheme for borges.Open. The path
+of the URL is the directory of the library and the options id, rooted,
+transactional, timeout, transaction_timeout, stale_lock_timeout,
+registry_cache, performance, metadata_readonly and index set the library ID
+and the matching LibraryOptions fields. The tmp option is the directory used
+as TempFS:
+
+	siva:///data/lib?bucket=2&rooted=true&transactional=true
+
+The layout option chooses the PathLayout, "bucket" by default with the level
+set by the bucket option, or "shard" with the levels and width options, 2
+by default:
+
+	siva:///data/lib?layout=shard&levels=3&width=2
+
+The selector option sets the LocationSelector, "hash" with the locations
+option as NewHashSelector or "size" with the max_size option in bytes as
+NewSizeSelector. Other layouts and selectors can not be set from a URL and
+Open returns borges.ErrInvalidURL for them.
 */
 package siva
@@ -0,0 +1,122 @@
+package siva
+
+import (
+	"sort"
+
+	borges "github.com/src-d/go-borges"
+
+	billy "gopkg.in/src-d/go-billy.v4"
+	errors "gopkg.in/src-d/go-errors.v1"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/storage"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// ErrExportRootRepository is returned when exporting a repository opened
+// without ID, as it contains all the repositories of the location.
+var ErrExportRootRepository = errors.NewKind(
+	"repository without ID can not be exported")
+
+// Export writes the repository to the given filesystem as a standalone bare
+// git repository. Only the objects reachable from its references are
+// copied. References are stored without the refs/remotes/<id>/ prefix used
+// in the location and HEAD points to the branch it was fetched from.
+func (r *Repository) Export(fs billy.Filesystem) error {
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	if _, err := git.Init(sto, nil); err != nil {
+		return err
+	}
+
+	return r.export(sto)
+}
+
+// ExportTo copies the repository objects and references, the same way as
+// Export, to another repository. For example to a repository initialized in
+// a plain.Location. The destination repository must be committed or closed
+// by the caller.
+func (r *Repository) ExportTo(dst borges.Repository) error {
+	return r.export(dst.R().Storer)
+}
+
+func (r *Repository) export(dst storage.Storer) error {
+	if r.id == "" {
+		return ErrExportRootRepository.New()
+	}
+
+	rooted, ok := r.s.(*RootedStorage)
+	if !ok {
+		rooted = NewRootedStorage(r.s, r.id.String())
+	}
+
+	iter, err := rooted.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, ref)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := copyObjects(rooted, dst, refs); err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if err := dst.SetReference(ref); err != nil {
+			return err
+		}
+	}
+
+	head, err := rooted.Reference(plumbing.HEAD)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return dst.SetReference(restoreHEAD(head, refs))
+}
+
+// restoreHEAD returns a HEAD pointing to the branch with the same hash as
+// the fetched one, preferring master. HEAD is fetched as a hash reference so
+// the original branch is unknown. If no branch matches the hash reference is
+// returned.
+func restoreHEAD(
+	head *plumbing.Reference,
+	refs []*plumbing.Reference,
+) *plumbing.Reference {
+	if head.Type() != plumbing.HashReference {
+		return head
+	}
+
+	var branches []string
+	for _, ref := range refs {
+		if ref.Name().IsBranch() && ref.Type() == plumbing.HashReference &&
+			ref.Hash() == head.Hash() {
+			branches = append(branches, ref.Name().String())
+		}
+	}
+
+	if len(branches) == 0 {
+		return head
+	}
+
+	sort.Strings(branches)
+	target := plumbing.ReferenceName(branches[0])
+	for _, b := range branches {
+		if plumbing.ReferenceName(b) == plumbing.Master {
+			target = plumbing.Master
+			break
+		}
+	}
+
+	return plumbing.NewSymbolicReference(plumbing.HEAD, target)
+}
@@ -0,0 +1,141 @@
+package siva
+
+import (
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/plain"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+func TestExport(t *testing.T) {
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	lib, err := NewLibrary("test", fs, &LibraryOptions{RootedRepo: true})
+	require.NoError(err)
+
+	r, err := lib.Get("gitserver.com/a", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	exportFS := memfs.New()
+	err = r.(*Repository).Export(exportFS)
+	require.NoError(err)
+
+	sto := filesystem.NewStorage(exportFS, cache.NewObjectLRUDefault())
+	exported, err := git.Open(sto, nil)
+	require.NoError(err)
+
+	expected := repoReferences(t, r)
+	require.NotEmpty(expected)
+
+	var names []plumbing.ReferenceName
+	for _, ref := range expected {
+		names = append(names, ref.Name())
+
+		e, err := exported.Reference(ref.Name(), false)
+		require.NoError(err)
+		require.Equal(ref, e)
+	}
+
+	iter, err := exported.References()
+	require.NoError(err)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() != plumbing.HEAD {
+			require.Contains(names, ref.Name())
+		}
+		return nil
+	})
+	require.NoError(err)
+
+	// HEAD points to the branch with the fetched commit
+	originalHead, err := r.R().Reference(plumbing.HEAD, false)
+	require.NoError(err)
+	head, err := exported.Reference(plumbing.HEAD, false)
+	require.NoError(err)
+	require.Equal(plumbing.SymbolicReference, head.Type())
+	branch, err := exported.Reference(head.Target(), false)
+	require.NoError(err)
+	require.Equal(originalHead.Hash(), branch.Hash())
+
+	cfg, err := exported.Config()
+	require.NoError(err)
+	require.True(cfg.Core.IsBare)
+	require.Empty(cfg.Remotes)
+
+	// only the objects of the repository are exported
+	objects := make(map[plumbing.Hash]struct{})
+	commits, err := r.R().Log(&git.LogOptions{All: true})
+	require.NoError(err)
+	err = commits.ForEach(func(c *object.Commit) error {
+		objects[c.Hash] = struct{}{}
+		return nil
+	})
+	require.NoError(err)
+
+	iterCommits, err := exported.CommitObjects()
+	require.NoError(err)
+	var count int
+	err = iterCommits.ForEach(func(c *object.Commit) error {
+		require.Contains(objects, c.Hash)
+		count++
+		return nil
+	})
+	require.NoError(err)
+	require.Equal(len(objects), count)
+
+	err = r.(*Repository).Export(exportFS)
+	require.Equal(git.ErrRepositoryAlreadyExists, err)
+
+	loc, err := lib.Location("cf2e799463e1a00dbd1addd2003b0c7db31dbfe2")
+	require.NoError(err)
+	root, err := loc.Get("", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer root.Close()
+	err = root.(*Repository).Export(memfs.New())
+	require.True(ErrExportRootRepository.Is(err))
+}
+
+func TestExportTo(t *testing.T) {
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	lib, err := NewLibrary("test", fs, &LibraryOptions{RootedRepo: true})
+	require.NoError(err)
+
+	r, err := lib.Get("gitserver.com/b", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	loc, err := plain.NewLocation("plain", memfs.New(),
+		&plain.LocationOptions{Bare: true})
+	require.NoError(err)
+
+	dst, err := loc.Init("gitserver.com/b")
+	require.NoError(err)
+	require.NoError(r.(*Repository).ExportTo(dst))
+	require.NoError(dst.Close())
+
+	dst, err = loc.Get("gitserver.com/b", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer dst.Close()
+
+	for _, ref := range repoReferences(t, r) {
+		e, err := dst.R().Reference(ref.Name(), false)
+		require.NoError(err)
+		require.Equal(ref, e)
+	}
+
+	head, err := dst.R().Head()
+	require.NoError(err)
+	_, err = dst.R().CommitObject(head.Hash())
+	require.NoError(err)
+}
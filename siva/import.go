@@ -0,0 +1,157 @@
+package siva
+
+import (
+	"context"
+
+	borges "github.com/src-d/go-borges"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// Import copies all the objects and references of a repository from any
+// library, for example a plain one, into a siva location. The repository is
+// added to the location as a new remote with the ID of the source repository
+// and its references are stored under refs/remotes/<id>/, the same layout
+// used by Location.Init, so it can be read from a rooted library. Symbolic
+// references are stored resolved to the hash they point to.
+//
+// It returns borges.ErrRepositoryExists if the location already has a
+// repository with the same ID.
+func Import(src borges.Repository, dst *Location) error {
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		dst.lib.options.Timeout,
+	)
+	defer cancel()
+
+	id := borges.NormalizeRepositoryID(src.ID().String())
+	has, err := dst.HasContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if has {
+		return borges.ErrRepositoryExists.New(id)
+	}
+
+	refs, err := importReferences(src.R().Storer)
+	if err != nil {
+		return err
+	}
+
+	repo, err := dst.repository("", borges.RWMode)
+	if err != nil {
+		return err
+	}
+
+	err = importRepository(src, repo, id, refs)
+	if err != nil {
+		// TODO: log the rollback error
+		_ = repo.Close()
+		return err
+	}
+
+	if dst.lib.options.Transactional {
+		return repo.Commit()
+	}
+
+	return repo.Close()
+}
+
+func importRepository(
+	src, dst borges.Repository,
+	id borges.RepositoryID,
+	refs []*plumbing.Reference,
+) error {
+	if err := createRemote(dst.R(), id); err != nil {
+		return err
+	}
+
+	sto := dst.R().Storer
+	if err := copyObjects(src.R().Storer, sto, refs); err != nil {
+		return err
+	}
+
+	rooted := NewRootedStorage(sto, id.String())
+	for _, ref := range refs {
+		if err := rooted.SetReference(ref); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importReferences returns all the references of the storer with the
+// symbolic ones resolved. Symbolic references pointing to a reference that
+// does not exist, like the HEAD of an empty repository, are skipped.
+func importReferences(sto storer.ReferenceStorer) ([]*plumbing.Reference, error) {
+	iter, err := sto.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+	var head bool
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() == plumbing.HEAD {
+			head = true
+		}
+
+		ref, err := resolveReference(sto, ref)
+		if err != nil || ref == nil {
+			return err
+		}
+
+		refs = append(refs, ref)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// some storers, like rooted ones, don't return HEAD when iterating
+	if !head {
+		ref, err := sto.Reference(plumbing.HEAD)
+		if err == plumbing.ErrReferenceNotFound {
+			return refs, nil
+		}
+
+		if err == nil {
+			ref, err = resolveReference(sto, ref)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ref != nil {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs, nil
+}
+
+// resolveReference converts a symbolic reference to a hash reference with
+// the same name. It returns nil if the target does not exist.
+func resolveReference(
+	sto storer.ReferenceStorer,
+	ref *plumbing.Reference,
+) (*plumbing.Reference, error) {
+	if ref.Type() != plumbing.SymbolicReference {
+		return ref, nil
+	}
+
+	resolved, err := storer.ResolveReference(sto, ref.Name())
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return plumbing.NewHashReference(ref.Name(), resolved.Hash()), nil
+}
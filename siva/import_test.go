@@ -0,0 +1,108 @@
+package siva
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+	"github.com/src-d/go-borges/plain"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	fixtures "gopkg.in/src-d/go-git-fixtures.v3"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func TestImport(t *testing.T) {
+	for _, transactional := range []bool{false, true} {
+		t.Run(fmt.Sprintf("transactional=%v", transactional), func(t *testing.T) {
+			testImport(t, transactional)
+		})
+	}
+}
+
+func testImport(t *testing.T, transactional bool) {
+	require := require.New(t)
+
+	require.NoError(fixtures.Init())
+	defer fixtures.Clean()
+
+	dir, err := ioutil.TempDir("", "go-borges-import")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	err = os.Rename(fixtures.Basic().One().DotGit().Root(),
+		filepath.Join(dir, "basic.git"))
+	require.NoError(err)
+
+	src, err := plain.NewLocation("plain", osfs.New(dir),
+		&plain.LocationOptions{Bare: true})
+	require.NoError(err)
+	plainRepo, err := src.Get("basic.git", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer plainRepo.Close()
+
+	lib := setupLibrary(t, "test", &LibraryOptions{
+		Transactional: transactional,
+		RootedRepo:    true,
+	})
+	l, err := lib.AddLocation("imported")
+	require.NoError(err)
+	dst := l.(*Location)
+
+	err = Import(plainRepo, dst)
+	require.NoError(err)
+
+	// siva repository IDs don't have .git suffix
+	r, err := dst.Get("basic", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	remote, err := r.R().Remote("basic")
+	require.NoError(err)
+	require.Equal([]string{"git://basic.git"}, remote.Config().URLs)
+
+	expected, err := plainRepo.R().Head()
+	require.NoError(err)
+
+	head, err := r.R().Reference(plumbing.HEAD, false)
+	require.NoError(err)
+	require.Equal(expected.Hash(), head.Hash())
+
+	iter, err := plainRepo.R().References()
+	require.NoError(err)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		imported, err := r.R().Reference(ref.Name(), false)
+		require.NoError(err, ref.Name().String())
+		require.Equal(ref.Hash(), imported.Hash())
+		return nil
+	})
+	require.NoError(err)
+
+	// all the commits and files can be read
+	commits, err := r.R().Log(&git.LogOptions{All: true})
+	require.NoError(err)
+	err = commits.ForEach(func(c *object.Commit) error {
+		tree, err := c.Tree()
+		if err != nil {
+			return err
+		}
+
+		return tree.Files().ForEach(func(*object.File) error {
+			return nil
+		})
+	})
+	require.NoError(err)
+
+	err = Import(plainRepo, dst)
+	require.True(borges.ErrRepositoryExists.Is(err))
+}
@@ -0,0 +1,298 @@
+package siva
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/google/uuid"
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	errors "gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/config"
+)
+
+// ErrMalformedIndex is returned when the repository index can't be parsed.
+var ErrMalformedIndex = errors.NewKind("malformed repository index: %s")
+
+const (
+	indexFile    = "repositories.index"
+	indexHeader  = "# go-borges repository index "
+	indexAdd     = "+"
+	indexDelete  = "-"
+	indexFieldSp = "\t"
+)
+
+// repoIndex is a persistent index mapping repository IDs to the location
+// that contains them. It's stored in an append only file where each line
+// adds or deletes a mapping so updating it does not need to rewrite the whole
+// index. The first line of the file contains an unique identifier used to
+// detect when it has been rebuilt by another process.
+//
+// Format:
+//
+//	# go-borges repository index <uuid>
+//	+	github.com/src-d/go-borges	location-id
+//	-	github.com/src-d/go-borges	location-id
+type repoIndex struct {
+	fs     billy.Filesystem
+	header string
+	offset int64
+	repos  map[borges.RepositoryID]borges.LocationID
+	locs   map[borges.LocationID]map[borges.RepositoryID]struct{}
+
+	m sync.Mutex
+}
+
+func newRepoIndex(fs billy.Filesystem) *repoIndex {
+	idx := &repoIndex{fs: fs}
+	idx.reset("")
+	return idx
+}
+
+func (i *repoIndex) reset(header string) {
+	i.header = header
+	i.offset = 0
+	i.repos = make(map[borges.RepositoryID]borges.LocationID)
+	i.locs = make(map[borges.LocationID]map[borges.RepositoryID]struct{})
+}
+
+// get returns the location containing the given repository. The error is
+// os.ErrNotExist compatible when the index file was never built.
+func (i *repoIndex) get(
+	id borges.RepositoryID,
+) (borges.LocationID, bool, error) {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if err := i.refresh(); err != nil {
+		return "", false, err
+	}
+
+	loc, ok := i.repos[borges.NormalizeRepositoryID(id.String())]
+	return loc, ok, nil
+}
+
+// set replaces the repositories indexed for the given location.
+func (i *repoIndex) set(
+	loc borges.LocationID,
+	ids []borges.RepositoryID,
+) error {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if err := i.refresh(); err != nil {
+		return err
+	}
+
+	current := make(map[borges.RepositoryID]struct{}, len(ids))
+	var buf bytes.Buffer
+	for _, id := range ids {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		current[id] = struct{}{}
+
+		if l, ok := i.repos[id]; ok && l == loc {
+			continue
+		}
+
+		writeIndexEntry(&buf, indexAdd, id, loc)
+	}
+
+	for id := range i.locs[loc] {
+		if _, ok := current[id]; !ok {
+			writeIndexEntry(&buf, indexDelete, id, loc)
+		}
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	f, err := i.fs.OpenFile(indexFile, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(buf.Bytes())
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return i.refresh()
+}
+
+// refresh reads the entries appended to the index file since the last time
+// it was read. If the file was rebuilt it is read from the beginning.
+func (i *repoIndex) refresh() error {
+	stat, err := i.fs.Stat(indexFile)
+	if err != nil {
+		return err
+	}
+
+	if stat.Size() == i.offset {
+		return nil
+	}
+
+	f, err := i.fs.Open(indexFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(header, indexHeader) {
+		return ErrMalformedIndex.New("invalid header")
+	}
+
+	if header != i.header || stat.Size() < i.offset {
+		i.reset(header)
+		i.offset = int64(len(header))
+	}
+
+	if _, err := f.Seek(i.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r.Reset(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			// incomplete lines are ignored as they can be
+			// still being written
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := i.apply(strings.TrimSuffix(line, "\n")); err != nil {
+			return err
+		}
+
+		i.offset += int64(len(line))
+	}
+}
+
+func (i *repoIndex) apply(line string) error {
+	fields := strings.Split(line, indexFieldSp)
+	if len(fields) != 3 {
+		return ErrMalformedIndex.New(line)
+	}
+
+	id := borges.RepositoryID(fields[1])
+	loc := borges.LocationID(fields[2])
+
+	switch fields[0] {
+	case indexAdd:
+		if prev, ok := i.repos[id]; ok {
+			delete(i.locs[prev], id)
+		}
+
+		i.repos[id] = loc
+		if _, ok := i.locs[loc]; !ok {
+			i.locs[loc] = make(map[borges.RepositoryID]struct{})
+		}
+		i.locs[loc][id] = struct{}{}
+
+	case indexDelete:
+		if i.repos[id] == loc {
+			delete(i.repos, id)
+		}
+
+		delete(i.locs[loc], id)
+		if len(i.locs[loc]) == 0 {
+			delete(i.locs, loc)
+		}
+
+	default:
+		return ErrMalformedIndex.New(line)
+	}
+
+	return nil
+}
+
+// rebuild generates the index from scratch reading the configuration of all
+// the locations of the library.
+func (i *repoIndex) rebuild(ctx context.Context, lib *Library) error {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	locs, err := lib.locations(ctx)
+	if err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("%s%s\n", indexHeader, uuid.New().String())
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	for _, l := range locs {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		loc := l.(*Location)
+		ids, err := loc.repositoryIDs()
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			writeIndexEntry(&buf, indexAdd, id, loc.ID())
+		}
+	}
+
+	tmp := indexFile + ".tmp"
+	defer i.fs.Remove(tmp)
+
+	if err := util.WriteFile(i.fs, tmp, buf.Bytes(), 0666); err != nil {
+		return err
+	}
+
+	if err := i.fs.Rename(tmp, indexFile); err != nil {
+		return err
+	}
+
+	i.reset("")
+	return i.refresh()
+}
+
+func writeIndexEntry(
+	w io.Writer,
+	op string,
+	id borges.RepositoryID,
+	loc borges.LocationID,
+) {
+	fmt.Fprintf(w, "%s%s%s%s%s\n", op, indexFieldSp, id, indexFieldSp, loc)
+}
+
+// remoteIDs returns the repository IDs of the remotes from a git config.
+// Both remote names and URLs are converted to repository IDs.
+func remoteIDs(cfg *config.Config) []borges.RepositoryID {
+	var ids []borges.RepositoryID
+	for _, r := range cfg.Remotes {
+		ids = append(ids, borges.NormalizeRepositoryID(r.Name))
+		for _, url := range r.URLs {
+			ids = append(ids, borges.NormalizeRepositoryID(url))
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,219 @@
+package siva
+
+import (
+	"context"
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestIndex(t *testing.T) {
+	suite.Run(t, &indexSuite{transactional: false})
+	suite.Run(t, &indexSuite{transactional: true})
+	suite.Run(t, &indexSuite{transactional: true, bucket: 2})
+}
+
+type indexSuite struct {
+	suite.Suite
+
+	transactional bool
+	bucket        int
+	lib           *Library
+}
+
+func (s *indexSuite) SetupTest() {
+	s.lib = setupLibrary(s.T(), "test", &LibraryOptions{
+		Transactional: s.transactional,
+		Bucket:        s.bucket,
+		Index:         true,
+	})
+}
+
+func (s *indexSuite) commit(r borges.Repository) {
+	if s.transactional {
+		s.Require().NoError(r.Commit())
+	} else {
+		s.Require().NoError(r.Close())
+	}
+}
+
+func (s *indexSuite) TestBuildOnFirstUse() {
+	require := s.Require()
+
+	_, err := s.lib.fs.Stat(indexFile)
+	require.Error(err)
+
+	ok, _, loc, err := s.lib.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(borges.LocationID("foo-bar"), loc)
+
+	_, err = s.lib.fs.Stat(indexFile)
+	require.NoError(err)
+
+	ok, _, _, err = s.lib.Has("github.com/foo/nope")
+	require.NoError(err)
+	require.False(ok)
+
+	r, err := s.lib.Get("https://github.com/foo/qux.git", borges.ReadOnlyMode)
+	require.NoError(err)
+	require.Equal(borges.LocationID("foo-qux"), r.Location().ID())
+	require.NoError(r.Close())
+}
+
+func (s *indexSuite) TestUpdateOnCommit() {
+	require := s.Require()
+
+	require.NoError(s.lib.RebuildIndex(context.Background()))
+
+	loc, err := s.lib.AddLocation("new")
+	require.NoError(err)
+
+	r, err := loc.Init("github.com/src-d/new")
+	require.NoError(err)
+
+	ok, _, _, err := s.lib.Has("github.com/src-d/new")
+	require.NoError(err)
+	require.False(ok)
+
+	s.commit(r)
+
+	ok, _, locID, err := s.lib.Has("github.com/src-d/new")
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(borges.LocationID("new"), locID)
+
+	// another library sharing the same filesystem sees the changes
+	other, err := NewLibrary("other", s.lib.fs, &LibraryOptions{
+		Transactional: s.transactional,
+		Bucket:        s.bucket,
+		Index:         true,
+	})
+	require.NoError(err)
+
+	ok, _, locID, err = other.Has("github.com/src-d/new")
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(borges.LocationID("new"), locID)
+
+	r, err = loc.Init("github.com/src-d/other")
+	require.NoError(err)
+	s.commit(r)
+
+	ok, _, locID, err = other.Has("github.com/src-d/other")
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(borges.LocationID("new"), locID)
+}
+
+func (s *indexSuite) TestRemovedRemote() {
+	require := s.Require()
+
+	loc, err := s.lib.AddLocation("new")
+	require.NoError(err)
+
+	r, err := loc.Init("github.com/src-d/new")
+	require.NoError(err)
+	s.commit(r)
+
+	ok, _, _, err := s.lib.Has("github.com/src-d/new")
+	require.NoError(err)
+	require.True(ok)
+
+	r, err = loc.Get("github.com/src-d/new", borges.RWMode)
+	require.NoError(err)
+
+	cfg, err := r.R().Config()
+	require.NoError(err)
+
+	remote := cfg.Remotes["github.com/src-d/new"]
+	delete(cfg.Remotes, "github.com/src-d/new")
+	remote.Name = "github.com/src-d/renamed"
+	remote.URLs = []string{"git://github.com/src-d/renamed.git"}
+	cfg.Remotes[remote.Name] = remote
+	require.NoError(r.R().Storer.SetConfig(cfg))
+	s.commit(r)
+
+	ok, _, _, err = s.lib.Has("github.com/src-d/new")
+	require.NoError(err)
+	require.False(ok)
+
+	ok, _, locID, err := s.lib.Has("github.com/src-d/renamed")
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(borges.LocationID("new"), locID)
+}
+
+func (s *indexSuite) TestRebuild() {
+	require := s.Require()
+
+	err := util.WriteFile(s.lib.fs, indexFile,
+		[]byte(indexHeader+"stale\n+\tgithub.com/foo/bar\tnope\n"), 0666)
+	require.NoError(err)
+
+	_, _, loc, err := s.lib.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.Equal(borges.LocationID("nope"), loc)
+
+	require.NoError(s.lib.RebuildIndex(context.Background()))
+
+	_, _, loc, err = s.lib.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.Equal(borges.LocationID("foo-bar"), loc)
+}
+
+func (s *indexSuite) TestMalformed() {
+	require := s.Require()
+
+	err := util.WriteFile(s.lib.fs, indexFile, []byte("garbage\n"), 0666)
+	require.NoError(err)
+
+	_, _, _, err = s.lib.Has("github.com/foo/bar")
+	require.True(ErrMalformedIndex.Is(err))
+
+	require.NoError(s.lib.RebuildIndex(context.Background()))
+
+	ok, _, _, err := s.lib.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.True(ok)
+}
+
+func (s *indexSuite) TestNotEnabled() {
+	require := s.Require()
+
+	lib := setupLibrary(s.T(), "test", &LibraryOptions{})
+	err := lib.RebuildIndex(context.Background())
+	require.True(ErrIndexNotEnabled.Is(err))
+}
+
+func TestIndexVersion(t *testing.T) {
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	path := "cf2e799463e1a00dbd1addd2003b0c7db31dbfe2" + locMetadataFileExt
+	err := util.WriteFile(fs, path, []byte("versions:\n  \"0\":\n    offset: 3180\n"), 0666)
+	require.NoError(err)
+
+	version := 0
+	lib, err := NewLibrary("test", fs, &LibraryOptions{
+		Transactional: true,
+		ReadVersion:   &version,
+		Index:         true,
+	})
+	require.NoError(err)
+
+	// read only repositories use the pinned version
+	_, err = lib.Get("gitserver.com/e", borges.ReadOnlyMode)
+	require.True(borges.ErrRepositoryNotExists.Is(err))
+
+	// but the index has the repositories of the last committed state
+	require.NoError(lib.RebuildIndex(context.Background()))
+
+	ok, _, _, err := lib.Has("gitserver.com/e")
+	require.NoError(err)
+	require.True(ok)
+}
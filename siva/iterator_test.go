@@ -40,7 +40,7 @@ func TestRepositoryIterator(t *testing.T) {
 	r, err := i.Next()
 	require.NoError(err)
 	require.NotNil(r)
-	require.Equal(toRepoID(name), r.ID())
+	require.Equal(borges.NormalizeRepositoryID(name), r.ID())
 	require.Equal(loc.ID(), r.Location().ID())
 	require.Equal(borges.ReadOnlyMode, r.Mode())
 
@@ -0,0 +1,119 @@
+package siva
+
+import (
+	"path/filepath"
+	"strings"
+
+	borges "github.com/src-d/go-borges"
+)
+
+// PathLayout decides where the siva file of each location is stored in the
+// library filesystem. The metadata and checkpoint files of a location are
+// stored next to its siva file.
+type PathLayout interface {
+	// Path returns the path of the siva file for the location.
+	Path(borges.LocationID) string
+	// Pattern returns a glob pattern that matches the siva files of all
+	// the locations.
+	Pattern() string
+	// ID returns the ID of the location stored in the given path. It
+	// returns false when the path is not a siva file of the layout.
+	ID(path string) (borges.LocationID, bool)
+}
+
+// BucketLayout stores the siva files in a directory named with the given
+// number of first characters of the location ID, <bucket>/<id>.siva. With
+// 0 the files are stored in the root directory. IDs shorter than the bucket
+// are padded with "-". It's the default layout, using the Bucket option.
+type BucketLayout int
+
+var _ PathLayout = BucketLayout(0)
+
+// Path implements PathLayout interface.
+func (b BucketLayout) Path(id borges.LocationID) string {
+	return ShardLayout{Levels: 1, Width: int(b)}.Path(id)
+}
+
+// Pattern implements PathLayout interface.
+func (b BucketLayout) Pattern() string {
+	return ShardLayout{Levels: 1, Width: int(b)}.Pattern()
+}
+
+// ID implements PathLayout interface.
+func (b BucketLayout) ID(path string) (borges.LocationID, bool) {
+	return ShardLayout{Levels: 1, Width: int(b)}.ID(path)
+}
+
+// ShardLayout stores the siva files in several levels of directories, each
+// one named with the next Width characters of the location ID. For example
+// with 2 levels of width 2 the location "abcdef" is stored in
+// ab/cd/abcdef.siva. IDs shorter than needed are padded with "-".
+type ShardLayout struct {
+	// Levels is the number of nested directories.
+	Levels int
+	// Width is the number of characters of each directory name.
+	Width int
+}
+
+var _ PathLayout = ShardLayout{}
+
+// Path implements PathLayout interface.
+func (s ShardLayout) Path(id borges.LocationID) string {
+	name := string(id) + ".siva"
+	if s.Levels <= 0 || s.Width <= 0 {
+		return name
+	}
+
+	r := []rune(id)
+	if size := s.Levels * s.Width; len(r) < size {
+		r = append(r, []rune(strings.Repeat("-", size-len(r)))...)
+	}
+
+	dirs := make([]string, 0, s.Levels+1)
+	for i := 0; i < s.Levels; i++ {
+		dirs = append(dirs, string(r[i*s.Width:(i+1)*s.Width]))
+	}
+
+	return filepath.Join(append(dirs, name)...)
+}
+
+// Pattern implements PathLayout interface.
+func (s ShardLayout) Pattern() string {
+	if s.Levels <= 0 || s.Width <= 0 {
+		return "*.siva"
+	}
+
+	dirs := make([]string, 0, s.Levels+1)
+	for i := 0; i < s.Levels; i++ {
+		dirs = append(dirs, strings.Repeat("?", s.Width))
+	}
+
+	return filepath.Join(append(dirs, "*.siva")...)
+}
+
+// ID implements PathLayout interface.
+func (s ShardLayout) ID(path string) (borges.LocationID, bool) {
+	return layoutID(s, path)
+}
+
+// layoutID gets the location ID from the siva file name and checks that the
+// path is the one built by the layout.
+func layoutID(layout PathLayout, path string) (borges.LocationID, bool) {
+	name := filepath.Base(path)
+	if !strings.HasSuffix(name, ".siva") {
+		return "", false
+	}
+
+	id := toLocID(name)
+	if id == "" || layout.Path(id) != filepath.Clean(path) {
+		return "", false
+	}
+
+	return id, true
+}
+
+// metadataPath returns the path of the location metadata file stored next
+// to the given siva file.
+func metadataPath(sivaPath string) string {
+	return strings.TrimSuffix(sivaPath, ".siva") + locMetadataFileExt
+}
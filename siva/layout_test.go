@@ -0,0 +1,96 @@
+package siva
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestPathLayout(t *testing.T) {
+	tests := []struct {
+		layout  PathLayout
+		id      borges.LocationID
+		path    string
+		pattern string
+	}{
+		{BucketLayout(0), "abcdef", "abcdef.siva", "*.siva"},
+		{BucketLayout(2), "abcdef", "ab/abcdef.siva", "??/*.siva"},
+		{BucketLayout(3), "ab", "ab-/ab.siva", "???/*.siva"},
+		{ShardLayout{}, "abcdef", "abcdef.siva", "*.siva"},
+		{ShardLayout{Levels: 2, Width: 2}, "abcdef", "ab/cd/abcdef.siva",
+			"??/??/*.siva"},
+		{ShardLayout{Levels: 2, Width: 2}, "abc", "ab/c-/abc.siva",
+			"??/??/*.siva"},
+		{ShardLayout{Levels: 3, Width: 1}, "abcdef", "a/b/c/abcdef.siva",
+			"?/?/?/*.siva"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			require := require.New(t)
+
+			path := filepath.FromSlash(test.path)
+			require.Equal(path, test.layout.Path(test.id))
+			require.Equal(filepath.FromSlash(test.pattern),
+				test.layout.Pattern())
+
+			id, ok := test.layout.ID(path)
+			require.True(ok)
+			require.Equal(test.id, id)
+
+			_, ok = test.layout.ID(filepath.Join("other", path))
+			require.False(ok)
+
+			_, ok = test.layout.ID(path + ".checkpoint")
+			require.False(ok)
+		})
+	}
+}
+
+func TestLibrary_PathLayout(t *testing.T) {
+	require := require.New(t)
+
+	layout := ShardLayout{Levels: 2, Width: 2}
+
+	fs := memfs.New()
+	for _, id := range []borges.LocationID{"foo-bar", "foo-qux"} {
+		data, err := ioutil.ReadFile(
+			filepath.Join("../_testdata/siva", string(id)+".siva"))
+		require.NoError(err)
+		err = util.WriteFile(fs, layout.Path(id), data, 0666)
+		require.NoError(err)
+	}
+
+	lib, err := NewLibrary("test", fs, &LibraryOptions{
+		Transactional: true,
+		PathLayout:    layout,
+	})
+	require.NoError(err)
+
+	requireRelayoutRepositories(t, lib)
+
+	loc, err := lib.AddLocation("new")
+	require.NoError(err)
+	r, err := loc.Init("github.com/foo/new")
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	_, err = fs.Stat("ne/w-/new.siva")
+	require.NoError(err)
+
+	var ids []borges.LocationID
+	locs, err := lib.Locations()
+	require.NoError(err)
+	err = locs.ForEach(func(l borges.Location) error {
+		ids = append(ids, l.ID())
+		return nil
+	})
+	require.NoError(err)
+	require.ElementsMatch([]borges.LocationID{"foo-bar", "foo-qux", "new"}, ids)
+}
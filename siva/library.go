@@ -20,8 +20,13 @@ import (
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
 )
 
-// ErrLocationExists when the location to be created already exists.
-var ErrLocationExists = errors.NewKind("location %s already exists")
+var (
+	// ErrLocationExists when the location to be created already exists.
+	ErrLocationExists = borges.ErrLocationExists
+	// ErrIndexNotEnabled is returned when an index operation is requested
+	// in a library without index.
+	ErrIndexNotEnabled = errors.NewKind("repository index not enabled")
+)
 
 // Library represents a borges.Library implementation based on siva files.
 type Library struct {
@@ -32,6 +37,7 @@ type Library struct {
 	locMu    sync.Mutex
 	options  *LibraryOptions
 	metadata *libMetadata
+	index    *repoIndex
 }
 
 // LibraryOptions hold configuration options for the library.
@@ -41,6 +47,11 @@ type LibraryOptions struct {
 	// TransactionTimeout is the time it will wait while another transaction
 	// is being done before error. 0 means default.
 	TransactionTimeout time.Duration
+	// StaleLockTimeout is the time after which the lock file of a
+	// transaction from other process that was not refreshed is considered
+	// abandoned and can be broken. Locks from finished processes in the
+	// same host are broken without waiting. 0 means default (5 minutes).
+	StaleLockTimeout time.Duration
 	// Timeout set a timeout for library operations. Some operations could
 	// potentially take long so timing out them will make an error be
 	// returned. A 0 value sets a default value of 20 seconds.
@@ -52,6 +63,14 @@ type LibraryOptions struct {
 	TempFS billy.Filesystem
 	// Bucket level to use to search and create siva files.
 	Bucket int
+	// PathLayout decides where the siva files are stored. When it's set
+	// Bucket is ignored. By default BucketLayout with Bucket level is used.
+	PathLayout PathLayout
+	// ReadBuckets are other bucket levels where existing siva files are
+	// also searched. It allows using a library with files in several
+	// bucket levels, for example while it's converted with Relayout. New
+	// locations are always created with Bucket level.
+	ReadBuckets []int
 	// RootedRepo makes the repository show only the references for the remote
 	// named with the repository ID.
 	RootedRepo bool
@@ -63,13 +82,29 @@ type LibraryOptions struct {
 	Performance bool
 	// MetadataReadOnly doesn't create or modify metadata for the library.
 	MetadataReadOnly bool
+	// ReadVersion pins the version used to read repositories in read only
+	// mode instead of the one stored in the library metadata, so changes
+	// to it made by other processes are not followed. When it's nil the
+	// library metadata version is used.
+	ReadVersion *int
+	// LocationSelector chooses the location used by Init and GetOrInit
+	// to create new repositories. When it's not set Init, and GetOrInit
+	// for repositories that do not exist, return borges.ErrNotImplemented.
+	LocationSelector borges.LocationSelector
+	// Index enables a persistent index that maps repositories to the
+	// location containing them. It's updated each time a repository is
+	// committed and makes Has and Get a single lookup instead of scanning
+	// all the locations. It's built the first time it's used if it does
+	// not exist and can be built again with RebuildIndex.
+	Index bool
 }
 
-var _ borges.Library = (*Library)(nil)
+var _ borges.ContextLibrary = (*Library)(nil)
 
 const (
 	timeout           = 20 * time.Second
 	txTimeout         = 60 * time.Second
+	staleLockTimeout  = 5 * time.Minute
 	registryCacheSize = 10000
 )
 
@@ -119,6 +154,10 @@ func NewLibrary(
 		ops.TransactionTimeout = txTimeout
 	}
 
+	if ops.StaleLockTimeout == 0 {
+		ops.StaleLockTimeout = staleLockTimeout
+	}
+
 	if ops.Timeout == 0 {
 		ops.Timeout = timeout
 	}
@@ -133,6 +172,11 @@ func NewLibrary(
 		tmp = osfs.New(dir)
 	}
 
+	var index *repoIndex
+	if ops.Index {
+		index = newRepoIndex(fs)
+	}
+
 	return &Library{
 		id:       borges.LibraryID(id),
 		fs:       fs,
@@ -140,6 +184,7 @@ func NewLibrary(
 		locReg:   lr,
 		options:  ops,
 		metadata: metadata,
+		index:    index,
 	}, nil
 }
 
@@ -149,13 +194,68 @@ func (l *Library) ID() borges.LibraryID {
 }
 
 // Init implements borges.Library interface.
-func (l *Library) Init(borges.RepositoryID) (borges.Repository, error) {
-	return nil, borges.ErrNotImplemented.New()
+func (l *Library) Init(id borges.RepositoryID) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.options.Timeout)
+	defer cancel()
+
+	return l.InitContext(ctx, id)
+}
+
+// InitContext implements borges.ContextLibrary interface. The location of the
+// new repository is chosen by LibraryOptions.LocationSelector, if it's not set
+// borges.ErrNotImplemented is returned.
+func (l *Library) InitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	if l.options.LocationSelector == nil {
+		return nil, borges.ErrNotImplemented.New()
+	}
+
+	id = borges.NormalizeRepositoryID(id.String())
+	has, _, _, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if has {
+		return nil, borges.ErrRepositoryExists.New(id)
+	}
+
+	locID, err := l.options.LocationSelector.SelectLocation(ctx, l, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if locID == "" {
+		return nil, borges.ErrInvalidLocationID.New(id)
+	}
+
+	l.locMu.Lock()
+	loc, err := l.location(locID, true)
+	l.locMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return loc.InitContext(ctx, id)
 }
 
 // Get implements borges.Library interface.
 func (l *Library) Get(repoID borges.RepositoryID, mode borges.Mode) (borges.Repository, error) {
-	ok, _, locID, err := l.Has(repoID)
+	ctx, cancel := context.WithTimeout(context.Background(), l.options.Timeout)
+	defer cancel()
+
+	return l.GetContext(ctx, repoID, mode)
+}
+
+// GetContext implements borges.ContextLibrary interface.
+func (l *Library) GetContext(
+	ctx context.Context,
+	repoID borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
+	ok, _, locID, err := l.HasContext(ctx, repoID)
 	if err != nil {
 		return nil, err
 	}
@@ -164,22 +264,43 @@ func (l *Library) Get(repoID borges.RepositoryID, mode borges.Mode) (borges.Repo
 		return nil, borges.ErrRepositoryNotExists.New(repoID)
 	}
 
-	loc, err := l.Location(locID)
+	loc, err := l.location(locID, false)
 	if err != nil {
 		return nil, err
 	}
 
-	return loc.Get(repoID, mode)
+	return loc.GetContext(ctx, repoID, mode)
 }
 
 // GetOrInit implements borges.Library interface.
-func (l *Library) GetOrInit(borges.RepositoryID) (borges.Repository, error) {
-	return nil, borges.ErrNotImplemented.New()
+func (l *Library) GetOrInit(id borges.RepositoryID) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.options.Timeout)
+	defer cancel()
+
+	return l.GetOrInitContext(ctx, id)
 }
 
-func toRepoID(endpoint string) borges.RepositoryID {
-	name, _ := borges.NewRepositoryID(endpoint)
-	return borges.RepositoryID(strings.TrimSuffix(name.String(), ".git"))
+// GetOrInitContext implements borges.ContextLibrary interface. If the
+// repository does not exist it's initialized as in InitContext.
+func (l *Library) GetOrInitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	has, _, locID, err := l.HasContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return l.InitContext(ctx, id)
+	}
+
+	loc, err := l.location(locID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return loc.GetContext(ctx, id, borges.RWMode)
 }
 
 func toLocID(file string) borges.LocationID {
@@ -192,6 +313,18 @@ func (l *Library) Has(name borges.RepositoryID) (bool, borges.LibraryID, borges.
 	ctx, cancel := context.WithTimeout(context.Background(), l.options.Timeout)
 	defer cancel()
 
+	return l.HasContext(ctx, name)
+}
+
+// HasContext implements borges.ContextLibrary interface.
+func (l *Library) HasContext(
+	ctx context.Context,
+	name borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
+	if l.index != nil {
+		return l.hasIndexed(ctx, name)
+	}
+
 	locs, err := l.locations(ctx)
 	if err != nil {
 		return false, "", "", err
@@ -212,7 +345,7 @@ func (l *Library) Has(name borges.RepositoryID) (bool, borges.LibraryID, borges.
 
 		loc, _ := location.(*Location)
 
-		has, err := loc.has(ctx, name)
+		has, err := loc.HasContext(ctx, name)
 		if err != nil {
 			return false, "", "", err
 		}
@@ -223,11 +356,57 @@ func (l *Library) Has(name borges.RepositoryID) (bool, borges.LibraryID, borges.
 	}
 }
 
+func (l *Library) hasIndexed(
+	ctx context.Context,
+	name borges.RepositoryID,
+) (bool, borges.LibraryID, borges.LocationID, error) {
+	select {
+	case <-ctx.Done():
+		return false, "", "", ctx.Err()
+	default:
+	}
+
+	locID, ok, err := l.index.get(name)
+	if os.IsNotExist(err) {
+		if err = l.index.rebuild(ctx, l); err != nil {
+			return false, "", "", err
+		}
+
+		locID, ok, err = l.index.get(name)
+	}
+
+	if err != nil || !ok {
+		return false, "", "", err
+	}
+
+	return true, l.id, locID, nil
+}
+
+// RebuildIndex generates the repository index from scratch reading all the
+// locations of the library. Repositories committed while the index is being
+// rebuilt may not be included. It returns ErrIndexNotEnabled if the library
+// was created without the Index option.
+func (l *Library) RebuildIndex(ctx context.Context) error {
+	if l.index == nil {
+		return ErrIndexNotEnabled.New()
+	}
+
+	return l.index.rebuild(ctx, l)
+}
+
 // Repositories implements borges.Library interface.
 func (l *Library) Repositories(mode borges.Mode) (borges.RepositoryIterator, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), l.options.Timeout)
 	defer cancel()
 
+	return l.RepositoriesContext(ctx, mode)
+}
+
+// RepositoriesContext implements borges.ContextLibrary interface.
+func (l *Library) RepositoriesContext(
+	ctx context.Context,
+	mode borges.Mode,
+) (borges.RepositoryIterator, error) {
 	locs, err := l.locations(ctx)
 	if err != nil {
 		return nil, err
@@ -238,7 +417,26 @@ func (l *Library) Repositories(mode borges.Mode) (borges.RepositoryIterator, err
 
 // Location implements borges.Library interface.
 func (l *Library) Location(id borges.LocationID) (borges.Location, error) {
-	return l.location(id, false)
+	return l.LocationContext(context.Background(), id)
+}
+
+// LocationContext implements borges.ContextLibrary interface.
+func (l *Library) LocationContext(
+	ctx context.Context,
+	id borges.LocationID,
+) (borges.Location, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	loc, err := l.location(id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return loc, nil
 }
 
 // AddLocation creates a new borges.Location if it does not exist.
@@ -246,20 +444,25 @@ func (l *Library) AddLocation(id borges.LocationID) (borges.Location, error) {
 	l.locMu.Lock()
 	defer l.locMu.Unlock()
 
-	_, err := l.Location(id)
+	_, err := l.location(id, false)
 	if err == nil {
 		return nil, ErrLocationExists.New(id)
 	}
 
-	return l.location(id, true)
+	loc, err := l.location(id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return loc, nil
 }
 
-func (l *Library) location(id borges.LocationID, create bool) (borges.Location, error) {
+func (l *Library) location(id borges.LocationID, create bool) (*Location, error) {
 	if loc, ok := l.locReg.Get(id); ok {
 		return loc, nil
 	}
 
-	path := buildSivaPath(id, l.options.Bucket)
+	path := l.sivaPath(id)
 	loc, err := newLocation(id, l, path, create)
 	if err != nil {
 		return nil, err
@@ -269,29 +472,129 @@ func (l *Library) location(id borges.LocationID, create bool) (borges.Location,
 	return loc, nil
 }
 
-func buildSivaPath(id borges.LocationID, bucket int) string {
-	return buildPath(id, bucket, ".siva")
+// layout returns the PathLayout used to create siva files.
+func (l *Library) layout() PathLayout {
+	if l.options.PathLayout != nil {
+		return l.options.PathLayout
+	}
+
+	return BucketLayout(l.options.Bucket)
 }
 
-func buildSivaMetadataPath(id borges.LocationID, bucket int) string {
-	return buildPath(id, bucket, locMetadataFileExt)
+// layouts returns all the PathLayouts used to search siva files, the
+// library one and the ones for ReadBuckets levels.
+func (l *Library) layouts() []PathLayout {
+	layouts := []PathLayout{l.layout()}
+	for _, b := range l.options.ReadBuckets {
+		layout := BucketLayout(b)
+		found := false
+		for _, e := range layouts {
+			if e == PathLayout(layout) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			layouts = append(layouts, layout)
+		}
+	}
+
+	return layouts
 }
 
-func buildPath(id borges.LocationID, bucket int, suffix string) string {
-	name := string(id) + suffix
-	if bucket == 0 {
-		return name
+// sivaPath returns the path of the siva file for the location. When it
+// does not exist in any of the layouts the one from the library layout is
+// returned.
+func (l *Library) sivaPath(id borges.LocationID) string {
+	layouts := l.layouts()
+	path := layouts[0].Path(id)
+	if len(layouts) == 1 {
+		return path
 	}
 
-	r := []rune(id)
-	var bucketDir string
-	if len(r) < bucket {
-		bucketDir = string(id) + strings.Repeat("-", bucket-len(r))
-	} else {
-		bucketDir = string(r[:bucket])
+	for _, layout := range layouts {
+		p := layout.Path(id)
+		if _, err := l.fs.Stat(p); err == nil {
+			return p
+		}
+	}
+
+	return path
+}
+
+// locationFile is a file of a location found by glob.
+type locationFile struct {
+	id   borges.LocationID
+	path string
+}
+
+// glob returns the files of the locations in all the layouts used by the
+// library. The suffix is appended to the siva file names, for example to
+// find checkpoint files.
+func (l *Library) glob(suffix string) ([]locationFile, error) {
+	var files []locationFile
+	for _, layout := range l.layouts() {
+		matches, err := butil.Glob(l.fs, layout.Pattern()+suffix)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matches {
+			id, ok := layout.ID(strings.TrimSuffix(m, suffix))
+			if !ok {
+				continue
+			}
+
+			files = append(files, locationFile{id: id, path: m})
+		}
+	}
+
+	return files, nil
+}
+
+// misplaced returns the siva files matched by the patterns of the library
+// layouts that are not in the path of their location in any of them.
+func (l *Library) misplaced() ([]locationFile, error) {
+	layouts := l.layouts()
+	seen := make(map[string]struct{})
+	var files []locationFile
+	for _, layout := range layouts {
+		matches, err := butil.Glob(l.fs, layout.Pattern())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matches {
+			if _, ok := seen[m]; ok {
+				continue
+			}
+			seen[m] = struct{}{}
+
+			id := toLocID(filepath.Base(m))
+			if id == "" || inLayouts(layouts, m) {
+				continue
+			}
+
+			files = append(files, locationFile{id: id, path: m})
+		}
 	}
 
-	return filepath.Join(bucketDir, name)
+	return files, nil
+}
+
+func inLayouts(layouts []PathLayout, path string) bool {
+	for _, layout := range layouts {
+		if _, ok := layout.ID(path); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func buildSivaPath(id borges.LocationID, bucket int) string {
+	return BucketLayout(bucket).Path(id)
 }
 
 // Locations implements borges.Library interface.
@@ -299,6 +602,13 @@ func (l *Library) Locations() (borges.LocationIterator, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), l.options.Timeout)
 	defer cancel()
 
+	return l.LocationsContext(ctx)
+}
+
+// LocationsContext implements borges.ContextLibrary interface.
+func (l *Library) LocationsContext(
+	ctx context.Context,
+) (borges.LocationIterator, error) {
 	locs, err := l.locations(ctx)
 	if err != nil {
 		return nil, err
@@ -310,22 +620,18 @@ func (l *Library) Locations() (borges.LocationIterator, error) {
 func (l *Library) locations(ctx context.Context) ([]borges.Location, error) {
 	var locs []borges.Location
 
-	pattern := filepath.Join(
-		strings.Repeat("?", l.options.Bucket),
-		"*.siva",
-	)
-
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
 
-	sivas, err := butil.Glob(l.fs, pattern)
+	sivas, err := l.glob("")
 	if err != nil {
 		return nil, err
 	}
 
+	seen := make(map[borges.LocationID]struct{}, len(sivas))
 	for _, s := range sivas {
 		select {
 		case <-ctx.Done():
@@ -333,8 +639,13 @@ func (l *Library) locations(ctx context.Context) ([]borges.Location, error) {
 		default:
 		}
 
-		siva := filepath.Base(s)
-		loc, err := l.Location(toLocID(siva))
+		id := s.id
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		loc, err := l.location(id, false)
 		if err != nil {
 			continue
 		}
@@ -345,8 +656,13 @@ func (l *Library) locations(ctx context.Context) ([]borges.Location, error) {
 	return locs, nil
 }
 
-// Version returns version stored in metadata or -1 if not defined.
+// Version returns version stored in metadata or -1 if not defined. If
+// ReadVersion option is set that version is returned instead.
 func (l *Library) Version() (int, error) {
+	if l.options.ReadVersion != nil {
+		return *l.options.ReadVersion, nil
+	}
+
 	if l.metadata != nil {
 		return l.metadata.version()
 	}
@@ -117,3 +117,47 @@ func TestLibraryRepositoriesError(t *testing.T) {
 	require.Equal(2, errors)
 	require.Equal(5, repos)
 }
+
+func TestContextCanceled(t *testing.T) {
+	var req = require.New(t)
+
+	lib := setupLibrary(t, "test", &LibraryOptions{Bucket: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := lib.LocationsContext(ctx)
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = lib.RepositoriesContext(ctx, borges.ReadOnlyMode)
+	req.EqualError(err, context.Canceled.Error())
+
+	_, _, _, err = lib.HasContext(ctx, "github.com/foo/bar")
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = lib.GetContext(ctx, "github.com/foo/bar", borges.ReadOnlyMode)
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = lib.LocationContext(ctx, "foo-bar")
+	req.EqualError(err, context.Canceled.Error())
+
+	l, err := lib.Location("foo-bar")
+	req.NoError(err)
+
+	loc, ok := l.(borges.ContextLocation)
+	req.True(ok)
+
+	_, err = loc.HasContext(ctx, "github.com/foo/bar")
+	req.EqualError(err, context.Canceled.Error())
+
+	_, err = loc.GetContext(ctx, "github.com/foo/bar", borges.ReadOnlyMode)
+	req.EqualError(err, context.Canceled.Error())
+
+	has, _, locID, err := lib.HasContext(
+		context.Background(),
+		"github.com/foo/bar",
+	)
+	req.NoError(err)
+	req.True(has)
+	req.Equal(borges.LocationID("foo-bar"), locID)
+}
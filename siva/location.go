@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,8 +14,11 @@ import (
 	billy "gopkg.in/src-d/go-billy.v4"
 	"gopkg.in/src-d/go-billy.v4/memfs"
 	"gopkg.in/src-d/go-errors.v1"
+	git "gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	"gopkg.in/src-d/go-git.v4/storage"
 	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
@@ -48,7 +52,10 @@ type Location struct {
 	m sync.RWMutex
 }
 
-var _ borges.Location = (*Location)(nil)
+var (
+	_ borges.ContextLocation = (*Location)(nil)
+	_ borges.RemoverLocation = (*Location)(nil)
+)
 
 // newLocation creates a new Location struct. If create is true and the siva
 // file does not exist a new siva file is created.
@@ -61,7 +68,7 @@ func newLocation(
 	var metadata *locationMetadata
 	if lib.metadata != nil {
 		var err error
-		mPath := buildSivaMetadataPath(id, lib.options.Bucket)
+		mPath := metadataPath(path)
 		metadata, err = loadOrCreateLocationMetadata(lib.fs, mPath)
 		if err != nil {
 			// TODO: skip metadata if corrupted? log a warning?
@@ -87,6 +94,7 @@ func newLocation(
 		loc,
 		lib.locReg,
 		lib.options.TransactionTimeout,
+		newFileLock(lib.fs, path, lib.options.StaleLockTimeout),
 	)
 
 	return loc, nil
@@ -141,26 +149,38 @@ func (l *Location) updateCache(cp *checkpoint) error {
 	}
 	defer fs.Sync()
 
-	var sto storage.Storer
-	sto = filesystem.NewStorage(fs, l.cache())
-	refIter, err := sto.IterReferences()
+	refs, c, err := readRefsAndConfig(filesystem.NewStorage(fs, l.cache()))
 	if err != nil {
 		return err
 	}
 
-	refSto, err := NewRefStorage(refIter)
+	l.refs = refs
+	l.config = c
+
+	return nil
+}
+
+// readRefsAndConfig reads the references and configuration from a storage
+// so they can be cached.
+func readRefsAndConfig(
+	sto storage.Storer,
+) (memory.ReferenceStorage, *config.Config, error) {
+	refIter, err := sto.IterReferences()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refs, err := NewRefStorage(refIter)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	l.refs = refSto
 
 	c, err := sto.Config()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	l.config = c
 
-	return nil
+	return refs, c, nil
 }
 
 // FS returns a filesystem for the location's siva file.
@@ -179,35 +199,12 @@ func (l *Location) FS(mode borges.Mode) (sivafs.SivaFS, error) {
 
 func (l *Location) fs(mode borges.Mode, cp *checkpoint) (sivafs.SivaFS, error) {
 	if mode == borges.ReadOnlyMode {
-		offset := cp.Offset()
-		if offset == 0 {
-			return nil, borges.ErrLocationNotExists.New(string(l.id))
-		}
-
-		if l.lib.metadata != nil {
-			version, err := l.lib.Version()
-			if err != nil {
-				return nil, err
-			}
-
-			o, err := l.metadata.offset(version)
-			if err != nil {
-				return nil, err
-			}
-
-			if o > 0 {
-				offset = o
-			}
+		version, err := l.lib.Version()
+		if err != nil {
+			return nil, err
 		}
 
-		return sivafs.NewFilesystemWithOptions(
-			l.lib.fs, l.path, memfs.New(),
-			sivafs.SivaFSOptions{
-				UnsafePaths: true,
-				ReadOnly:    true,
-				Offset:      offset,
-			},
-		)
+		return l.versionFS(cp, version)
 	}
 
 	if err := cp.Apply(); err != nil {
@@ -228,6 +225,42 @@ func (l *Location) fs(mode borges.Mode, cp *checkpoint) (sivafs.SivaFS, error) {
 	return sfs, nil
 }
 
+// versionFS returns a read only filesystem for the siva file as it was in
+// the given version. When the library has no metadata the last committed
+// state is used.
+func (l *Location) versionFS(cp *checkpoint, version int) (sivafs.SivaFS, error) {
+	offset := cp.Offset()
+	if offset == 0 {
+		return nil, borges.ErrLocationNotExists.New(string(l.id))
+	}
+
+	if l.lib.metadata != nil {
+		o, err := l.metadata.offset(version)
+		if err != nil {
+			return nil, err
+		}
+
+		if o > 0 {
+			offset = o
+		}
+	}
+
+	return l.offsetFS(offset)
+}
+
+// offsetFS returns a read only filesystem for the siva file with the index
+// at the given offset.
+func (l *Location) offsetFS(offset uint64) (sivafs.SivaFS, error) {
+	return sivafs.NewFilesystemWithOptions(
+		l.lib.fs, l.path, memfs.New(),
+		sivafs.SivaFSOptions{
+			UnsafePaths: true,
+			ReadOnly:    true,
+			Offset:      offset,
+		},
+	)
+}
+
 // ID implements the borges.Location interface.
 func (l *Location) ID() borges.LocationID {
 	return l.id
@@ -246,9 +279,23 @@ const (
 
 // Init implements the borges.Location interface.
 func (l *Location) Init(id borges.RepositoryID) (borges.Repository, error) {
-	id = toRepoID(id.String())
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		l.lib.options.Timeout,
+	)
+	defer cancel()
+
+	return l.InitContext(ctx, id)
+}
 
-	has, err := l.Has(id)
+// InitContext implements the borges.ContextLocation interface.
+func (l *Location) InitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	id = borges.NormalizeRepositoryID(id.String())
+
+	has, err := l.HasContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -262,6 +309,17 @@ func (l *Location) Init(id borges.RepositoryID) (borges.Repository, error) {
 		return nil, err
 	}
 
+	if err := createRemote(repo.R(), id); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// createRemote adds to the repository the remote for the given ID. Its
+// references are fetched under refs/remotes/<id>/. The repository is set as
+// bare when it's the first remote.
+func createRemote(r *git.Repository, id borges.RepositoryID) error {
 	cfg := &config.RemoteConfig{
 		Name: id.String(),
 		URLs: []string{fmt.Sprintf(urlSchema, id.String())},
@@ -271,38 +329,53 @@ func (l *Location) Init(id borges.RepositoryID) (borges.Repository, error) {
 		},
 	}
 
-	_, err = repo.R().CreateRemote(cfg)
+	_, err := r.CreateRemote(cfg)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	remotes, err := repo.R().Remotes()
+	remotes, err := r.Remotes()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if len(remotes) == 1 {
-		c, err := repo.R().Config()
+		c, err := r.Config()
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		c.Core.IsBare = true
-		if err := repo.R().Storer.SetConfig(c); err != nil {
-			return nil, err
+		if err := r.Storer.SetConfig(c); err != nil {
+			return err
 		}
 	}
 
-	return repo, nil
+	return nil
 }
 
 // Get implements the borges.Location interface.
 func (l *Location) Get(id borges.RepositoryID, mode borges.Mode) (borges.Repository, error) {
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		l.lib.options.Timeout,
+	)
+	defer cancel()
+
+	return l.GetContext(ctx, id, mode)
+}
+
+// GetContext implements the borges.ContextLocation interface.
+func (l *Location) GetContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+	mode borges.Mode,
+) (borges.Repository, error) {
 	if id == "" {
 		return l.repository(id, mode)
 	}
 
-	has, err := l.Has(id)
+	has, err := l.HasContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -316,7 +389,21 @@ func (l *Location) Get(id borges.RepositoryID, mode borges.Mode) (borges.Reposit
 
 // GetOrInit implements the borges.Location interface.
 func (l *Location) GetOrInit(id borges.RepositoryID) (borges.Repository, error) {
-	has, err := l.Has(id)
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		l.lib.options.Timeout,
+	)
+	defer cancel()
+
+	return l.GetOrInitContext(ctx, id)
+}
+
+// GetOrInitContext implements the borges.ContextLocation interface.
+func (l *Location) GetOrInitContext(
+	ctx context.Context,
+	id borges.RepositoryID,
+) (borges.Repository, error) {
+	has, err := l.HasContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -325,7 +412,7 @@ func (l *Location) GetOrInit(id borges.RepositoryID) (borges.Repository, error)
 		return l.repository(id, borges.RWMode)
 	}
 
-	return l.Init(id)
+	return l.InitContext(ctx, id)
 }
 
 // Has implements the borges.Location interface.
@@ -336,10 +423,11 @@ func (l *Location) Has(repoID borges.RepositoryID) (bool, error) {
 	)
 	defer cancel()
 
-	return l.has(ctx, repoID)
+	return l.HasContext(ctx, repoID)
 }
 
-func (l *Location) has(
+// HasContext implements the borges.ContextLocation interface.
+func (l *Location) HasContext(
 	ctx context.Context,
 	repoID borges.RepositoryID,
 ) (bool, error) {
@@ -374,21 +462,221 @@ func (l *Location) has(
 		return false, err
 	}
 
-	name := toRepoID(repoID.String())
-	for _, r := range config.Remotes {
-		id := toRepoID(r.Name)
+	return hasRemote(config, repoID), nil
+}
+
+// hasRemote checks if the configuration has a remote for the repository.
+func hasRemote(c *config.Config, repoID borges.RepositoryID) bool {
+	name := borges.NormalizeRepositoryID(repoID.String())
+	for _, id := range remoteIDs(c) {
 		if id == name {
-			return true, nil
+			return true
 		}
-		for _, url := range r.URLs {
-			id = toRepoID(url)
-			if id == name {
-				return true, nil
+	}
+
+	return false
+}
+
+// Remove implements the borges.RemoverLocation interface. The remote of the
+// repository and all its references under refs/remotes/<id>/ are deleted. In
+// transactional mode the changes are committed atomically. The objects are
+// kept in the siva file until the location is compacted.
+func (l *Location) Remove(id borges.RepositoryID) error {
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		l.lib.options.Timeout,
+	)
+	defer cancel()
+
+	id = borges.NormalizeRepositoryID(id.String())
+	has, err := l.HasContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !has {
+		return borges.ErrRepositoryNotExists.New(id)
+	}
+
+	repo, err := l.repository("", borges.RWMode)
+	if err != nil {
+		return err
+	}
+
+	if err := removeRemote(repo.R(), id); err != nil {
+		_ = repo.Close()
+		return err
+	}
+
+	if l.lib.options.Transactional {
+		return repo.Commit()
+	}
+
+	return repo.Close()
+}
+
+// removeRemote deletes from the repository the remote matching the given ID
+// by name or URL and all the references fetched from it.
+func removeRemote(r *git.Repository, id borges.RepositoryID) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	remote := findRemote(cfg, id)
+	if remote == nil {
+		return borges.ErrRepositoryNotExists.New(id)
+	}
+
+	refs, err := remoteReferences(r.Storer, remote, id)
+	if err != nil {
+		return err
+	}
+
+	if err := r.DeleteRemote(remote.Name); err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if err := r.Storer.RemoveReference(ref.Name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findRemote returns the remote matching the given ID by name or URL or nil
+// if it's not found.
+func findRemote(cfg *config.Config, id borges.RepositoryID) *config.RemoteConfig {
+	var remote *config.RemoteConfig
+	for _, rc := range cfg.Remotes {
+		if borges.NormalizeRepositoryID(rc.Name) == id {
+			remote = rc
+			break
+		}
+
+		for _, url := range rc.URLs {
+			if borges.NormalizeRepositoryID(url) == id {
+				remote = rc
+			}
+		}
+	}
+
+	return remote
+}
+
+// remoteReferences returns the references fetched from a remote. These are
+// the ones under refs/remotes/<id>/ and the destinations of the remote fetch
+// refspecs.
+func remoteReferences(
+	sto storer.ReferenceStorer,
+	remote *config.RemoteConfig,
+	id borges.RepositoryID,
+) ([]*plumbing.Reference, error) {
+	prefixes := []string{
+		remotesBase + id.String() + "/",
+		remotesBase + remote.Name + "/",
+	}
+
+	var names []string
+	for _, spec := range remote.Fetch {
+		dst := spec.String()[strings.Index(spec.String(), ":")+1:]
+		if i := strings.Index(dst, "*"); i >= 0 {
+			prefixes = append(prefixes, dst[:i])
+		} else {
+			names = append(names, dst)
+		}
+	}
+
+	iter, err := sto.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().String()
+		for _, n := range names {
+			if name == n {
+				refs = append(refs, ref)
+				return nil
+			}
+		}
+
+		for _, p := range prefixes {
+			if strings.HasPrefix(name, p) {
+				refs = append(refs, ref)
+				return nil
 			}
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return false, nil
+	return refs, nil
+}
+
+// repositoryIDs returns the IDs of all the repositories contained in the
+// location, including the ones derived from the remote URLs.
+// repositoryIDs returns the repositories of the last committed state of the
+// location. Unlike read only repositories it does not depend on the version
+// of the library, so the index always has the latest repositories.
+func (l *Location) repositoryIDs() ([]borges.RepositoryID, error) {
+	_, err := l.lib.fs.Stat(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	cp, err := newCheckpoint(l.lib.fs, l.path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if cp.Offset() == 0 {
+		return nil, nil
+	}
+
+	fs, err := l.offsetFS(cp.Offset())
+	if err != nil {
+		return nil, err
+	}
+	defer fs.Sync()
+
+	cfg, err := filesystem.NewStorage(fs, l.cache()).Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return remoteIDs(cfg), nil
+}
+
+// updateIndex writes the current repositories of the location to the
+// library index. When the index does not exist yet nothing is done as it
+// will be fully built on first use.
+func (l *Location) updateIndex() error {
+	if l.lib.index == nil {
+		return nil
+	}
+
+	ids, err := l.repositoryIDs()
+	if err != nil {
+		return err
+	}
+
+	err = l.lib.index.set(l.id, ids)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
 }
 
 // Repositories implements the borges.Location interface.
@@ -399,10 +687,11 @@ func (l *Location) Repositories(mode borges.Mode) (borges.RepositoryIterator, er
 	)
 	defer cancel()
 
-	return l.repositories(ctx, mode)
+	return l.RepositoriesContext(ctx, mode)
 }
 
-func (l *Location) repositories(
+// RepositoriesContext implements the borges.ContextLocation interface.
+func (l *Location) RepositoriesContext(
 	ctx context.Context,
 	mode borges.Mode,
 ) (borges.RepositoryIterator, error) {
@@ -472,12 +761,13 @@ func (l *Location) Commit(mode borges.Mode) error {
 
 	defer l.txer.Stop()
 	l.m.RLock()
-	defer l.m.RUnlock()
-	if err := l.checkpoint.Reset(); err != nil {
+	err := l.checkpoint.Reset()
+	l.m.RUnlock()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return l.updateIndex()
 }
 
 // Rollback discard transactional or write operations performed on the repositories.
@@ -496,6 +786,56 @@ func (l *Location) Rollback(mode borges.Mode) error {
 	return nil
 }
 
+// startTransaction saves a checkpoint with the current siva file size. It
+// must be called after acquiring the transactioner. A checkpoint file left
+// by a transaction that didn't finish, for example from a process that
+// crashed, is applied first to discard its partial writes.
+func (l *Location) startTransaction() error {
+	if _, err := l.recoverCheckpoint(); err != nil {
+		return err
+	}
+
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return l.checkpoint.Save()
+}
+
+// recoverCheckpoint reloads the checkpoint from the filesystem, as it could
+// be modified by other process, and applies it. It must be called after
+// acquiring the transactioner. When there was a checkpoint file the changes
+// done to the siva file are returned, otherwise it returns nil.
+func (l *Location) recoverCheckpoint() (*Recovery, error) {
+	cp, err := newCheckpoint(l.lib.fs, l.path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var recovery *Recovery
+	if cp.persisted {
+		var size int64
+		stat, err := l.lib.fs.Stat(l.path)
+		if err == nil {
+			size = stat.Size()
+		}
+
+		recovery = &Recovery{
+			Location: l.id,
+			Size:     size,
+			Offset:   cp.offset,
+		}
+	}
+
+	if err := cp.Apply(); err != nil {
+		return nil, err
+	}
+
+	l.m.Lock()
+	l.checkpoint = cp
+	l.m.Unlock()
+
+	return recovery, nil
+}
+
 func (l *Location) cache() cache.Object {
 	if l.lib.options.Cache != nil {
 		return l.lib.options.Cache
@@ -527,17 +867,8 @@ func (l *Location) repository(
 			return nil, err
 		}
 
-		gitStorerOptions := filesystem.Options{}
-		if l.lib.options.Performance {
-			gitStorerOptions = filesystem.Options{
-				ExclusiveAccess: true,
-				KeepDescriptors: true,
-			}
-		}
-
-		sync := fs.(sivafs.SivaSync)
-		sto = filesystem.NewStorageWithOptions(fs, l.cache(), gitStorerOptions)
-		sto, err = NewReadOnlyStorerInitialized(sto, sync, l.refs, l.config)
+		sto, err = NewReadOnlyStorerInitialized(
+			l.gitStorage(fs), fs.(sivafs.SivaSync), l.refs, l.config)
 		if err != nil {
 			return nil, err
 		}
@@ -547,12 +878,10 @@ func (l *Location) repository(
 				return nil, err
 			}
 
-			l.m.RLock()
-			if err := l.checkpoint.Save(); err != nil {
-				l.m.RUnlock()
+			if err := l.startTransaction(); err != nil {
+				l.txer.Stop()
 				return nil, err
 			}
-			l.m.RUnlock()
 		}
 
 		sivaSto, err := NewStorage(l.lib.fs, l.path, l.lib.tmp,
@@ -579,9 +908,79 @@ func (l *Location) repository(
 	return newRepository(id, sto, fs, mode, l.lib.options.Transactional, l)
 }
 
+// gitStorage returns a git storage for a read only siva filesystem.
+func (l *Location) gitStorage(fs billy.Filesystem) storage.Storer {
+	gitStorerOptions := filesystem.Options{}
+	if l.lib.options.Performance {
+		gitStorerOptions = filesystem.Options{
+			ExclusiveAccess: true,
+			KeepDescriptors: true,
+		}
+	}
+
+	return filesystem.NewStorageWithOptions(fs, l.cache(), gitStorerOptions)
+}
+
+// GetAtVersion opens the repository with the given RepositoryID in read only
+// mode as it was in the given location version, independently of the
+// version of the library. If the version does not exist the closest previous
+// one is used, the same way as with the library version. If the repository
+// can't be found in that version ErrRepositoryNotExists is returned. An
+// empty id opens the location repository.
+func (l *Location) GetAtVersion(
+	id borges.RepositoryID,
+	version int,
+) (borges.Repository, error) {
+	if err := l.checkAndUpdate(); err != nil {
+		return nil, err
+	}
+
+	l.m.RLock()
+	cp := l.checkpoint
+	l.m.RUnlock()
+
+	fs, err := l.versionFS(cp, version)
+	if err != nil {
+		if id != "" && borges.ErrLocationNotExists.Is(err) {
+			return nil, borges.ErrRepositoryNotExists.New(id)
+		}
+
+		return nil, err
+	}
+
+	sto := l.gitStorage(fs)
+	refs, c, err := readRefsAndConfig(sto)
+	if err != nil {
+		fs.Sync()
+		return nil, err
+	}
+
+	if id != "" && !hasRemote(c, id) {
+		fs.Sync()
+		return nil, borges.ErrRepositoryNotExists.New(id)
+	}
+
+	sto, err = NewReadOnlyStorerInitialized(sto, fs.(sivafs.SivaSync), refs, c)
+	if err != nil {
+		fs.Sync()
+		return nil, err
+	}
+
+	if id != "" && l.lib.options.RootedRepo {
+		sto = NewRootedStorage(sto, string(id))
+	}
+
+	return newRepository(id, sto, fs, borges.ReadOnlyMode,
+		l.lib.options.Transactional, l)
+}
+
 // LastVersion returns the last defined version number in metadata or -1 if
 // there are not versions.
 func (l *Location) LastVersion() int {
+	if l.metadata == nil {
+		return -1
+	}
+
 	return l.metadata.last()
 }
 
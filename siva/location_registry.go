@@ -87,3 +87,14 @@ func (r *locationRegistry) EndTransaction(l *Location) {
 		r.cache.Add(l.ID(), l)
 	}
 }
+
+// Remove deletes a location from the registry.
+func (r *locationRegistry) Remove(id borges.LocationID) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	delete(r.used, id)
+	if r.cache != nil {
+		r.cache.Remove(id)
+	}
+}
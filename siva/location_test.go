@@ -322,3 +322,67 @@ func (s *locationSuite) TestRepositories() {
 	require.NoError(err)
 	require.ElementsMatch(repoIDs, names)
 }
+
+func (s *locationSuite) TestRemove() {
+	require := s.Require()
+
+	location, err := s.lib.Location("foo-bar")
+	require.NoError(err)
+
+	commit := func(r borges.Repository) {
+		if s.transactional {
+			require.NoError(r.Commit())
+		} else {
+			require.NoError(r.Close())
+		}
+	}
+
+	r, err := location.Init("github.com/foo/no")
+	require.NoError(err)
+	commit(r)
+
+	hash := plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d")
+	r, err = location.Get("", borges.RWMode)
+	require.NoError(err)
+	for _, name := range []plumbing.ReferenceName{
+		// fetch refspec destination of the remote
+		"refs/remotes/0168e2c7-eedc-7358-0a09-39ba833bdd54/master",
+		"refs/remotes/github.com/foo/bar/tags/v1",
+		"refs/remotes/github.com/foo/no/heads/master",
+	} {
+		ref := plumbing.NewHashReference(name, hash)
+		require.NoError(r.R().Storer.SetReference(ref))
+	}
+	commit(r)
+
+	err = location.(*Location).Remove("github.com/foo/nope")
+	require.True(borges.ErrRepositoryNotExists.Is(err))
+
+	err = location.(*Location).Remove("https://github.com/foo/bar.git")
+	require.NoError(err)
+
+	has, err := location.Has("github.com/foo/bar")
+	require.NoError(err)
+	require.False(has)
+
+	has, err = location.Has("github.com/foo/no")
+	require.NoError(err)
+	require.True(has)
+
+	r, err = location.Get("", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer r.Close()
+
+	refs, err := r.R().References()
+	require.NoError(err)
+
+	var names []string
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		names = append(names, ref.Name().String())
+		return nil
+	})
+	require.NoError(err)
+	require.Contains(names, "refs/remotes/github.com/foo/no/heads/master")
+	require.NotContains(names, "refs/remotes/0168e2c7-eedc-7358-0a09-39ba833bdd54/master")
+	require.NotContains(names, "refs/remotes/github.com/foo/bar/tags/v1")
+}
@@ -0,0 +1,352 @@
+package siva
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+const (
+	lockExtension  = ".lock"
+	guardExtension = ".guard"
+	lockRetry      = 50 * time.Millisecond
+)
+
+// fileLock is an advisory lock held in a file next to the siva file. It
+// guards transactions from other processes sharing the same filesystem.
+//
+// The lock file contains a random token, the host name, the process id and
+// the time of the last refresh. While the lock is held the time is refreshed
+// periodically so other processes can tell apart locks from crashed
+// processes. A lock is considered stale when its owner is a process of the
+// same host that does not exist anymore or when it was not refreshed in the
+// stale duration.
+//
+// The lock file is only read and modified while holding an exclusive lock
+// of the operating system on a guard file, so checking a stale lock and
+// replacing it, or refreshing it, is atomic between processes. The guard
+// file is never deleted as other processes may be waiting for it.
+type fileLock struct {
+	fs    billy.Filesystem
+	path  string
+	guard string
+	stale time.Duration
+
+	token string
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newFileLock(
+	fs billy.Filesystem,
+	path string,
+	stale time.Duration,
+) *fileLock {
+	return &fileLock{
+		fs:    fs,
+		path:  path + lockExtension,
+		guard: path + lockExtension + guardExtension,
+		stale: stale,
+	}
+}
+
+// Lock tries to acquire the lock until it succeeds or the timeout channel
+// is closed or receives a value. It returns false when the lock could not be
+// acquired before the timeout.
+func (l *fileLock) Lock(timeout <-chan time.Time) (bool, error) {
+	for {
+		ok, err := l.tryLock()
+		if err != nil || ok {
+			return ok, err
+		}
+
+		select {
+		case <-timeout:
+			return false, nil
+		case <-time.After(lockRetry):
+		}
+	}
+}
+
+// Unlock releases the lock and deletes the lock file if it's still owned by
+// this lock.
+func (l *fileLock) Unlock() error {
+	if l.token == "" {
+		return nil
+	}
+
+	token := l.token
+	l.token = ""
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop, l.done = nil, nil
+	}
+
+	unlock, err := l.lockGuard()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	info, err := l.read()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.token != token {
+		return nil
+	}
+
+	return cleanup(l.fs, l.path)
+}
+
+// lockGuard acquires the guard lock and returns the function to release it.
+// In filesystems without locking support it does not guard anything and
+// tryLock relies on the exclusive creation of the lock file.
+func (l *fileLock) lockGuard() (func(), error) {
+	f, err := l.fs.OpenFile(l.guard, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.Lock(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = f.Unlock()
+		_ = f.Close()
+	}, nil
+}
+
+func (l *fileLock) tryLock() (bool, error) {
+	unlock, err := l.lockGuard()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	info, err := l.read()
+	if err == nil && !l.isStale(info) {
+		return false, nil
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if err == nil {
+		if err := cleanup(l.fs, l.path); err != nil {
+			return false, err
+		}
+	}
+
+	token := uuid.New().String()
+	f, err := l.fs.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	_, err = f.Write(lockOwner(token).bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup(l.fs, l.path)
+		return false, err
+	}
+
+	// some filesystems do not support O_EXCL so the owner is checked to
+	// make sure another process did not create the lock at the same time
+	info, err = l.read()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if info.token != token {
+		return false, nil
+	}
+
+	l.token = token
+	if l.stale > 0 {
+		l.stop = make(chan struct{})
+		l.done = make(chan struct{})
+		go l.refresh(token, l.stop, l.done)
+	}
+
+	return true, nil
+}
+
+// refresh updates the time of the lock file until stop is closed.
+func (l *fileLock) refresh(token string, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(l.stale / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !l.touch(token) {
+				// the lock was broken by other process, nothing to do
+				return
+			}
+		}
+	}
+}
+
+// touch updates the time of the lock file if it's still owned by token.
+func (l *fileLock) touch(token string) bool {
+	unlock, err := l.lockGuard()
+	if err != nil {
+		// try again in the next refresh
+		return true
+	}
+	defer unlock()
+
+	info, err := l.read()
+	if err != nil || info.token != token {
+		return false
+	}
+
+	err = util.WriteFile(l.fs, l.path, lockOwner(token).bytes(), 0666)
+	return err == nil
+}
+
+func (l *fileLock) read() (*lockInfo, error) {
+	f, err := l.fs.Open(l.path)
+	if err != nil {
+		return &lockInfo{}, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return &lockInfo{}, err
+	}
+
+	info, err := parseLockInfo(data)
+	if err != nil {
+		// the lock file can be read while it's being written, it's only
+		// considered stale if it stays malformed for too long
+		stat, serr := l.fs.Stat(l.path)
+		if serr != nil {
+			return &lockInfo{}, serr
+		}
+
+		return &lockInfo{time: stat.ModTime()}, nil
+	}
+
+	return info, nil
+}
+
+func (l *fileLock) isStale(info *lockInfo) bool {
+	if l.stale > 0 && time.Since(info.time) > l.stale {
+		return true
+	}
+
+	if info.pid == 0 {
+		return false
+	}
+
+	if hostname() != info.host {
+		return false
+	}
+
+	return !processExists(info.pid)
+}
+
+type lockInfo struct {
+	token string
+	host  string
+	pid   int
+	time  time.Time
+}
+
+func lockOwner(token string) *lockInfo {
+	return &lockInfo{
+		token: token,
+		host:  hostname(),
+		pid:   os.Getpid(),
+		time:  time.Now(),
+	}
+}
+
+func (i *lockInfo) bytes() []byte {
+	return []byte(fmt.Sprintf("%s %s %d %d\n",
+		i.token, i.host, i.pid, i.time.UnixNano()))
+}
+
+func parseLockInfo(data []byte) (*lockInfo, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) != 4 {
+		return nil, ErrMalformedData.New()
+	}
+
+	pid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, ErrMalformedData.Wrap(err)
+	}
+
+	nsec, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, ErrMalformedData.Wrap(err)
+	}
+
+	return &lockInfo{
+		token: fields[0],
+		host:  fields[1],
+		pid:   pid,
+		time:  time.Unix(0, nsec),
+	}, nil
+}
+
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+
+	return host
+}
+
+// processExists checks if a process with the given pid is running in this
+// host.
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	// in windows FindProcess fails if the process does not exist
+	if runtime.GOOS == "windows" {
+		return true
+	}
+
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
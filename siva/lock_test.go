@@ -0,0 +1,261 @@
+package siva
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+// nonExistentPID is greater than the maximum pid allowed in linux.
+const nonExistentPID = 1 << 23
+
+func TestFileLock(t *testing.T) {
+	require := require.New(t)
+
+	fs := memfs.New()
+	l1 := newFileLock(fs, "foo.siva", time.Minute)
+	l2 := newFileLock(fs, "foo.siva", time.Minute)
+
+	ok, err := l1.Lock(time.After(time.Second))
+	require.NoError(err)
+	require.True(ok)
+
+	_, err = fs.Stat("foo.siva" + lockExtension)
+	require.NoError(err)
+
+	ok, err = l2.Lock(time.After(100 * time.Millisecond))
+	require.NoError(err)
+	require.False(ok)
+
+	require.NoError(l1.Unlock())
+	_, err = fs.Stat("foo.siva" + lockExtension)
+	require.True(os.IsNotExist(err))
+
+	ok, err = l2.Lock(time.After(time.Second))
+	require.NoError(err)
+	require.True(ok)
+	require.NoError(l2.Unlock())
+}
+
+func TestFileLock_Stale(t *testing.T) {
+	tests := []struct {
+		name  string
+		owner *lockInfo
+		stale bool
+	}{
+		{
+			name:  "alive",
+			owner: lockOwner("other"),
+		},
+		{
+			name: "dead process",
+			owner: &lockInfo{
+				token: "other",
+				host:  hostname(),
+				pid:   nonExistentPID,
+				time:  time.Now(),
+			},
+			stale: true,
+		},
+		{
+			name: "other host",
+			owner: &lockInfo{
+				token: "other",
+				host:  "other-" + hostname(),
+				pid:   nonExistentPID,
+				time:  time.Now(),
+			},
+		},
+		{
+			name: "not refreshed",
+			owner: &lockInfo{
+				token: "other",
+				host:  "other-" + hostname(),
+				pid:   os.Getpid(),
+				time:  time.Now().Add(-2 * time.Minute),
+			},
+			stale: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			fs := memfs.New()
+			path := "foo.siva" + lockExtension
+			err := util.WriteFile(fs, path, test.owner.bytes(), 0666)
+			require.NoError(err)
+
+			l := newFileLock(fs, "foo.siva", time.Minute)
+			ok, err := l.Lock(time.After(100 * time.Millisecond))
+			require.NoError(err)
+			require.Equal(test.stale, ok)
+
+			if ok {
+				require.NoError(l.Unlock())
+			}
+		})
+	}
+}
+
+func TestFileLock_Refresh(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "go-borges-lock")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fs := osfs.New(dir)
+	stale := 100 * time.Millisecond
+
+	l1 := newFileLock(fs, "foo.siva", stale)
+	ok, err := l1.Lock(time.After(time.Second))
+	require.NoError(err)
+	require.True(ok)
+
+	l2 := newFileLock(fs, "foo.siva", stale)
+	ok, err = l2.Lock(time.After(4 * stale))
+	require.NoError(err)
+	require.False(ok)
+
+	require.NoError(l1.Unlock())
+}
+
+func TestFileLock_BreakStaleConcurrently(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "go-borges-lock")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fs := osfs.New(dir)
+	owner := &lockInfo{
+		token: "crashed",
+		host:  hostname(),
+		pid:   nonExistentPID,
+		time:  time.Now(),
+	}
+
+	for i := 0; i < 20; i++ {
+		err = util.WriteFile(fs, "foo.siva"+lockExtension, owner.bytes(), 0666)
+		require.NoError(err)
+
+		locks := make([]*fileLock, 8)
+		results := make(chan bool, len(locks))
+		for j := range locks {
+			locks[j] = newFileLock(fs, "foo.siva", 0)
+			go func(l *fileLock) {
+				ok, err := l.tryLock()
+				results <- ok && err == nil
+			}(locks[j])
+		}
+
+		var acquired int
+		for range locks {
+			if <-results {
+				acquired++
+			}
+		}
+
+		// only one of the processes can break the stale lock
+		require.Equal(1, acquired)
+
+		for _, l := range locks {
+			require.NoError(l.Unlock())
+		}
+	}
+}
+
+func TestTransactionLockFile(t *testing.T) {
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/siva", true, 0)
+	opts := &LibraryOptions{
+		Transactional:      true,
+		TransactionTimeout: 100 * time.Millisecond,
+	}
+
+	lib1, err := NewLibrary("test", fs, opts)
+	require.NoError(err)
+	lib2, err := NewLibrary("test", fs, opts)
+	require.NoError(err)
+
+	r1, err := lib1.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+
+	_, err = lib2.Get("github.com/foo/bar", borges.RWMode)
+	require.True(ErrTransactionTimeout.Is(err))
+
+	// other locations are not locked
+	r2, err := lib2.Get("github.com/foo/qux", borges.RWMode)
+	require.NoError(err)
+	require.NoError(r2.Close())
+
+	require.NoError(r1.Close())
+
+	r2, err = lib2.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	require.NoError(r2.Close())
+}
+
+func TestTransactionLockFile_Crashed(t *testing.T) {
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/siva", true, 0)
+	stat, err := fs.Stat("foo-bar.siva")
+	require.NoError(err)
+	size := stat.Size()
+
+	// simulate a process that crashed in the middle of a transaction
+	owner := &lockInfo{
+		token: "crashed",
+		host:  hostname(),
+		pid:   nonExistentPID,
+		time:  time.Now(),
+	}
+	err = util.WriteFile(fs, "foo-bar.siva"+lockExtension, owner.bytes(), 0666)
+	require.NoError(err)
+	err = writeInt64(fs, "foo-bar.siva"+checkpointExtension, size)
+	require.NoError(err)
+
+	f, err := fs.OpenFile("foo-bar.siva", os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(err)
+	_, err = fmt.Fprint(f, "partial write")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	lib, err := NewLibrary("test", fs, &LibraryOptions{
+		Transactional:      true,
+		TransactionTimeout: time.Second,
+	})
+	require.NoError(err)
+
+	r, err := lib.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+
+	stat, err = fs.Stat("foo-bar.siva")
+	require.NoError(err)
+	require.Equal(size, stat.Size())
+
+	createTagOnHead(t, r, "new")
+	require.NoError(r.Commit())
+
+	_, err = fs.Stat("foo-bar.siva" + lockExtension)
+	require.True(os.IsNotExist(err))
+
+	r, err = lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	_, err = r.R().Tag("new")
+	require.NoError(err)
+	require.NoError(r.Close())
+}
@@ -305,9 +305,7 @@ func (m *locationMetadata) closest(v int) int {
 // If there are not Versions defined returns offset 0 that means to use
 // the latest siva index when used with siva filesystem.
 func (m *locationMetadata) offset(c int) (uint64, error) {
-	version := m.last()
-
-	if version < 0 {
+	if m.last() < 0 {
 		return 0, nil
 	}
 
@@ -320,13 +318,30 @@ func (m *locationMetadata) offset(c int) (uint64, error) {
 		return 0, err
 	}
 
-	if closest := m.closest(c); closest >= 0 {
-		version = closest
+	// versions could be reloaded from disk
+	version := m.resolve(c)
+	if version < 0 {
+		return 0, nil
 	}
 
 	return m.Versions[version].Offset, nil
 }
 
+// resolve returns the Version used to read the location when the library
+// is in the provided version: the same one if it exists, the closest
+// previous one or the last one. It returns -1 if there are no Versions.
+func (m *locationMetadata) resolve(v int) int {
+	if _, ok := m.Versions[v]; ok {
+		return v
+	}
+
+	if closest := m.closest(v); closest >= 0 {
+		return closest
+	}
+
+	return m.last()
+}
+
 var errLocVersionNotExists = errors.NewKind("location version not exists")
 
 // version returns information for a given version. If the version does not
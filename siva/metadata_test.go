@@ -185,6 +185,140 @@ version: `
 	}
 }
 
+func TestMetadataReadVersion(t *testing.T) {
+	require := require.New(t)
+
+	const rootedVersions = `
+---
+versions:
+  "0":
+    offset: 3180
+  "1":
+    offset: 6557
+  "5":
+    offset: 10296
+  "6":
+    offset: 17421
+`
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	path := "cf2e799463e1a00dbd1addd2003b0c7db31dbfe2" + locMetadataFileExt
+	err := util.WriteFile(fs, path, []byte(rootedVersions), 0666)
+	require.NoError(err)
+
+	lib, err := NewLibrary("test", fs, &LibraryOptions{})
+	require.NoError(err)
+	require.NoError(lib.SetVersion(6))
+
+	version := 1
+	pinned, err := NewLibrary("test", fs, &LibraryOptions{
+		ReadVersion: &version,
+	})
+	require.NoError(err)
+
+	v, err := pinned.Version()
+	require.NoError(err)
+	require.Equal(1, v)
+
+	repositories := func(lib *Library) []string {
+		it, err := lib.Repositories(borges.ReadOnlyMode)
+		require.NoError(err)
+
+		var repositories []string
+		err = it.ForEach(func(r borges.Repository) error {
+			repositories = append(repositories, r.ID().String())
+			return r.Close()
+		})
+		require.NoError(err)
+
+		return repositories
+	}
+
+	require.ElementsMatch([]string{
+		"gitserver.com/a",
+		"gitserver.com/b",
+	}, repositories(pinned))
+
+	require.ElementsMatch([]string{
+		"gitserver.com/a",
+		"gitserver.com/b",
+		"gitserver.com/c",
+		"gitserver.com/d",
+	}, repositories(lib))
+
+	// the pinned library does not follow version changes
+	require.NoError(lib.SetVersion(0))
+	require.ElementsMatch([]string{
+		"gitserver.com/a",
+		"gitserver.com/b",
+	}, repositories(pinned))
+}
+
+func TestMetadataGetAtVersion(t *testing.T) {
+	require := require.New(t)
+
+	const rootedVersions = `
+---
+versions:
+  "0":
+    offset: 3180
+  "1":
+    offset: 6557
+  "5":
+    offset: 10296
+  "6":
+    offset: 17421
+`
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	path := "cf2e799463e1a00dbd1addd2003b0c7db31dbfe2" + locMetadataFileExt
+	err := util.WriteFile(fs, path, []byte(rootedVersions), 0666)
+	require.NoError(err)
+
+	lib, err := NewLibrary("test", fs, &LibraryOptions{RootedRepo: true})
+	require.NoError(err)
+	require.NoError(lib.SetVersion(0))
+
+	l, err := lib.Location("cf2e799463e1a00dbd1addd2003b0c7db31dbfe2")
+	require.NoError(err)
+	loc := l.(*Location)
+
+	// both versions can be opened at the same time
+	r1, err := loc.GetAtVersion("", 1)
+	require.NoError(err)
+	defer r1.Close()
+	r6, err := loc.GetAtVersion("", 6)
+	require.NoError(err)
+	defer r6.Close()
+
+	remotes, err := r1.R().Remotes()
+	require.NoError(err)
+	require.Len(remotes, 2)
+
+	remotes, err = r6.R().Remotes()
+	require.NoError(err)
+	require.Len(remotes, 4)
+
+	_, err = loc.GetAtVersion("gitserver.com/c", 1)
+	require.True(borges.ErrRepositoryNotExists.Is(err))
+
+	r, err := loc.GetAtVersion("gitserver.com/c", 5)
+	require.NoError(err)
+	require.Equal(borges.ReadOnlyMode, r.Mode())
+	_, err = r.R().Reference("refs/heads/master", false)
+	require.NoError(err)
+	require.NoError(r.Close())
+
+	// the library version is not modified
+	v, err := lib.Version()
+	require.NoError(err)
+	require.Equal(0, v)
+
+	has, err := loc.Has("gitserver.com/c")
+	require.NoError(err)
+	require.False(has)
+}
+
 func TestMetadataLibraryWrite(t *testing.T) {
 	require := require.New(t)
 	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
@@ -199,6 +333,11 @@ func TestMetadataLibraryWrite(t *testing.T) {
 	require.NoError(err)
 	require.Equal(-1, version)
 
+	// neither its locations
+	loc, err := lib.Location("cf2e799463e1a00dbd1addd2003b0c7db31dbfe2")
+	require.NoError(err)
+	require.Equal(-1, loc.(*Location).LastVersion())
+
 	// library creating metadata, since theres is no previous metadata
 	// a new metadata file will be created with id "test"
 	lib, err = NewLibrary("test", fs, &LibraryOptions{})
@@ -0,0 +1,229 @@
+package siva
+
+import (
+	borges "github.com/src-d/go-borges"
+
+	errors "gopkg.in/src-d/go-errors.v1"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// ErrMoveRollback is returned by Library.Move when committing the source
+// location fails and the moved repository can not be removed from the target
+// one. The repository is left in both locations.
+var ErrMoveRollback = errors.NewKind(
+	"cannot remove repository %s from location %s after failed move: %s")
+
+// Move moves the repository with the given ID from one location to another.
+// The objects reachable from its references are copied to the target
+// location, that is created if it does not exist, along with its remote
+// configuration and references. These are then deleted from the source
+// location. Objects shared with other repositories are kept in the source,
+// compaction with prune is needed to free the rest.
+//
+// Both locations are locked while moving so other writers can't see the
+// repository in both or none of them. The target location is committed
+// first so the repository is never lost, readers can find it in both
+// locations until the source is also committed. If committing the source
+// fails the repository is removed again from the target, when this is not
+// possible ErrMoveRollback is returned and it's left in both. Only
+// transactional libraries are supported as non transactional writes can't
+// be undone, borges.ErrNonTransactional is returned otherwise.
+func (l *Library) Move(id borges.RepositoryID, from, to borges.LocationID) error {
+	if !l.options.Transactional {
+		return borges.ErrNonTransactional.New()
+	}
+
+	id = borges.NormalizeRepositoryID(id.String())
+	if from == to {
+		return nil
+	}
+
+	src, err := l.location(from, false)
+	if err != nil {
+		return err
+	}
+
+	l.locMu.Lock()
+	dst, err := l.location(to, true)
+	l.locMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// locations are always locked in the same order so two moves between
+	// the same locations don't deadlock
+	locs := []*Location{src, dst}
+	if to < from {
+		locs = []*Location{dst, src}
+	}
+
+	repos := make(map[*Location]borges.Repository, len(locs))
+	closeAll := func() {
+		for _, r := range repos {
+			// TODO: log the rollback error
+			_ = r.Close()
+		}
+	}
+
+	for _, loc := range locs {
+		r, err := loc.repository("", borges.RWMode)
+		if err != nil {
+			closeAll()
+			return err
+		}
+
+		repos[loc] = r
+	}
+
+	srcR, dstR := repos[src], repos[dst]
+	if err := moveRemote(srcR.R(), dstR.R(), id); err != nil {
+		closeAll()
+		return err
+	}
+
+	if err := dstR.Commit(); err != nil {
+		_ = srcR.Close()
+		return err
+	}
+
+	if err := srcR.Commit(); err != nil {
+		if rerr := dst.Remove(id); rerr != nil {
+			return ErrMoveRollback.Wrap(err, id, to, rerr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// moveRemote copies the remote with the given ID, its references and
+// reachable objects to the dst repository and deletes the remote and its
+// references from src.
+func moveRemote(src, dst *git.Repository, id borges.RepositoryID) error {
+	srcCfg, err := src.Config()
+	if err != nil {
+		return err
+	}
+
+	remote := findRemote(srcCfg, id)
+	if remote == nil {
+		return borges.ErrRepositoryNotExists.New(id)
+	}
+
+	dstCfg, err := dst.Config()
+	if err != nil {
+		return err
+	}
+
+	if findRemote(dstCfg, id) != nil {
+		return borges.ErrRepositoryExists.New(id)
+	}
+
+	if _, ok := dstCfg.Remotes[remote.Name]; ok {
+		return borges.ErrRepositoryExists.New(remote.Name)
+	}
+
+	refs, err := remoteReferences(src.Storer, remote, id)
+	if err != nil {
+		return err
+	}
+
+	if err := copyObjects(src.Storer, dst.Storer, refs); err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if err := dst.Storer.SetReference(ref); err != nil {
+			return err
+		}
+	}
+
+	dstCfg.Remotes[remote.Name] = remote
+	if err := dst.Storer.SetConfig(dstCfg); err != nil {
+		return err
+	}
+
+	return removeRemote(src, id)
+}
+
+// copyObjects writes to dst a packfile with the objects reachable from the
+// given references that are not already in dst. Objects are written one by
+// one when dst does not support packfiles.
+func copyObjects(
+	src, dst storer.EncodedObjectStorer,
+	refs []*plumbing.Reference,
+) error {
+	var hashes []plumbing.Hash
+	for _, ref := range refs {
+		if ref.Type() == plumbing.HashReference {
+			hashes = append(hashes, ref.Hash())
+		}
+	}
+
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	objs, err := revlist.Objects(src, hashes, nil)
+	if err != nil {
+		return err
+	}
+
+	var missing []plumbing.Hash
+	for _, h := range objs {
+		err := dst.HasEncodedObject(h)
+		if err == plumbing.ErrObjectNotFound {
+			missing = append(missing, h)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	pw, ok := dst.(storer.PackfileWriter)
+	if !ok {
+		return copyEncodedObjects(src, dst, missing)
+	}
+
+	w, err := pw.PackfileWriter()
+	if err != nil {
+		return err
+	}
+
+	_, err = packfile.NewEncoder(w, src, false).Encode(missing, packWindow)
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+func copyEncodedObjects(
+	src, dst storer.EncodedObjectStorer,
+	hashes []plumbing.Hash,
+) error {
+	for _, h := range hashes {
+		obj, err := src.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return err
+		}
+
+		if _, err := dst.SetEncodedObject(obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
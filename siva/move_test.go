@@ -0,0 +1,242 @@
+package siva
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func TestMove(t *testing.T) {
+	const (
+		from = borges.LocationID("cf2e799463e1a00dbd1addd2003b0c7db31dbfe2")
+		to   = borges.LocationID("new")
+		repo = borges.RepositoryID("gitserver.com/c")
+	)
+
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	lib, err := NewLibrary("test", fs, &LibraryOptions{
+		Transactional: true,
+		RootedRepo:    true,
+		Index:         true,
+	})
+	require.NoError(err)
+
+	r, err := lib.Get(repo, borges.ReadOnlyMode)
+	require.NoError(err)
+	refs := repoReferences(t, r)
+	require.NotEmpty(refs)
+	require.NoError(r.Close())
+
+	err = lib.Move(repo, from, to)
+	require.NoError(err)
+
+	loc, err := lib.Location(from)
+	require.NoError(err)
+	has, err := loc.Has(repo)
+	require.NoError(err)
+	require.False(has)
+
+	has, err = loc.Has("gitserver.com/d")
+	require.NoError(err)
+	require.True(has)
+
+	loc, err = lib.Location(to)
+	require.NoError(err)
+	r, err = loc.Get(repo, borges.ReadOnlyMode)
+	require.NoError(err)
+	require.ElementsMatch(refs, repoReferences(t, r))
+
+	// all the objects of the repository are in the new location
+	for _, ref := range refs {
+		if ref.Type() != plumbing.HashReference {
+			continue
+		}
+
+		c, err := r.R().CommitObject(ref.Hash())
+		require.NoError(err)
+		iter := object.NewCommitPreorderIter(c, nil, nil)
+		err = iter.ForEach(func(c *object.Commit) error {
+			tree, err := c.Tree()
+			if err != nil {
+				return err
+			}
+
+			return tree.Files().ForEach(func(*object.File) error {
+				return nil
+			})
+		})
+		require.NoError(err)
+	}
+	require.NoError(r.Close())
+
+	r, err = lib.Get(repo, borges.ReadOnlyMode)
+	require.NoError(err)
+	require.Equal(to, r.Location().ID())
+	require.NoError(r.Close())
+
+	err = lib.Move(repo, from, to)
+	require.True(borges.ErrRepositoryNotExists.Is(err))
+}
+
+func TestMove_Exists(t *testing.T) {
+	const (
+		from = borges.LocationID("cf2e799463e1a00dbd1addd2003b0c7db31dbfe2")
+		to   = borges.LocationID("copy")
+	)
+
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	data, err := ioutil.ReadFile("../_testdata/rooted/" + string(from) + ".siva")
+	require.NoError(err)
+	require.NoError(util.WriteFile(fs, string(to)+".siva", data, 0666))
+
+	lib, err := NewLibrary("test", fs, &LibraryOptions{
+		Transactional: true,
+		RootedRepo:    true,
+	})
+	require.NoError(err)
+
+	err = lib.Move("gitserver.com/a", from, to)
+	require.True(borges.ErrRepositoryExists.Is(err))
+
+	// nothing is modified
+	for _, id := range []borges.LocationID{from, to} {
+		loc, err := lib.Location(id)
+		require.NoError(err)
+		has, err := loc.Has("gitserver.com/a")
+		require.NoError(err)
+		require.True(has)
+	}
+
+	stat, err := fs.Stat(string(to) + ".siva")
+	require.NoError(err)
+	require.Equal(int64(len(data)), stat.Size())
+
+	err = lib.Move("gitserver.com/a", "missing", to)
+	require.True(borges.ErrLocationNotExists.Is(err))
+}
+
+func TestMove_CommitError(t *testing.T) {
+	const (
+		from = borges.LocationID("cf2e799463e1a00dbd1addd2003b0c7db31dbfe2")
+		to   = borges.LocationID("new")
+		repo = borges.RepositoryID("gitserver.com/c")
+	)
+
+	tests := []struct {
+		name string
+		// appends is the number of writes to the target siva file that
+		// succeed, the first one is the move commit
+		appends int
+		// both is true when the repository is left in both locations
+		both bool
+	}{
+		{name: "rollback", appends: 2},
+		{name: "rollback error", appends: 1, both: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+			appends := test.appends
+			fs = &appendErrorFS{
+				Filesystem: fs,
+				fail: func(name string) bool {
+					if name == string(from)+".siva" {
+						return true
+					}
+
+					appends--
+					return appends < 0
+				},
+			}
+
+			lib, err := NewLibrary("test", fs, &LibraryOptions{
+				Transactional: true,
+				RootedRepo:    true,
+			})
+			require.NoError(err)
+
+			err = lib.Move(repo, from, to)
+			if test.both {
+				require.True(ErrMoveRollback.Is(err))
+			} else {
+				require.True(errFake.Is(err))
+			}
+
+			loc, err := lib.Location(from)
+			require.NoError(err)
+			has, err := loc.Has(repo)
+			require.NoError(err)
+			require.True(has)
+
+			loc, err = lib.Location(to)
+			require.NoError(err)
+			has, err = loc.Has(repo)
+			require.NoError(err)
+			require.Equal(test.both, has)
+		})
+	}
+}
+
+// appendErrorFS fails to open for appending the files chosen by fail.
+type appendErrorFS struct {
+	billy.Filesystem
+	fail func(name string) bool
+}
+
+func (fs *appendErrorFS) OpenFile(
+	name string,
+	flag int,
+	perm os.FileMode,
+) (billy.File, error) {
+	if flag&os.O_APPEND != 0 && fs.fail(name) {
+		return nil, errFake.New()
+	}
+
+	return fs.Filesystem.OpenFile(name, flag, perm)
+}
+
+func TestMove_NonTransactional(t *testing.T) {
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	lib, err := NewLibrary("test", fs, &LibraryOptions{RootedRepo: true})
+	require.NoError(err)
+
+	err = lib.Move("gitserver.com/a",
+		"cf2e799463e1a00dbd1addd2003b0c7db31dbfe2", "new")
+	require.True(borges.ErrNonTransactional.Is(err))
+
+	_, err = fs.Stat("new.siva")
+	require.Error(err)
+}
+
+func repoReferences(t *testing.T, r borges.Repository) []*plumbing.Reference {
+	t.Helper()
+
+	iter, err := r.R().References()
+	require.NoError(t, err)
+
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, ref)
+		return nil
+	})
+	require.NoError(t, err)
+
+	return refs
+}
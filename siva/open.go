@@ -0,0 +1,106 @@
+package siva
+
+import (
+	"fmt"
+	"net/url"
+
+	borges "github.com/src-d/go-borges"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+)
+
+func init() {
+	borges.Register("siva", open)
+}
+
+// open is the borges.Opener of the "siva" scheme described in the package
+// documentation.
+func open(u *url.URL) (borges.Library, error) {
+	path, err := borges.URLPath(u)
+	if err != nil {
+		return nil, err
+	}
+
+	o := borges.NewURLOptions(u)
+	id := o.String("id", "")
+	opts := &LibraryOptions{
+		RootedRepo:         o.Bool("rooted", false),
+		Transactional:      o.Bool("transactional", false),
+		Timeout:            o.Duration("timeout", 0),
+		TransactionTimeout: o.Duration("transaction_timeout", 0),
+		StaleLockTimeout:   o.Duration("stale_lock_timeout", 0),
+		RegistryCache:      o.Int("registry_cache", 0),
+		Performance:        o.Bool("performance", false),
+		MetadataReadOnly:   o.Bool("metadata_readonly", false),
+		Index:              o.Bool("index", false),
+	}
+
+	if tmp := o.String("tmp", ""); tmp != "" {
+		opts.TempFS = osfs.New(tmp)
+	}
+
+	if err := urlLayout(o, opts); err != nil {
+		return nil, err
+	}
+
+	if err := urlSelector(o, opts); err != nil {
+		return nil, err
+	}
+
+	if err := o.Err(); err != nil {
+		return nil, err
+	}
+
+	lib, err := NewLibrary(id, osfs.New(path), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return lib, nil
+}
+
+// urlLayout sets the path layout of the options from the layout option of
+// the URL and the options of the chosen layout.
+func urlLayout(o *borges.URLOptions, opts *LibraryOptions) error {
+	switch layout := o.String("layout", "bucket"); layout {
+	case "bucket":
+		opts.Bucket = o.Int("bucket", 0)
+	case "shard":
+		opts.PathLayout = ShardLayout{
+			Levels: o.Int("levels", 2),
+			Width:  o.Int("width", 2),
+		}
+	default:
+		return urlOptionError("layout", layout, "unknown layout")
+	}
+
+	return nil
+}
+
+// urlSelector sets the location selector of the options from the selector
+// option of the URL and the options of the chosen selector. Selectors
+// needing code, like the root commit one, can not be set from a URL.
+func urlSelector(o *borges.URLOptions, opts *LibraryOptions) error {
+	switch selector := o.String("selector", ""); selector {
+	case "":
+	case "hash":
+		opts.LocationSelector = NewHashSelector(o.Int("locations", 0))
+	case "size":
+		maxSize := o.Int("max_size", 0)
+		if maxSize < 0 {
+			return urlOptionError("max_size", fmt.Sprint(maxSize),
+				"negative size")
+		}
+
+		opts.LocationSelector = NewSizeSelector(uint64(maxSize))
+	default:
+		return urlOptionError("selector", selector, "unknown selector")
+	}
+
+	return nil
+}
+
+func urlOptionError(name, value, msg string) error {
+	return borges.ErrInvalidURL.New(
+		fmt.Sprintf("option %s=%q: %s", name, value, msg))
+}
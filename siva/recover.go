@@ -0,0 +1,132 @@
+package siva
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+
+	errors "gopkg.in/src-d/go-errors.v1"
+)
+
+// ErrRecover is returned by Library.Recover when some of the locations
+// could not be recovered. Their errors are in the returned recoveries.
+var ErrRecover = errors.NewKind("cannot recover %d locations")
+
+// Recovery describes a siva file repaired by Library.Recover.
+type Recovery struct {
+	// Location is the ID of the repaired location.
+	Location borges.LocationID
+	// Size is the size of the siva file before the recovery. It's 0 when
+	// the checkpoint file was found but not its siva file.
+	Size int64
+	// Offset is the last known good size the siva file was truncated to.
+	// When it's 0 the siva file was deleted as it was created by the
+	// unfinished transaction.
+	Offset int64
+	// Err is the error found recovering the location. When it's set the
+	// rest of the fields, but Location, are not.
+	Err error
+}
+
+// Recover scans the library for checkpoint files left by transactions that
+// did not finish, for example because the process crashed, and truncates
+// their siva files to the last known good state. It returns the locations
+// that were repaired.
+//
+// Each location is repaired inside a transaction so it waits for the ones
+// in progress, in this or other processes, to finish. The locations that
+// can not be repaired, for example with an ErrTransactionTimeout error when
+// the transaction is not acquired, do not stop the recovery of the rest.
+// They are returned with the Err field set along with an ErrRecover error.
+func (l *Library) Recover(ctx context.Context) ([]*Recovery, error) {
+	checkpoints, err := l.glob(checkpointExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	var recovered []*Recovery
+	var failed int
+	for _, cp := range checkpoints {
+		select {
+		case <-ctx.Done():
+			return recovered, ctx.Err()
+		default:
+		}
+
+		r, err := l.recover(cp.id, cp.path)
+		if err != nil {
+			r = &Recovery{Location: cp.id, Err: err}
+			failed++
+		}
+
+		if r != nil {
+			recovered = append(recovered, r)
+		}
+	}
+
+	if failed > 0 {
+		return recovered, ErrRecover.New(failed)
+	}
+
+	return recovered, nil
+}
+
+func (l *Library) recover(id borges.LocationID, cp string) (*Recovery, error) {
+	path := strings.TrimSuffix(cp, checkpointExtension)
+	r, err := l.recoverMissing(id, path)
+	if err != nil || r != nil {
+		return r, err
+	}
+
+	loc, err := l.location(id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loc.txer.Start(); err != nil {
+		return nil, err
+	}
+	defer loc.txer.Stop()
+
+	return loc.recoverCheckpoint()
+}
+
+// recoverMissing deletes the checkpoint of a siva file that does not exist.
+// The location lock is held while checking it, as the transaction that
+// created the checkpoint could be about to create the siva file. It returns
+// nil if the siva file exists.
+func (l *Library) recoverMissing(
+	id borges.LocationID,
+	path string,
+) (*Recovery, error) {
+	if _, err := l.fs.Stat(path); !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	lock := newFileLock(l.fs, path, l.options.StaleLockTimeout)
+	ok, err := lock.Lock(time.After(l.options.TransactionTimeout))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTransactionTimeout.New(id)
+	}
+	defer lock.Unlock()
+
+	_, err = l.fs.Stat(path)
+	if err == nil {
+		return nil, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := cleanup(l.fs, path+checkpointExtension); err != nil {
+		return nil, err
+	}
+
+	return &Recovery{Location: id}, nil
+}
@@ -0,0 +1,154 @@
+package siva
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecover(t *testing.T) {
+	for _, bucket := range []int{0, 2} {
+		t.Run(fmt.Sprintf("bucket-%v", bucket), func(t *testing.T) {
+			testRecover(t, bucket)
+		})
+	}
+}
+
+func testRecover(t *testing.T, bucket int) {
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/siva", true, bucket)
+	lib, err := NewLibrary("test", fs, &LibraryOptions{
+		Transactional: true,
+		Bucket:        bucket,
+	})
+	require.NoError(err)
+
+	recovered, err := lib.Recover(context.Background())
+	require.NoError(err)
+	require.Empty(recovered)
+
+	bar := buildSivaPath("foo-bar", bucket)
+	stat, err := fs.Stat(bar)
+	require.NoError(err)
+	size := stat.Size()
+
+	// foo-bar has data from an unfinished transaction
+	err = writeInt64(fs, bar+checkpointExtension, size)
+	require.NoError(err)
+	f, err := fs.OpenFile(bar, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(err)
+	_, err = fmt.Fprint(f, "partial write")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	// a new location created by an unfinished transaction
+	newLoc := buildSivaPath("new", bucket)
+	err = writeInt64(fs, newLoc+checkpointExtension, 0)
+	require.NoError(err)
+	f, err = fs.Create(newLoc)
+	require.NoError(err)
+	_, err = fmt.Fprint(f, "partial write")
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	// checkpoint without siva file
+	missing := buildSivaPath("missing", bucket)
+	err = writeInt64(fs, missing+checkpointExtension, 42)
+	require.NoError(err)
+
+	recovered, err = lib.Recover(context.Background())
+	require.NoError(err)
+	require.ElementsMatch([]*Recovery{
+		{
+			Location: "foo-bar",
+			Size:     size + int64(len("partial write")),
+			Offset:   size,
+		},
+		{
+			Location: "new",
+			Size:     int64(len("partial write")),
+			Offset:   0,
+		},
+		{
+			Location: "missing",
+		},
+	}, recovered)
+
+	stat, err = fs.Stat(bar)
+	require.NoError(err)
+	require.Equal(size, stat.Size())
+
+	for _, path := range []string{bar, newLoc, missing} {
+		_, err = fs.Stat(path + checkpointExtension)
+		require.True(os.IsNotExist(err), path)
+	}
+
+	_, err = fs.Stat(newLoc)
+	require.True(os.IsNotExist(err))
+
+	r, err := lib.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	createTagOnHead(t, r, "recovered")
+	require.NoError(r.Commit())
+
+	recovered, err = lib.Recover(context.Background())
+	require.NoError(err)
+	require.Empty(recovered)
+}
+
+func TestRecover_TransactionInProgress(t *testing.T) {
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/siva", true, 0)
+	lib, err := NewLibrary("test", fs, &LibraryOptions{
+		Transactional:      true,
+		TransactionTimeout: 100 * time.Millisecond,
+	})
+	require.NoError(err)
+
+	// other process saved the checkpoint of a new location but did not
+	// create its siva file yet
+	path := buildSivaPath("new", 0)
+	lock := newFileLock(fs, path, time.Minute)
+	ok, err := lock.Lock(time.After(time.Second))
+	require.NoError(err)
+	require.True(ok)
+
+	err = writeInt64(fs, path+checkpointExtension, 0)
+	require.NoError(err)
+
+	// a checkpoint without siva file not locked by anyone
+	err = writeInt64(fs, buildSivaPath("other", 0)+checkpointExtension, 0)
+	require.NoError(err)
+
+	recovered, err := lib.Recover(context.Background())
+	require.True(ErrRecover.Is(err))
+	require.Len(recovered, 2)
+
+	for _, r := range recovered {
+		switch r.Location {
+		case "new":
+			require.True(ErrTransactionTimeout.Is(r.Err))
+		case "other":
+			require.Equal(&Recovery{Location: "other"}, r)
+		default:
+			require.Fail("unexpected location", r.Location)
+		}
+	}
+
+	_, err = fs.Stat(path + checkpointExtension)
+	require.NoError(err)
+
+	require.NoError(lock.Unlock())
+
+	recovered, err = lib.Recover(context.Background())
+	require.NoError(err)
+	require.Equal([]*Recovery{{Location: "new"}}, recovered)
+}
@@ -0,0 +1,120 @@
+package siva
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Relayout moves the siva and metadata files of all the locations to the
+// directories of a new bucket level and returns a new Library with the same
+// options that uses it. The options of this library are not changed so it
+// does not find the moved locations afterwards. The files are searched in
+// Bucket and ReadBuckets levels so an interrupted relayout can be resumed
+// opening the library with the new level in ReadBuckets.
+//
+// Each location is moved inside a transaction, after discarding the changes
+// of unfinished ones, holding the locks of both its old and new paths.
+// Other libraries using the same files, in this or other processes, will
+// not find the moved locations unless they also read the new bucket level.
+// The lock guard files of the old paths are kept, as other processes may be
+// waiting for them, so the old bucket directories are not removed.
+func (l *Library) Relayout(newBucket int) (*Library, error) {
+	if err := l.relayout(BucketLayout(newBucket)); err != nil {
+		return nil, err
+	}
+
+	opts := *l.options
+	opts.Bucket = newBucket
+	opts.PathLayout = nil
+	opts.TempFS = l.tmp
+
+	return NewLibrary(string(l.id), l.fs, &opts)
+}
+
+func (l *Library) relayout(layout PathLayout) error {
+	locs, err := l.locations(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, loc := range locs {
+		loc := loc.(*Location)
+		moved, err := loc.relayout(layout)
+		if err != nil {
+			return err
+		}
+
+		if moved {
+			l.locReg.Remove(loc.id)
+		}
+	}
+
+	return nil
+}
+
+// relayout moves the siva file of the location and its metadata to the
+// path of the given layout. It returns false if the files are already there.
+func (l *Location) relayout(layout PathLayout) (bool, error) {
+	path := layout.Path(l.id)
+	if path == l.path {
+		return false, nil
+	}
+
+	if err := l.txer.Start(); err != nil {
+		return false, err
+	}
+	defer l.txer.Stop()
+
+	// the new path is locked too so other processes already using the new
+	// layout don't create the location while it's moved
+	lock := newFileLock(
+		l.lib.fs, path, l.lib.options.StaleLockTimeout)
+	ok, err := lock.Lock(time.After(l.lib.options.TransactionTimeout))
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, ErrTransactionTimeout.New(l.id)
+	}
+	defer lock.Unlock()
+
+	if _, err := l.recoverCheckpoint(); err != nil {
+		return false, err
+	}
+
+	if _, err := l.lib.fs.Stat(path); err == nil {
+		return false, ErrLocationExists.New(l.id)
+	}
+
+	if err := l.lib.fs.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return false, err
+	}
+
+	// metadata is moved first so a relayout interrupted before moving the
+	// siva file moves it when resumed
+	oldMeta := metadataPath(l.path)
+	meta := metadataPath(path)
+	if _, err := l.lib.fs.Stat(oldMeta); err == nil {
+		if _, err := l.lib.fs.Stat(meta); err == nil {
+			// already moved, the old one was created again when opening
+			// the location
+			err = l.lib.fs.Remove(oldMeta)
+		} else {
+			err = l.lib.fs.Rename(oldMeta, meta)
+		}
+
+		if err != nil {
+			return false, err
+		}
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if err := l.lib.fs.Rename(l.path, path); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
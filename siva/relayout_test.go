@@ -0,0 +1,176 @@
+package siva
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	billy "gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestRelayout(t *testing.T) {
+	tests := []struct {
+		from, to int
+	}{
+		{0, 2},
+		{2, 0},
+		{1, 3},
+	}
+
+	for _, test := range tests {
+		name := fmt.Sprintf("%d-%d", test.from, test.to)
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+
+			fs := setupRelayoutFS(t, test.from, test.from)
+			lib, err := NewLibrary("test", fs, &LibraryOptions{
+				Bucket:        test.from,
+				Transactional: true,
+			})
+			require.NoError(err)
+
+			r, err := lib.Get("github.com/foo/bar", borges.RWMode)
+			require.NoError(err)
+			createTagOnHead(t, r, "relayout")
+			r.(*Repository).VersionOnCommit(1)
+			require.NoError(r.Commit())
+
+			old := lib
+			lib, err = lib.Relayout(test.to)
+			require.NoError(err)
+
+			// the options of the relayouted library are not modified
+			require.Equal(test.from, old.options.Bucket)
+			require.Equal(test.to, lib.options.Bucket)
+
+			for _, id := range []borges.LocationID{"foo-bar", "foo-qux"} {
+				_, err = fs.Stat(buildSivaPath(id, test.from))
+				require.Error(err)
+				_, err = fs.Stat(buildSivaPath(id, test.to))
+				require.NoError(err)
+			}
+
+			_, err = fs.Stat(metadataPath(buildSivaPath("foo-bar", test.to)))
+			require.NoError(err)
+
+			// only the lock guard files are left in the old paths
+			if test.from > 0 {
+				dir := filepath.Dir(buildSivaPath("foo-bar", test.from))
+				files, err := fs.ReadDir(dir)
+				require.NoError(err)
+				for _, f := range files {
+					require.True(strings.HasSuffix(f.Name(), guardExtension),
+						"unexpected file %s", f.Name())
+				}
+			}
+
+			requireRelayoutRepositories(t, lib)
+
+			// a new library with the new bucket level finds the locations
+			lib, err = NewLibrary("test", fs, &LibraryOptions{
+				Bucket:        test.to,
+				Transactional: true,
+			})
+			require.NoError(err)
+			requireRelayoutRepositories(t, lib)
+
+			l, err := lib.Location("foo-bar")
+			require.NoError(err)
+			_, err = l.(*Location).Version(1)
+			require.NoError(err)
+		})
+	}
+}
+
+func TestRelayout_ReadBuckets(t *testing.T) {
+	require := require.New(t)
+
+	// foo-bar is already in the new layout
+	fs := setupRelayoutFS(t, 0, 2)
+
+	lib, err := NewLibrary("test", fs, &LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+	})
+	require.NoError(err)
+
+	has, _, _, err := lib.Has("github.com/foo/qux")
+	require.NoError(err)
+	require.False(has)
+
+	lib, err = NewLibrary("test", fs, &LibraryOptions{
+		Bucket:        2,
+		ReadBuckets:   []int{0},
+		Transactional: true,
+	})
+	require.NoError(err)
+	requireRelayoutRepositories(t, lib)
+
+	// new locations are created with the library bucket
+	_, err = lib.AddLocation("new")
+	require.NoError(err)
+	r, err := lib.Get("github.com/foo/qux", borges.RWMode)
+	require.NoError(err)
+	require.NoError(r.Close())
+
+	_, err = lib.Relayout(2)
+	require.NoError(err)
+	_, err = fs.Stat("foo-qux.siva")
+	require.Error(err)
+	_, err = fs.Stat("fo/foo-qux.siva")
+	require.NoError(err)
+
+	lib, err = NewLibrary("test", fs, &LibraryOptions{
+		Bucket:        2,
+		Transactional: true,
+	})
+	require.NoError(err)
+	requireRelayoutRepositories(t, lib)
+}
+
+// setupRelayoutFS copies foo-bar.siva with bucket level bar and
+// foo-qux.siva with bucket level qux to a new filesystem.
+func setupRelayoutFS(t *testing.T, qux, bar int) billy.Filesystem {
+	t.Helper()
+	require := require.New(t)
+
+	fs := memfs.New()
+	for id, bucket := range map[borges.LocationID]int{
+		"foo-bar": bar,
+		"foo-qux": qux,
+	} {
+		data, err := ioutil.ReadFile(
+			filepath.Join("../_testdata/siva", string(id)+".siva"))
+		require.NoError(err)
+
+		err = util.WriteFile(fs, buildSivaPath(id, bucket), data, 0666)
+		require.NoError(err)
+	}
+
+	return fs
+}
+
+func requireRelayoutRepositories(t *testing.T, lib *Library) {
+	t.Helper()
+	require := require.New(t)
+
+	for id, loc := range map[borges.RepositoryID]borges.LocationID{
+		"github.com/foo/bar": "foo-bar",
+		"github.com/foo/qux": "foo-qux",
+	} {
+		r, err := lib.Get(id, borges.ReadOnlyMode)
+		require.NoError(err)
+		require.Equal(loc, r.Location().ID())
+
+		_, err = r.R().Head()
+		require.NoError(err)
+		require.NoError(r.Close())
+	}
+}
@@ -7,13 +7,12 @@ import (
 	borges "github.com/src-d/go-borges"
 
 	billy "gopkg.in/src-d/go-billy.v4"
-	errors "gopkg.in/src-d/go-errors.v1"
 	git "gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/storage"
 )
 
 // ErrRepoAlreadyClosed is returned when a repository opened in RW mode was already closed.
-var ErrRepoAlreadyClosed = errors.NewKind("repository %s already closed")
+var ErrRepoAlreadyClosed = borges.ErrRepositoryClosed
 
 // Repository is an implementation for siva files of borges.Repository
 // interface.
@@ -136,6 +135,11 @@ func (r *Repository) Close() error {
 		}
 	}
 
+	if !r.transactional && r.mode == borges.RWMode {
+		// non transactional writes are already persisted
+		return r.location.updateIndex()
+	}
+
 	return r.location.Rollback(r.mode)
 }
 
@@ -0,0 +1,115 @@
+package siva
+
+import (
+	"context"
+	"sort"
+)
+
+// RetentionPolicy selects the location versions kept by PruneVersions.
+// A version is kept only if it satisfies all the configured rules, it's
+// deleted when it fails any of them. The version currently read by the
+// library is always kept.
+type RetentionPolicy struct {
+	// KeepLast is the number of most recent versions kept. 0 means no
+	// limit.
+	KeepLast int
+	// MinVersion deletes the versions with a lower number. 0 means no
+	// limit.
+	MinVersion int
+	// Prune also deletes the objects that are not reachable from the
+	// references of any of the kept versions when compacting.
+	Prune bool
+}
+
+// expired returns the versions that must be deleted from the given ones.
+// The versions in keep are never deleted.
+func (p *RetentionPolicy) expired(versions []int, keep int) []int {
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	var expired []int
+	for i, v := range versions {
+		if v == keep {
+			continue
+		}
+
+		if (p.KeepLast > 0 && i >= p.KeepLast) ||
+			(p.MinVersion > 0 && v < p.MinVersion) {
+			expired = append(expired, v)
+		}
+	}
+
+	return expired
+}
+
+// PruneVersions deletes the versions of every location that are not kept
+// by the retention policy and compacts the locations so the data only
+// used by these versions is freed. The remaining versions can still be read
+// at their new offsets.
+func (l *Library) PruneVersions(
+	ctx context.Context,
+	policy *RetentionPolicy,
+) error {
+	locs, err := l.locations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, loc := range locs {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if err := loc.(*Location).PruneVersions(policy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PruneVersions deletes the versions of the location that are not kept by
+// the retention policy and compacts the siva file. It does nothing when no
+// version is deleted.
+func (l *Location) PruneVersions(policy *RetentionPolicy) error {
+	if l.metadata == nil || policy == nil {
+		return nil
+	}
+
+	if err := l.txer.Start(); err != nil {
+		return err
+	}
+	defer l.txer.Stop()
+
+	current, err := l.lib.Version()
+	if err != nil {
+		return err
+	}
+
+	// reload the versions in case they were modified by other process
+	if _, err := l.metadata.version(current); err != nil &&
+		!errLocVersionNotExists.Is(err) {
+		return err
+	}
+
+	var versions []int
+	for v := range l.metadata.Versions {
+		versions = append(versions, v)
+	}
+
+	expired := policy.expired(versions, l.metadata.resolve(current))
+	if len(expired) == 0 {
+		return nil
+	}
+
+	for _, v := range expired {
+		l.metadata.deleteVersion(v)
+	}
+
+	if err := l.metadata.save(); err != nil {
+		return err
+	}
+
+	return l.compact(&CompactOptions{Prune: policy.Prune})
+}
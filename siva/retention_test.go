@@ -0,0 +1,154 @@
+package siva
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/util"
+)
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	versions := []int{0, 1, 5, 6, 10}
+	tests := []struct {
+		policy   RetentionPolicy
+		keep     int
+		expected []int
+	}{
+		{RetentionPolicy{}, 10, nil},
+		{RetentionPolicy{KeepLast: 2}, 10, []int{5, 1, 0}},
+		{RetentionPolicy{KeepLast: 2}, 1, []int{5, 0}},
+		{RetentionPolicy{MinVersion: 5}, 10, []int{1, 0}},
+		{RetentionPolicy{KeepLast: 4, MinVersion: 5}, 10, []int{1, 0}},
+		{RetentionPolicy{KeepLast: 1, MinVersion: 5}, 10, []int{6, 5, 1, 0}},
+	}
+
+	for _, test := range tests {
+		name := fmt.Sprintf("%+v-%v", test.policy, test.keep)
+		t.Run(name, func(t *testing.T) {
+			v := append([]int(nil), versions...)
+			expired := test.policy.expired(v, test.keep)
+			require.Equal(t, test.expected, expired)
+		})
+	}
+}
+
+func TestPruneVersions(t *testing.T) {
+	const (
+		locID    = "cf2e799463e1a00dbd1addd2003b0c7db31dbfe2"
+		versions = `
+---
+versions:
+  "0":
+    offset: 3180
+  "1":
+    offset: 6557
+  "5":
+    offset: 10296
+  "6":
+    offset: 17421
+`
+	)
+
+	tests := []struct {
+		name     string
+		current  int
+		policy   *RetentionPolicy
+		expected map[int][]string
+	}{
+		{
+			name:    "keep last",
+			current: 6,
+			policy:  &RetentionPolicy{KeepLast: 2},
+			expected: map[int][]string{
+				5: {"gitserver.com/a", "gitserver.com/b", "gitserver.com/c"},
+				6: {"gitserver.com/a", "gitserver.com/b", "gitserver.com/c",
+					"gitserver.com/d"},
+			},
+		},
+		{
+			name:    "min version keeps current",
+			current: 1,
+			policy:  &RetentionPolicy{MinVersion: 6, Prune: true},
+			expected: map[int][]string{
+				1: {"gitserver.com/a", "gitserver.com/b"},
+				6: {"gitserver.com/a", "gitserver.com/b", "gitserver.com/c",
+					"gitserver.com/d"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+			path := locID + locMetadataFileExt
+			err := util.WriteFile(fs, path, []byte(versions), 0666)
+			require.NoError(err)
+
+			lib, err := NewLibrary("test", fs, &LibraryOptions{
+				Transactional: true,
+			})
+			require.NoError(err)
+			require.NoError(lib.SetVersion(test.current))
+
+			stat, err := fs.Stat(locID + ".siva")
+			require.NoError(err)
+			size := stat.Size()
+
+			err = lib.PruneVersions(context.Background(), test.policy)
+			require.NoError(err)
+
+			stat, err = fs.Stat(locID + ".siva")
+			require.NoError(err)
+			require.True(stat.Size() < size)
+
+			// read the metadata from disk
+			lib, err = NewLibrary("test", fs, &LibraryOptions{
+				Transactional: true,
+			})
+			require.NoError(err)
+
+			l, err := lib.Location(locID)
+			require.NoError(err)
+			loc := l.(*Location)
+
+			var kept []int
+			for v := range loc.metadata.Versions {
+				kept = append(kept, v)
+			}
+
+			var expected []int
+			for v := range test.expected {
+				expected = append(expected, v)
+			}
+			require.ElementsMatch(expected, kept)
+
+			for v, repos := range test.expected {
+				r, err := loc.GetAtVersion("", v)
+				require.NoError(err)
+
+				remotes, err := r.R().Remotes()
+				require.NoError(err)
+
+				var names []string
+				for _, remote := range remotes {
+					names = append(names, remote.Config().Name)
+				}
+				require.ElementsMatch(repos, names, "version %v", v)
+				require.NoError(r.Close())
+			}
+
+			// the last state is not modified
+			r, err := loc.Get("", borges.RWMode)
+			require.NoError(err)
+			_, err = r.R().Remote("gitserver.com/e")
+			require.NoError(err)
+			require.NoError(r.Close())
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"io"
 
+	borges "github.com/src-d/go-borges"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
@@ -25,6 +26,8 @@ type RootedStorage struct {
 	id string
 }
 
+var _ borges.RootedStorer = (*RootedStorage)(nil)
+
 // NewRootedStorage creates a new storer that only shows references from
 // an specific remote ID.
 func NewRootedStorage(s storage.Storer, id string) *RootedStorage {
@@ -54,6 +57,11 @@ func (r *RootedStorage) Close() error {
 	return nil
 }
 
+// RootedID implements borges.RootedStorer interface.
+func (r *RootedStorage) RootedID() string {
+	return r.id
+}
+
 func (r *RootedStorage) refPrefix() string {
 	return remotesBase + r.id + "/"
 }
@@ -170,6 +178,13 @@ func (r *RootedStorage) Reference(
 	name plumbing.ReferenceName,
 ) (*plumbing.Reference, error) {
 	ref, err := r.Storer.Reference(r.convertReferenceNameToRemote(name))
+	if err == plumbing.ErrReferenceNotFound && name == plumbing.HEAD {
+		// rooted repositories only have HEAD when it's fetched, as a hash
+		// reference. The ones created with Init don't have it as packed-refs
+		// can't hold symbolic references, they get the HEAD git.Init sets.
+		return plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master), nil
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -508,3 +508,49 @@ func TestRootedEmptyTree(t *testing.T) {
 	err = repo.Close()
 	require.NoError(err)
 }
+
+func TestRootedInitHEAD(t *testing.T) {
+	require := require.New(t)
+
+	fs := memfs.New()
+	options := &LibraryOptions{
+		RootedRepo:       true,
+		Transactional:    true,
+		LocationSelector: NewHashSelector(1),
+	}
+
+	lib, err := NewLibrary("rooted", fs, options)
+	require.NoError(err)
+
+	repo, err := lib.Init("github.com/foo/bar")
+	require.NoError(err)
+	require.NoError(repo.Commit())
+
+	lib, err = NewLibrary("rooted", fs, options)
+	require.NoError(err)
+
+	for _, mode := range []borges.Mode{borges.ReadOnlyMode, borges.RWMode} {
+		repo, err = lib.Get("github.com/foo/bar", mode)
+		require.NoError(err)
+
+		head, err := repo.R().Reference(plumbing.HEAD, false)
+		require.NoError(err)
+		require.Equal(plumbing.SymbolicReference, head.Type())
+		require.Equal(plumbing.Master, head.Target())
+
+		_, err = repo.R().Head()
+		require.Equal(plumbing.ErrReferenceNotFound, err)
+		require.NoError(repo.Close())
+	}
+
+	// HEAD is not stored in the location
+	lib, err = NewLibrary("rooted", fs, &LibraryOptions{})
+	require.NoError(err)
+
+	repo, err = lib.Get("github.com/foo/bar", borges.ReadOnlyMode)
+	require.NoError(err)
+	defer repo.Close()
+
+	_, err = repo.R().Reference("refs/remotes/github.com/foo/bar/HEAD", false)
+	require.Equal(plumbing.ErrReferenceNotFound, err)
+}
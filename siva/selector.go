@@ -0,0 +1,140 @@
+package siva
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/google/uuid"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// NewHashSelector returns a LocationSelector that chooses the location
+// using the SHA1 of the repository ID. When locations is greater than 0 the
+// repositories are spread in that number of locations named with the
+// hexadecimal representation of the bucket number, otherwise each
+// repository has its own location named with the hash.
+func NewHashSelector(locations int) borges.LocationSelector {
+	return borges.LocationSelectorFunc(func(
+		_ context.Context,
+		_ borges.Library,
+		id borges.RepositoryID,
+	) (borges.LocationID, error) {
+		sum := sha1.Sum([]byte(borges.NormalizeRepositoryID(id.String())))
+		if locations <= 0 {
+			return borges.LocationID(hex.EncodeToString(sum[:])), nil
+		}
+
+		n := binary.BigEndian.Uint64(sum[:8]) % uint64(locations)
+		width := len(fmt.Sprintf("%x", locations-1))
+		return borges.LocationID(fmt.Sprintf("%0*x", width, n)), nil
+	})
+}
+
+// RootCommitFunc returns the root commit of a repository. It's used by the
+// selector returned by NewRootCommitSelector to group repositories sharing
+// history in the same location.
+type RootCommitFunc func(context.Context, borges.RepositoryID) (plumbing.Hash, error)
+
+// NewRootCommitSelector returns a LocationSelector that places repositories
+// in the location named with its root commit, the same way gitcollector
+// groups forks. As the repository is still empty when it's initialized the
+// root commit is resolved by the given function, for example from a fetch
+// done to a temporary storage.
+func NewRootCommitSelector(root RootCommitFunc) borges.LocationSelector {
+	return borges.LocationSelectorFunc(func(
+		ctx context.Context,
+		_ borges.Library,
+		id borges.RepositoryID,
+	) (borges.LocationID, error) {
+		hash, err := root(ctx, id)
+		if err != nil {
+			return "", err
+		}
+
+		if hash.IsZero() {
+			return "", borges.ErrInvalidLocationID.New(id)
+		}
+
+		return borges.LocationID(hash.String()), nil
+	})
+}
+
+// NewSizeSelector returns a LocationSelector that chooses the smallest
+// existing location. When all the locations are bigger than maxSize a new
+// location with a random ID is used. A maxSize of 0 means no limit. It can
+// only be used with siva libraries, otherwise borges.ErrNotImplemented is
+// returned.
+func NewSizeSelector(maxSize uint64) borges.LocationSelector {
+	s := &sizeSelector{maxSize: maxSize}
+	return borges.LocationSelectorFunc(s.selectLocation)
+}
+
+type sizeSelector struct {
+	maxSize uint64
+	last    borges.LocationID
+	m       sync.Mutex
+}
+
+func (s *sizeSelector) selectLocation(
+	ctx context.Context,
+	l borges.Library,
+	_ borges.RepositoryID,
+) (borges.LocationID, error) {
+	lib, ok := l.(*Library)
+	if !ok {
+		return "", borges.ErrNotImplemented.New()
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	locs, err := lib.locations(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		selected borges.LocationID
+		min      uint64
+	)
+
+	for _, l := range locs {
+		loc := l.(*Location)
+		size, err := loc.size()
+		if err != nil {
+			return "", err
+		}
+
+		if s.maxSize > 0 && size >= s.maxSize {
+			continue
+		}
+
+		if selected == "" || size < min {
+			selected = loc.ID()
+			min = size
+		}
+	}
+
+	if selected != "" {
+		return selected, nil
+	}
+
+	// a new location does not have a siva file until its first commit so
+	// it's reused until then
+	if s.last != "" {
+		path := lib.layout().Path(s.last)
+		if _, err := lib.fs.Stat(path); os.IsNotExist(err) {
+			return s.last, nil
+		}
+	}
+
+	s.last = borges.LocationID(uuid.New().String())
+	return s.last, nil
+}
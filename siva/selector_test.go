@@ -0,0 +1,186 @@
+package siva
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestHashSelector(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	s := NewHashSelector(0)
+	a, err := s.SelectLocation(ctx, nil, "github.com/src-d/go-borges")
+	require.NoError(err)
+	b, err := s.SelectLocation(ctx, nil, "https://github.com/src-d/go-borges.git")
+	require.NoError(err)
+	require.Equal(a, b)
+	require.Len(a, 40)
+
+	s = NewHashSelector(16)
+	seen := make(map[borges.LocationID]struct{})
+	for i := 0; i < 100; i++ {
+		id := borges.RepositoryID(fmt.Sprintf("github.com/src-d/%d", i))
+		loc, err := s.SelectLocation(ctx, nil, id)
+		require.NoError(err)
+		require.Len(loc, 1)
+		seen[loc] = struct{}{}
+	}
+	require.Len(seen, 16)
+}
+
+func TestRootCommitSelector(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	root := plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d")
+	s := NewRootCommitSelector(func(
+		context.Context,
+		borges.RepositoryID,
+	) (plumbing.Hash, error) {
+		return root, nil
+	})
+
+	loc, err := s.SelectLocation(ctx, nil, "github.com/src-d/go-borges")
+	require.NoError(err)
+	require.Equal(borges.LocationID(root.String()), loc)
+
+	s = NewRootCommitSelector(func(
+		context.Context,
+		borges.RepositoryID,
+	) (plumbing.Hash, error) {
+		return plumbing.ZeroHash, nil
+	})
+
+	_, err = s.SelectLocation(ctx, nil, "github.com/src-d/go-borges")
+	require.True(borges.ErrInvalidLocationID.Is(err))
+}
+
+func TestLibraryInit(t *testing.T) {
+	suite.Run(t, &libraryInitSuite{transactional: false})
+	suite.Run(t, &libraryInitSuite{transactional: true})
+	suite.Run(t, &libraryInitSuite{transactional: true, bucket: 2})
+}
+
+type libraryInitSuite struct {
+	suite.Suite
+
+	transactional bool
+	bucket        int
+}
+
+func (s *libraryInitSuite) library(selector borges.LocationSelector) *Library {
+	return setupLibrary(s.T(), "test", &LibraryOptions{
+		Transactional:    s.transactional,
+		Bucket:           s.bucket,
+		LocationSelector: selector,
+	})
+}
+
+func (s *libraryInitSuite) commit(r borges.Repository) {
+	if s.transactional {
+		s.Require().NoError(r.Commit())
+	} else {
+		s.Require().NoError(r.Close())
+	}
+}
+
+func (s *libraryInitSuite) TestNotImplemented() {
+	require := s.Require()
+	lib := s.library(nil)
+
+	_, err := lib.Init("github.com/src-d/new")
+	require.True(borges.ErrNotImplemented.Is(err))
+
+	_, err = lib.GetOrInit("github.com/src-d/new")
+	require.True(borges.ErrNotImplemented.Is(err))
+
+	// existing repositories do not need a selector
+	r, err := lib.GetOrInit("github.com/foo/bar")
+	require.NoError(err)
+	require.Equal(borges.LocationID("foo-bar"), r.Location().ID())
+	require.NoError(r.Close())
+}
+
+func (s *libraryInitSuite) TestInit() {
+	require := s.Require()
+	lib := s.library(NewHashSelector(4))
+
+	const id = "github.com/src-d/new"
+	expected, err := NewHashSelector(4).SelectLocation(context.Background(), nil, id)
+	require.NoError(err)
+
+	r, err := lib.Init(id)
+	require.NoError(err)
+	require.Equal(borges.RWMode, r.Mode())
+	require.Equal(expected, r.Location().ID())
+	s.commit(r)
+
+	ok, _, loc, err := lib.Has(id)
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(expected, loc)
+
+	_, err = lib.Init(id)
+	require.True(borges.ErrRepositoryExists.Is(err))
+
+	_, err = lib.Init("github.com/foo/bar")
+	require.True(borges.ErrRepositoryExists.Is(err))
+}
+
+func (s *libraryInitSuite) TestGetOrInit() {
+	require := s.Require()
+	lib := s.library(NewHashSelector(0))
+
+	r, err := lib.GetOrInit("github.com/foo/bar")
+	require.NoError(err)
+	require.Equal(borges.RWMode, r.Mode())
+	require.Equal(borges.LocationID("foo-bar"), r.Location().ID())
+	require.NoError(r.Close())
+
+	r, err = lib.GetOrInit("github.com/src-d/new")
+	require.NoError(err)
+	require.Equal(borges.RWMode, r.Mode())
+	s.commit(r)
+
+	r, err = lib.GetOrInit("github.com/src-d/new")
+	require.NoError(err)
+	require.NoError(r.Close())
+}
+
+func (s *libraryInitSuite) TestSizeSelector() {
+	require := s.Require()
+
+	lib := s.library(NewSizeSelector(0))
+
+	// make foo-bar bigger than foo-qux
+	r, err := lib.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	createTagOnHead(s.T(), r, "grow")
+	s.commit(r)
+
+	r, err = lib.Init("github.com/src-d/new")
+	require.NoError(err)
+	require.Equal(borges.LocationID("foo-qux"), r.Location().ID())
+	s.commit(r)
+
+	lib = s.library(NewSizeSelector(1))
+	r, err = lib.Init("github.com/src-d/new")
+	require.NoError(err)
+	loc := r.Location().ID()
+	require.NotEqual(borges.LocationID("foo-qux"), loc)
+	require.NotEqual(borges.LocationID("foo-bar"), loc)
+	s.commit(r)
+
+	ok, _, locID, err := lib.Has("github.com/src-d/new")
+	require.NoError(err)
+	require.True(ok)
+	require.Equal(loc, locID)
+}
@@ -436,7 +436,7 @@ func (s *Storage) CountLooseRefs() (int, error) {
 }
 
 // PackRefs packs the references kept in memory and write them to the siva storage.
-func (s *Storage) PackRefs() (err error) {
+func (s *Storage) PackRefs() error {
 	if !s.dirtyRefs {
 		return nil
 	}
@@ -454,18 +454,6 @@ func (s *Storage) PackRefs() (err error) {
 		return nil
 	}
 
-	f, err := s.filesystem().OpenFile(
-		packedRefsPath,
-		os.O_TRUNC|os.O_CREATE|os.O_WRONLY,
-		0660,
-	)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		err = f.Close()
-	}()
-
 	refs := make([]*plumbing.Reference, 0, len(s.ReferenceStorage))
 	for _, r := range s.ReferenceStorage {
 		if r.Name() != plumbing.HEAD {
@@ -473,21 +461,37 @@ func (s *Storage) PackRefs() (err error) {
 		}
 	}
 
-	if len(refs) == 0 {
-		return nil
-	}
-
 	sort.Slice(refs, func(i, j int) bool {
 		return refs[i].Name() > refs[j].Name()
 	})
 
+	f, err := s.filesystem().OpenFile(
+		packedRefsPath,
+		os.O_TRUNC|os.O_CREATE|os.O_WRONLY,
+		0660,
+	)
+	if err != nil {
+		return err
+	}
+
 	for _, r := range refs {
 		entry := []byte(fmt.Sprintln(r.String()))
 		if _, err := f.Write(entry); err != nil {
+			_ = f.Close()
 			return err
 		}
 	}
 
+	// siva filesystem only allows one file opened for writing so it must be
+	// closed before removing the loose references
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if len(refs) == 0 {
+		return nil
+	}
+
 	return s.removeRefsDir()
 }
 
@@ -3,26 +3,29 @@ package siva
 import (
 	"time"
 
-	errors "gopkg.in/src-d/go-errors.v1"
+	borges "github.com/src-d/go-borges"
 )
 
 // ErrTransactionTimeout is returned when a repository can't be retrieved in
 // transactional mode because of a timeout.
-var ErrTransactionTimeout = errors.NewKind("timeout exceeded: unable to " +
-	"retrieve repository from location %s in transactional mode.")
+var ErrTransactionTimeout = borges.ErrTransactionTimeout
 
 // transactioner manages synchronization to allow transactions on a Location.
+// Transactions in the same process are serialized with a channel and, when
+// a lock is provided, with a lock file between different processes.
 type transactioner struct {
 	notification chan struct{}
 	timeout      time.Duration
 	loc          *Location
 	locReg       *locationRegistry
+	lock         *fileLock
 }
 
 func newTransactioner(
 	loc *Location,
 	locReg *locationRegistry,
 	timeout time.Duration,
+	lock *fileLock,
 ) *transactioner {
 	n := make(chan struct{}, 1)
 	n <- struct{}{}
@@ -31,23 +34,46 @@ func newTransactioner(
 		timeout:      timeout,
 		loc:          loc,
 		locReg:       locReg,
+		lock:         lock,
 	}
 }
 
 // Start requests permission for a new transaction. If it can't get it after a
 // certain amount of time it will fail with an ErrTransactionTimeout error.
 func (t *transactioner) Start() error {
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
 	select {
 	case <-t.notification:
-		t.locReg.StartTransaction(t.loc)
-		return nil
-	case <-time.After(t.timeout):
+	case <-timer.C:
 		return ErrTransactionTimeout.New(t.loc.ID())
 	}
+
+	if t.lock != nil {
+		ok, err := t.lock.Lock(timer.C)
+		if err != nil || !ok {
+			t.notification <- struct{}{}
+			if err != nil {
+				return err
+			}
+
+			return ErrTransactionTimeout.New(t.loc.ID())
+		}
+	}
+
+	t.locReg.StartTransaction(t.loc)
+	return nil
 }
 
 // Stop signals the transaction is finished.
 func (t *transactioner) Stop() {
+	if t.lock != nil {
+		// a lock file that can't be deleted is considered stale by
+		// other processes once its owner finishes
+		t.lock.Unlock()
+	}
+
 	t.locReg.EndTransaction(t.loc)
 	t.notification <- struct{}{}
 }
@@ -25,7 +25,7 @@ func setupTranstactioner(t *testing.T, to time.Duration) *transactioner {
 	require.True(ok)
 	require.Equal(loc, lr)
 
-	txer := newTransactioner(loc, locReg, to)
+	txer := newTransactioner(loc, locReg, to, nil)
 	require.NotNil(txer)
 	require.Equal(loc, txer.loc)
 	require.Equal(locReg, txer.locReg)
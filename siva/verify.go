@@ -0,0 +1,154 @@
+package siva
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"os"
+
+	borges "github.com/src-d/go-borges"
+
+	errors "gopkg.in/src-d/go-errors.v1"
+	siva "gopkg.in/src-d/go-siva.v1"
+)
+
+var (
+	// ErrInvalidSivaIndex is reported by Location.VerifyStorage when the
+	// siva index at some offset can't be read.
+	ErrInvalidSivaIndex = errors.NewKind("invalid index at offset %d in siva file %s")
+	// ErrInvalidSivaEntry is reported by Location.VerifyStorage when the
+	// content of a file does not match its checksum.
+	ErrInvalidSivaEntry = errors.NewKind("invalid entry %s in siva file %s: %s")
+	// ErrMisplacedSivaFile is reported by Library.VerifyStorage when a siva
+	// file is not in the path of its location for any of the layouts of
+	// the library, so it's not used.
+	ErrMisplacedSivaFile = errors.NewKind("siva file %s is not in the path of location %s")
+)
+
+var (
+	_ borges.VerifierLibrary  = (*Library)(nil)
+	_ borges.VerifierLocation = (*Location)(nil)
+)
+
+// VerifyStorage implements borges.VerifierLibrary interface. It reports the
+// siva files found by the patterns of the library layouts that are not in
+// the path of their location, for example when they were copied to the
+// wrong bucket directory. These files are ignored by the library.
+func (l *Library) VerifyStorage(ctx context.Context) ([]error, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	misplaced, err := l.misplaced()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []error
+	for _, f := range misplaced {
+		problems = append(problems, ErrMisplacedSivaFile.New(f.path, f.id))
+	}
+
+	return problems, nil
+}
+
+// VerifyStorage implements borges.VerifierLocation interface. It checks that
+// the chain of indexes of the siva file can be read, for the last committed
+// state and each location version, and that the content of every file is
+// inside the siva file and matches its checksum, when it's stored. Data
+// written by a transaction in progress is not verified.
+func (l *Location) VerifyStorage(ctx context.Context) ([]error, error) {
+	f, err := l.lib.fs.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// the checkpoint is read again as the cached one is only updated when
+	// the siva file can be read
+	cp, err := newCheckpoint(l.lib.fs, l.path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	size := cp.Offset()
+	if size == 0 {
+		return nil, nil
+	}
+
+	var (
+		problems []error
+		verified = make(map[sivaEntryKey]struct{})
+	)
+
+	for _, offset := range l.versionOffsets(size) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		r := siva.NewReaderWithOffset(f, offset)
+		index, err := r.Index()
+		if err != nil {
+			problems = append(problems,
+				ErrInvalidSivaIndex.Wrap(err, offset, l.path))
+			continue
+		}
+
+		for _, e := range index {
+			// the same entry can be in the index of several versions
+			pos, err := r.Seek(e)
+			if err != nil {
+				return nil, err
+			}
+
+			key := sivaEntryKey{name: e.Name, pos: pos}
+			if _, ok := verified[key]; ok {
+				continue
+			}
+			verified[key] = struct{}{}
+
+			if err := verifySivaEntry(r, e); err != nil {
+				problems = append(problems,
+					ErrInvalidSivaEntry.New(e.Name, l.path, err))
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+type sivaEntryKey struct {
+	name string
+	pos  int64
+}
+
+func verifySivaEntry(r siva.Reader, e *siva.IndexEntry) error {
+	content, err := r.Get(e)
+	if err != nil {
+		return err
+	}
+
+	crc := crc32.NewIEEE()
+	n, err := io.Copy(crc, content)
+	if err != nil {
+		return err
+	}
+
+	if uint64(n) != e.Size {
+		return io.ErrUnexpectedEOF
+	}
+
+	// siva files written by go-billy-siva do not store the checksum
+	if e.CRC32 != 0 && crc.Sum32() != e.CRC32 {
+		return siva.ErrCRC32Missmatch
+	}
+
+	return nil
+}
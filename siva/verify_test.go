@@ -0,0 +1,170 @@
+package siva
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	borges "github.com/src-d/go-borges"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	siva "gopkg.in/src-d/go-siva.v1"
+)
+
+func TestVerify(t *testing.T) {
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/rooted", true, 0)
+	lib, err := NewLibrary("test", fs, &LibraryOptions{
+		Transactional: true,
+		RootedRepo:    true,
+	})
+	require.NoError(err)
+
+	report, err := borges.Verify(context.Background(), lib,
+		&borges.VerifyOptions{Objects: true})
+	require.NoError(err)
+	require.True(report.OK())
+	require.Len(report.Locations, 1)
+
+	var repos []borges.RepositoryID
+	for _, r := range report.Locations[0].Repositories {
+		repos = append(repos, r.ID)
+	}
+	require.ElementsMatch([]borges.RepositoryID{
+		"gitserver.com/a",
+		"gitserver.com/b",
+		"gitserver.com/c",
+		"gitserver.com/d",
+		"gitserver.com/e",
+	}, repos)
+}
+
+func TestVerify_BrokenReference(t *testing.T) {
+	require := require.New(t)
+
+	lib := setupLibrary(t, "test", &LibraryOptions{Transactional: true})
+
+	r, err := lib.Get("github.com/foo/bar", borges.RWMode)
+	require.NoError(err)
+	missing := plumbing.NewHash("0000000000000000000000000000000000000042")
+	err = r.R().Storer.SetReference(plumbing.NewHashReference(
+		"refs/heads/broken", missing))
+	require.NoError(err)
+	require.NoError(r.Commit())
+
+	report, err := borges.Verify(context.Background(), lib, nil)
+	require.NoError(err)
+	require.False(report.OK())
+	require.Len(report.Locations, 2)
+
+	for _, loc := range report.Locations {
+		require.Empty(loc.Errors)
+
+		if loc.ID != "foo-bar" {
+			require.True(loc.OK())
+			continue
+		}
+
+		require.Len(loc.Repositories, 1)
+		repo := loc.Repositories[0]
+		require.Len(repo.Errors, 1)
+		require.True(borges.ErrBrokenReference.Is(repo.Errors[0]))
+	}
+}
+
+func TestVerifyStorage(t *testing.T) {
+	require := require.New(t)
+
+	fs, _ := setupFS(t, "../_testdata/siva", true, 0)
+	lib, err := NewLibrary("test", fs, &LibraryOptions{})
+	require.NoError(err)
+
+	l, err := lib.Location("foo-bar")
+	require.NoError(err)
+	loc := l.(*Location)
+
+	problems, err := loc.VerifyStorage(context.Background())
+	require.NoError(err)
+	require.Empty(problems)
+
+	data, err := ioutil.ReadFile("../_testdata/siva/foo-bar.siva")
+	require.NoError(err)
+
+	// the index is at the end of the file
+	corrupted := append([]byte(nil), data...)
+	corrupted[len(corrupted)-30] ^= 0xff
+	require.NoError(util.WriteFile(fs, "foo-bar.siva", corrupted, 0666))
+
+	problems, err = loc.VerifyStorage(context.Background())
+	require.NoError(err)
+	require.Len(problems, 1)
+	require.True(ErrInvalidSivaIndex.Is(problems[0]))
+
+	report, err := borges.Verify(context.Background(), lib, nil)
+	require.NoError(err)
+	require.False(report.OK())
+	require.Len(report.Locations, 2)
+	for _, l := range report.Locations {
+		if l.ID == "foo-bar" {
+			require.Len(l.Errors, 1)
+			require.Empty(l.Repositories)
+		} else {
+			require.True(l.OK())
+		}
+	}
+}
+
+func TestVerifyStorage_Checksum(t *testing.T) {
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	w := siva.NewWriter(&buf)
+	for _, name := range []string{"a", "b"} {
+		err := w.WriteHeader(&siva.Header{Name: name, Mode: 0666})
+		require.NoError(err)
+		_, err = w.Write([]byte("content of " + name))
+		require.NoError(err)
+	}
+	require.NoError(w.Close())
+
+	data := buf.Bytes()
+	// modify the content of the first file
+	data[0] = 'C'
+
+	fs, _ := setupFS(t, "../_testdata/siva", true, 0)
+	require.NoError(util.WriteFile(fs, "broken.siva", data, 0666))
+
+	lib, err := NewLibrary("test", fs, &LibraryOptions{})
+	require.NoError(err)
+	l, err := lib.Location("broken")
+	require.NoError(err)
+
+	problems, err := l.(*Location).VerifyStorage(context.Background())
+	require.NoError(err)
+	require.Len(problems, 1)
+	require.True(ErrInvalidSivaEntry.Is(problems[0]))
+	require.Contains(problems[0].Error(), "invalid entry a ")
+}
+
+func TestVerify_MisplacedSivaFile(t *testing.T) {
+	require := require.New(t)
+
+	fs := setupRelayoutFS(t, 2, 2)
+	data, err := ioutil.ReadFile("../_testdata/siva/foo-bar.siva")
+	require.NoError(err)
+	require.NoError(util.WriteFile(fs, "zz/foo-other.siva", data, 0666))
+
+	lib, err := NewLibrary("test", fs, &LibraryOptions{Bucket: 2})
+	require.NoError(err)
+
+	report, err := borges.Verify(context.Background(), lib, nil)
+	require.NoError(err)
+	require.False(report.OK())
+	require.Len(report.Locations, 2)
+	require.Len(report.Errors, 1)
+	require.True(ErrMisplacedSivaFile.Is(report.Errors[0]))
+}
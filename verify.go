@@ -0,0 +1,323 @@
+package borges
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/src-d/go-errors.v1"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/revlist"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+var (
+	// ErrBrokenReference is reported by Verify when a reference does not
+	// resolve to an existing object.
+	ErrBrokenReference = errors.NewKind("broken reference %s")
+	// ErrBrokenObject is reported by Verify when an object reachable from
+	// the references can't be found or read.
+	ErrBrokenObject = errors.NewKind("broken object %s")
+)
+
+// VerifierLocation is a Location that can check the integrity of its own
+// storage, for example the indexes of a container file.
+type VerifierLocation interface {
+	Location
+	// VerifyStorage checks the storage of the Location and returns the
+	// problems found. The returned error is only used when the check
+	// itself could not be done.
+	VerifyStorage(context.Context) ([]error, error)
+}
+
+// VerifierLibrary is a Library that can check the integrity of its own
+// storage, for example files that do not belong to any location.
+type VerifierLibrary interface {
+	Library
+	// VerifyStorage checks the storage of the Library and returns the
+	// problems found. The returned error is only used when the check
+	// itself could not be done.
+	VerifyStorage(context.Context) ([]error, error)
+}
+
+// VerifyOptions holds configuration options for Verify.
+type VerifyOptions struct {
+	// Objects enables walking and reading all the objects reachable from
+	// the references of each repository. It can be very slow.
+	Objects bool
+}
+
+// VerifyReport holds the problems found by Verify.
+type VerifyReport struct {
+	// Errors contains the problems of the library that are not related to
+	// a single location.
+	Errors []error
+	// Locations contains a report for each of the verified locations.
+	Locations []*LocationReport
+}
+
+// OK returns true if no problems were found.
+func (r *VerifyReport) OK() bool {
+	if len(r.Errors) > 0 {
+		return false
+	}
+
+	for _, l := range r.Locations {
+		if !l.OK() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// LocationReport holds the problems found in a Location.
+type LocationReport struct {
+	// ID is the LocationID of the verified location.
+	ID LocationID
+	// Errors contains the problems of the location that are not related to
+	// a single repository, like a corrupted storage.
+	Errors []error
+	// Repositories contains a report for each of the repositories of the
+	// location.
+	Repositories []*RepositoryReport
+}
+
+// OK returns true if no problems were found in the location.
+func (r *LocationReport) OK() bool {
+	if len(r.Errors) > 0 {
+		return false
+	}
+
+	for _, repo := range r.Repositories {
+		if !repo.OK() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RepositoryReport holds the problems found in a Repository.
+type RepositoryReport struct {
+	// ID is the RepositoryID of the verified repository.
+	ID RepositoryID
+	// Errors contains the problems found in the references and objects of
+	// the repository.
+	Errors []error
+}
+
+// OK returns true if no problems were found in the repository.
+func (r *RepositoryReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// Verify checks the integrity of all the locations and repositories of a
+// Library. The storage of the library is verified when it implements
+// VerifierLibrary. For each location its storage is verified, when it
+// implements VerifierLocation, and every reference of each repository is checked to
+// point to an existing object. The objects reachable from the references
+// are also read when enabled in options.
+//
+// The problems found are returned in the report, the error is only used
+// when the library can't be traversed or the context is canceled.
+func Verify(
+	ctx context.Context,
+	lib Library,
+	options *VerifyOptions,
+) (*VerifyReport, error) {
+	if options == nil {
+		options = &VerifyOptions{}
+	}
+
+	var locs LocationIterator
+	var err error
+	if l, ok := lib.(ContextLibrary); ok {
+		locs, err = l.LocationsContext(ctx)
+	} else {
+		locs, err = lib.Locations()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{}
+	if v, ok := lib.(VerifierLibrary); ok {
+		errs, err := v.VerifyStorage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Errors = errs
+	}
+
+	err = locs.ForEach(func(loc Location) error {
+		r, err := verifyLocation(ctx, loc, options)
+		if err != nil {
+			return err
+		}
+
+		report.Locations = append(report.Locations, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func verifyLocation(
+	ctx context.Context,
+	loc Location,
+	options *VerifyOptions,
+) (*LocationReport, error) {
+	report := &LocationReport{ID: loc.ID()}
+
+	if v, ok := loc.(VerifierLocation); ok {
+		errs, err := v.VerifyStorage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(errs) > 0 {
+			// the repositories of a broken storage can't be trusted
+			report.Errors = errs
+			return report, nil
+		}
+	}
+
+	var repos RepositoryIterator
+	var err error
+	if l, ok := loc.(ContextLocation); ok {
+		repos, err = l.RepositoriesContext(ctx, ReadOnlyMode)
+	} else {
+		repos, err = loc.Repositories(ReadOnlyMode)
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, err)
+		return report, nil
+	}
+
+	err = repos.ForEach(func(r Repository) error {
+		defer r.Close()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		report.Repositories = append(
+			report.Repositories,
+			verifyRepository(r, options),
+		)
+
+		return nil
+	})
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return nil, err
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, err)
+	}
+
+	return report, nil
+}
+
+func verifyRepository(r Repository, options *VerifyOptions) *RepositoryReport {
+	report := &RepositoryReport{ID: r.ID()}
+	sto := r.R().Storer
+
+	refs, err := sto.IterReferences()
+	if err != nil {
+		report.Errors = append(report.Errors, err)
+		return report
+	}
+
+	var hashes []plumbing.Hash
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		// names with a component starting with a dot are not valid git
+		// references, like placeholder files some storages keep in refs
+		if hiddenReference(ref.Name()) {
+			return nil
+		}
+
+		// HEAD can point to a branch not yet created
+		if ref.Name() == plumbing.HEAD &&
+			(ref.Type() == plumbing.SymbolicReference || ref.Hash().IsZero()) {
+			return nil
+		}
+
+		if ref.Type() == plumbing.SymbolicReference {
+			resolved, err := storer.ResolveReference(sto, ref.Name())
+			if err != nil {
+				report.Errors = append(report.Errors,
+					ErrBrokenReference.Wrap(err, ref.Name()))
+				return nil
+			}
+
+			ref = resolved
+		}
+
+		_, err := sto.EncodedObject(plumbing.AnyObject, ref.Hash())
+		if err != nil {
+			report.Errors = append(report.Errors,
+				ErrBrokenReference.Wrap(err, ref.Name()))
+			return nil
+		}
+
+		hashes = append(hashes, ref.Hash())
+		return nil
+	})
+	if err != nil {
+		report.Errors = append(report.Errors, err)
+		return report
+	}
+
+	if !options.Objects || len(hashes) == 0 {
+		return report
+	}
+
+	objects, err := revlist.Objects(sto, hashes, nil)
+	if err != nil {
+		report.Errors = append(report.Errors, err)
+		return report
+	}
+
+	for _, h := range objects {
+		if err := readObject(sto, h); err != nil {
+			report.Errors = append(report.Errors,
+				ErrBrokenObject.Wrap(err, h))
+		}
+	}
+
+	return report
+}
+
+func readObject(sto storer.EncodedObjectStorer, h plumbing.Hash) error {
+	obj, err := sto.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return err
+	}
+
+	r, err := obj.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(ioutil.Discard, r)
+	return err
+}
+
+func hiddenReference(name plumbing.ReferenceName) bool {
+	for _, part := range strings.Split(name.String(), "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+
+	return false
+}